@@ -0,0 +1,198 @@
+// Package agent keeps the unlocked master identity in memory (similar to ssh-agent), and serves
+// decrypt requests over a Unix socket - so that the master key storage (f.e. Bitwarden)
+// only needs to be unlocked once, and not for every key or CLI invocation. Encryption does not need the
+// identity: the agent only hands out the recipients, and the CLI encrypts locally.
+//
+// The socket lives in a directory which only the current user can access; the client refuses sockets which are
+// not owned by the current user, as another user could otherwise receive the seeds to encrypt or decrypt.
+//
+// The protocol is newline delimited JSON: one Request per connection, answered by one Response.
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SocketEnvVar points to the agent socket; if set, the CLI uses the agent automatically.
+const SocketEnvVar = "NATSCTL_AGENT_SOCK"
+
+const opPing = "ping"
+const opRecipients = "recipients"
+const opDecrypt = "decrypt"
+
+type Request struct {
+	Op   string `json:"op"`
+	Data []byte `json:"data,omitempty"`
+}
+
+type Response struct {
+	Data       []byte    `json:"data,omitempty"`
+	Recipients []string  `json:"recipients,omitempty"`
+	ExpiresAt  time.Time `json:"expiresAt,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// DefaultSocketPath returns $XDG_RUNTIME_DIR/natsctl-agent.sock, or agent.sock in a per-user directory in the temp
+// dir (f.e. /tmp/natsctl-1000/agent.sock).
+func DefaultSocketPath() string {
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); len(runtimeDir) > 0 {
+		return filepath.Join(runtimeDir, "natsctl-agent.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("natsctl-%d", os.Getuid()), "agent.sock")
+}
+
+// Server holds the identities until the TTL expires.
+type Server struct {
+	mu         sync.Mutex
+	identities []age.Identity
+	// recipients of the identities, see config.IdentityRecipients
+	recipients []string
+	expiresAt  time.Time
+	// listener is set while serving; closing it removes the socket.
+	listener net.Listener
+}
+
+func NewServer(identities []age.Identity, recipients []string, ttl time.Duration) *Server {
+	return &Server{
+		identities: identities,
+		recipients: recipients,
+		expiresAt:  time.Now().Add(ttl),
+	}
+}
+
+// ListenAndServe serves requests on the socket until the TTL expires or Close() is called.
+func (s *Server) ListenAndServe(socketPath string) error {
+	if err := ensurePrivateDir(filepath.Dir(socketPath)); err != nil {
+		return err
+	}
+	if c := NewClient(socketPath); c.Ping() == nil {
+		return fmt.Errorf("an agent is already running on %s", socketPath)
+	}
+	// stale socket of a crashed agent
+	_ = os.Remove(socketPath)
+
+	// only the current user may talk to the agent; the socket is created with mode 0600 right away.
+	var listener net.Listener
+	err := withUmask(0177, func() (err error) {
+		listener, err = net.Listen("unix", socketPath)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if len(s.identities) == 0 {
+		// closed before the socket was created
+		s.mu.Unlock()
+		return listener.Close()
+	}
+	s.listener = listener
+	s.mu.Unlock()
+	defer s.Close()
+
+	timer := time.AfterFunc(time.Until(s.expiresAt), s.Close)
+	defer timer.Stop()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// ensurePrivateDir creates the directory of the socket, and checks that only the current user can access it -
+// otherwise, another user could replace the socket.
+func ensurePrivateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !info.IsDir():
+		return fmt.Errorf("socket directory %s is not a directory", dir)
+	case !ownedByCurrentUser(info):
+		return fmt.Errorf("socket directory %s is not owned by the current user", dir)
+	case info.Mode().Perm()&0077 != 0:
+		return fmt.Errorf("socket directory %s must only be accessible by the current user (chmod 700)", dir)
+	}
+	return nil
+}
+
+// Close forgets the identities, and stops ListenAndServe; the socket is removed right away, so that Close can be
+// called shortly before the process exits (f.e. on SIGINT). It can be called several times.
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.identities = nil
+	s.recipients = nil
+	if s.listener != nil {
+		// the listener removes the socket file it created.
+		_ = s.listener.Close()
+		s.listener = nil
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	var req Request
+	var resp Response
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+		resp.Error = fmt.Sprintf("malformed request: %s", err)
+	} else {
+		resp = s.process(req)
+	}
+	_ = json.NewEncoder(conn).Encode(resp)
+}
+
+func (s *Server) process(req Request) Response {
+	s.mu.Lock()
+	identities := s.identities
+	recipients := s.recipients
+	expiresAt := s.expiresAt
+	s.mu.Unlock()
+
+	if len(identities) == 0 || time.Now().After(expiresAt) {
+		return Response{Error: "agent is locked (TTL expired)"}
+	}
+
+	switch req.Op {
+	case opPing:
+		return Response{ExpiresAt: expiresAt}
+	case opRecipients:
+		return Response{Recipients: recipients}
+	case opDecrypt:
+		r, err := age.Decrypt(armor.NewReader(bytes.NewReader(req.Data)), identities...)
+		if err != nil {
+			return Response{Error: err.Error()}
+		}
+		plaintext, err := io.ReadAll(r)
+		if err != nil {
+			return Response{Error: err.Error()}
+		}
+		return Response{Data: plaintext}
+	default:
+		return Response{Error: fmt.Sprintf("unknown operation %q", req.Op)}
+	}
+}
@@ -0,0 +1,253 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+func newTestIdentity(t *testing.T) *age.X25519Identity {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identity
+}
+
+func encryptArmored(t *testing.T, plaintext []byte, recipient age.Recipient) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	armorWriter := armor.NewWriter(buf)
+	w, err := age.Encrypt(armorWriter, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := armorWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// startServer serves the identity on a socket in a private temporary directory, until the test ends. It returns
+// the socket path, and the channel receiving the result of ListenAndServe.
+func startServer(t *testing.T, server *Server) (string, chan error) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the agent needs Unix sockets")
+	}
+	socketPath := filepath.Join(t.TempDir(), "agent", "agent.sock")
+	done := make(chan error, 1)
+	go func() {
+		done <- server.ListenAndServe(socketPath)
+	}()
+	t.Cleanup(server.Close)
+
+	client := NewClient(socketPath)
+	for i := 0; client.Ping() != nil; i++ {
+		if i == 100 {
+			t.Fatal("the agent did not start")
+		}
+		select {
+		case err := <-done:
+			t.Fatalf("the agent stopped: %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return socketPath, done
+}
+
+func waitForStop(t *testing.T, done chan error) {
+	t.Helper()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected ListenAndServe to return without error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ListenAndServe did not return")
+	}
+}
+
+func TestDecryptAndRecipients(t *testing.T) {
+	identity := newTestIdentity(t)
+	server := NewServer([]age.Identity{identity}, []string{identity.Recipient().String()}, time.Hour)
+	socketPath, _ := startServer(t, server)
+	client := NewClient(socketPath)
+
+	recipients, err := client.Recipients()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recipients) != 1 || recipients[0] != identity.Recipient().String() {
+		t.Errorf("expected the recipient of the identity, got %v", recipients)
+	}
+
+	plaintext, err := client.Decrypt(encryptArmored(t, []byte("seed"), identity.Recipient()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "seed" {
+		t.Errorf("expected the plaintext, got %q", plaintext)
+	}
+
+	_, err = client.Decrypt(encryptArmored(t, []byte("seed"), newTestIdentity(t).Recipient()))
+	if err == nil || !strings.HasPrefix(err.Error(), "agent: ") {
+		t.Errorf("expected the decryption error of the agent, got %v", err)
+	}
+
+	expiresAt, err := client.ExpiresAt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if until := time.Until(expiresAt); until < 59*time.Minute || until > time.Hour {
+		t.Errorf("expected the agent to expire in an hour, got %s", until)
+	}
+}
+
+func TestMalformedAndUnknownRequests(t *testing.T) {
+	identity := newTestIdentity(t)
+	socketPath, _ := startServer(t, NewServer([]age.Identity{identity}, nil, time.Hour))
+
+	send := func(request string) Response {
+		conn, err := net.Dial("unix", socketPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte(request + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		var resp Response
+		if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	if resp := send("garbage"); !strings.HasPrefix(resp.Error, "malformed request") {
+		t.Errorf("expected a malformed request error, got %+v", resp)
+	}
+	if resp := send(`{"op":"encrypt"}`); resp.Error != `unknown operation "encrypt"` {
+		t.Errorf("expected an unknown operation error, got %+v", resp)
+	}
+}
+
+func TestSocketIsPrivate(t *testing.T) {
+	socketPath, _ := startServer(t, NewServer([]age.Identity{newTestIdentity(t)}, nil, time.Hour))
+
+	for path, perm := range map[string]os.FileMode{socketPath: 0600, filepath.Dir(socketPath): 0700} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != perm {
+			t.Errorf("%s: expected mode %v, got %v", path, perm, info.Mode().Perm())
+		}
+	}
+}
+
+func TestRefusesSharedSocketDirectory(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the agent needs Unix sockets")
+	}
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer([]age.Identity{newTestIdentity(t)}, nil, time.Hour)
+	err := server.ListenAndServe(filepath.Join(dir, "agent.sock"))
+	if err == nil || !strings.Contains(err.Error(), "chmod 700") {
+		t.Errorf("expected the shared directory to be refused, got %v", err)
+	}
+}
+
+func TestSecondAgentOnSameSocket(t *testing.T) {
+	socketPath, _ := startServer(t, NewServer([]age.Identity{newTestIdentity(t)}, nil, time.Hour))
+
+	second := NewServer([]age.Identity{newTestIdentity(t)}, nil, time.Hour)
+	if err := second.ListenAndServe(socketPath); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Errorf("expected an error for the running agent, got %v", err)
+	}
+	if err := NewClient(socketPath).Ping(); err != nil {
+		t.Errorf("expected the first agent to keep running, got %v", err)
+	}
+}
+
+func TestCloseRemovesSocket(t *testing.T) {
+	server := NewServer([]age.Identity{newTestIdentity(t)}, nil, time.Hour)
+	socketPath, done := startServer(t, server)
+
+	server.Close()
+	if _, err := os.Lstat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("expected the socket to be removed right away, got %v", err)
+	}
+	waitForStop(t, done)
+	server.Close()
+}
+
+func TestTTLExpires(t *testing.T) {
+	server := NewServer([]age.Identity{newTestIdentity(t)}, nil, 300*time.Millisecond)
+	socketPath, done := startServer(t, server)
+
+	waitForStop(t, done)
+	if err := NewClient(socketPath).Ping(); err == nil {
+		t.Error("expected the agent to be gone after the TTL")
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.identities) != 0 {
+		t.Error("expected the identities to be forgotten")
+	}
+}
+
+func TestClientRefusesForeignSockets(t *testing.T) {
+	dir := t.TempDir()
+	notASocket := filepath.Join(dir, "agent.sock")
+	if err := os.WriteFile(notASocket, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewClient(notASocket).Ping(); err == nil || !strings.Contains(err.Error(), "refusing") {
+		t.Errorf("expected a file to be refused, got %v", err)
+	}
+	if err := NewClient(filepath.Join(dir, "missing.sock")).Ping(); err == nil || !strings.Contains(err.Error(), SocketEnvVar) {
+		t.Errorf("expected a connection error naming %s, got %v", SocketEnvVar, err)
+	}
+
+	if runtime.GOOS == "windows" || os.Getuid() != 0 {
+		t.Skip("changing the owner of the socket needs root")
+	}
+	socketPath, _ := startServer(t, NewServer([]age.Identity{newTestIdentity(t)}, nil, time.Hour))
+	if err := os.Lchown(socketPath, 65534, 65534); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewClient(socketPath).Ping(); err == nil || !strings.Contains(err.Error(), "refusing") {
+		t.Errorf("expected a socket of another user to be refused, got %v", err)
+	}
+}
+
+func TestNewClientFromEnv(t *testing.T) {
+	t.Setenv(SocketEnvVar, "")
+	if NewClientFromEnv() != nil {
+		t.Error("expected no client without " + SocketEnvVar)
+	}
+	t.Setenv(SocketEnvVar, "/run/agent.sock")
+	if c := NewClientFromEnv(); c == nil || c.socketPath != "/run/agent.sock" {
+		t.Errorf("expected a client for the socket, got %+v", c)
+	}
+}
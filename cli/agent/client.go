@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+type Client struct {
+	socketPath string
+}
+
+// NewClientFromEnv returns a client for the agent in NATSCTL_AGENT_SOCK, or nil if the variable is not set.
+func NewClientFromEnv() *Client {
+	socketPath := os.Getenv(SocketEnvVar)
+	if len(socketPath) == 0 {
+		return nil
+	}
+	return NewClient(socketPath)
+}
+
+func NewClient(socketPath string) *Client {
+	return &Client{socketPath: socketPath}
+}
+
+// Ping checks that the agent is reachable and unlocked.
+func (c *Client) Ping() error {
+	_, err := c.call(Request{Op: opPing})
+	return err
+}
+
+// ExpiresAt returns when the agent forgets the master identity.
+func (c *Client) ExpiresAt() (time.Time, error) {
+	resp, err := c.call(Request{Op: opPing})
+	return resp.ExpiresAt, err
+}
+
+// Decrypt decrypts an armored AGE file with the master identity.
+func (c *Client) Decrypt(ciphertext []byte) ([]byte, error) {
+	resp, err := c.call(Request{Op: opDecrypt, Data: ciphertext})
+	return resp.Data, err
+}
+
+// Recipients returns the recipients of the master identity, to encrypt locally (see config.ParseAgentRecipient).
+func (c *Client) Recipients() ([]string, error) {
+	resp, err := c.call(Request{Op: opRecipients})
+	return resp.Recipients, err
+}
+
+func (c *Client) call(req Request) (Response, error) {
+	var resp Response
+	// another user could have created the socket, to receive the seeds.
+	info, err := os.Lstat(c.socketPath)
+	if err != nil {
+		return resp, fmt.Errorf("connecting to agent at %s (%s): %w", c.socketPath, SocketEnvVar, err)
+	}
+	if info.Mode().Type() != os.ModeSocket || !ownedByCurrentUser(info) {
+		return resp, fmt.Errorf("refusing to connect to agent at %s (%s): not a socket owned by the current user", c.socketPath, SocketEnvVar)
+	}
+	conn, err := net.DialTimeout("unix", c.socketPath, 5*time.Second)
+	if err != nil {
+		return resp, fmt.Errorf("connecting to agent at %s (%s): %w", c.socketPath, SocketEnvVar, err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return resp, err
+	}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return resp, fmt.Errorf("reading agent response: %w", err)
+	}
+	if len(resp.Error) > 0 {
+		return resp, errors.New("agent: " + resp.Error)
+	}
+	return resp, nil
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package agent
+
+import "os"
+
+// ownedByCurrentUser cannot be checked without Unix file owners.
+func ownedByCurrentUser(info os.FileInfo) bool {
+	return true
+}
+
+func withUmask(mask int, fn func() error) error {
+	return fn()
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package agent
+
+import (
+	"os"
+	"syscall"
+)
+
+func ownedByCurrentUser(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(stat.Uid) == os.Getuid()
+}
+
+// withUmask runs fn with the given umask; the umask is process wide, so this is only used while binding the socket.
+func withUmask(mask int, fn func() error) error {
+	previous := syscall.Umask(mask)
+	defer syscall.Umask(previous)
+	return fn()
+}
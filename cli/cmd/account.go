@@ -4,18 +4,20 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"fmt"
 	"github.com/nats-io/jwt/v2"
 	"github.com/nats-io/nkeys"
 	"github.com/pterm/pterm"
 	"github.com/sandstorm/natsCtl/cli/common"
 	"github.com/sandstorm/natsCtl/cli/config"
-	"os"
+	"github.com/sandstorm/natsCtl/cli/transaction"
 
 	"github.com/spf13/cobra"
 )
 
 func newAccountCmd(cfg config.Config) *cobra.Command {
-	return &cobra.Command{
+	var operatorFlag, accountFlag, descriptionFlag string
+	cmd := &cobra.Command{
 		Use:   "account",
 		Short: "A brief description of your command",
 		Long: `A longer description that spans multiple lines and likely contains examples
@@ -24,59 +26,110 @@ and usage of using your command. For example:
 Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			operator := OperatorName(os.Getenv("OPERATOR_NAME"))
-			account := AccountName(os.Getenv("ACCOUNT_NAME"))
-			accountDescription := AccountDescription(os.Getenv("ACCOUNT_DESCRIPTION"))
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			operator := OperatorName(flagOrEnv(operatorFlag, "OPERATOR_NAME"))
+			account := AccountName(flagOrEnv(accountFlag, "ACCOUNT_NAME"))
+			accountDescription := AccountDescription(flagOrEnv(descriptionFlag, "ACCOUNT_DESCRIPTION"))
 
 			//setupNsc()
 
 			if operator == "" {
-				operator = chooseOperator()
+				if operator, err = chooseOperator(&cfg); err != nil {
+					return err
+				}
 			}
 
 			if account == "" {
+				if err := common.RequireInteractive("ACCOUNT_NAME", "account", "ACCOUNT_NAME"); err != nil {
+					return err
+				}
 				pterm.Println("Account name - our convention is UPPERCASE, f.e. SANDSTORM or MY_CUSTOMER:")
-				account = AccountName(common.RequiredTextInput("ACCOUNT_NAME"))
+				input, err := common.RequiredTextInput("ACCOUNT_NAME")
+				if err != nil {
+					return err
+				}
+				account = AccountName(input)
 			}
 
-			if accountDescription == "" {
+			// the description is optional; so we only ask for it if we are allowed to.
+			if accountDescription == "" && common.IsInteractive() {
 				pterm.Println("Account description (explanatory text)")
 				desc, err := pterm.DefaultInteractiveTextInput.Show("ACCOUNT_DESCRIPTION")
+				if err != nil {
+					return err
+				}
 				accountDescription = AccountDescription(desc)
-				panicOnErr(err)
 			}
 
-			pterm.Info.Printfln(bold.Sprint("Specify your Master Password") + " for decrypting the Operator Scoped Signing Key.")
-			cfg.MasterPasswordDecryptor().Unlock()
 			// make sure we have the most up-to-date JWTs.
-			//NscPullInt(operator)
+			//PullInt(operator, &cfg)
 			// we need the operator signing key to create a new account.
-			pterm.Info.Printfln(`Decrypting Operator Signing Key`)
-			operatorSk := getOperatorSigningKey(operator)
-			operatorSkNkey := decryptNkey(operatorSk, cfg.MasterPasswordDecryptor())
+			operatorSk, err := getOperatorSigningKey(&cfg, operator)
+			if err != nil {
+				return err
+			}
+			var operatorSkNkey nkeys.KeyPair
+			if !dryRun {
+				pterm.Info.Printfln(bold.Sprint("Specify your Master Password") + " for decrypting the Operator Scoped Signing Key.")
+				if err := unlock(&cfg); err != nil {
+					return err
+				}
+				pterm.Info.Printfln(`Decrypting Operator Signing Key`)
+				if operatorSkNkey, err = loadKey(&cfg, operatorSk); err != nil {
+					return err
+				}
+			}
 
-			var accClaim *jwt.AccountClaims
-			if ExistsAccount(operator, account) {
-				accClaim = readAccount(operator, account)
+			// all keys and the account JWT are written together on commit.
+			tx := transaction.New()
+			defer tx.Rollback()
+			keyStore := keyStoreFor(&cfg, tx)
+
+			result := AccountResult{
+				Operator:    string(operator),
+				Account:     string(account),
+				CreatedKeys: []string{},
+				JwtFile:     accountJwtPath(&cfg, operator, account),
+			}
+			// before is kept unmodified for --dry-run.
+			var accClaim, before *jwt.AccountClaims
+			if ExistsAccount(&cfg, operator, account) {
+				if accClaim, err = readAccount(&cfg, operator, account); err != nil {
+					return err
+				}
+				if before, err = readAccount(&cfg, operator, account); err != nil {
+					return err
+				}
 				pterm.Info.Printfln("Updating account %s", account)
 			} else {
 				// account does not exist.
 				pterm.Info.Printfln("Creating account %s", account)
 				accountNkey, err := nkeys.CreateAccount()
-				panicOnErr(err)
+				if err != nil {
+					return err
+				}
 				accClaim = jwt.NewAccountClaims(PublicKey(accountNkey))
 				accClaim.Name = string(account)
 				// ENABLE WITHOUT LIMIT
 				accClaim.Limits.MemoryStorage = -1
 				// ENABLE WITHOUT LIMIT
 				accClaim.Limits.DiskStorage = -1
-				writeAccount(operator, accClaim, operatorSkNkey)
-				storeAndEncryptNkey(accountNkey, cfg.MasterPasswordDecryptor())
-				pterm.Success.Printfln("Encrypted Account Key %s.", bold.Sprint(PublicKey(accountNkey)))
+				if err := keyStore.Put(accountNkey); err != nil {
+					return fmt.Errorf("storing account key: %w", err)
+				}
+				if !dryRun {
+					pterm.Success.Printfln("Encrypted Account Key %s.", bold.Sprint(PublicKey(accountNkey)))
+				}
+				result.Created = true
+				result.CreatedKeys = append(result.CreatedKeys, PublicKey(accountNkey))
 			}
+			result.AccountPublicKey = accClaim.Subject
 
-			accClaim.Description = string(accountDescription)
+			if accountDescription != "" || common.IsInteractive() {
+				// non-interactively, we keep the existing description if none was given.
+				accClaim.Description = string(accountDescription)
+			}
 			// --deny-pub and --deny-sub configures the default_permissions (as in https://docs.nats.io/running-a-nats-service/configuration/securing_nats/authorization)
 			// -> this is if users are created directly with this account key (which should never happen, as we always
 			// want to use Scoped Signing Keys a.k.a Roles), they don't have any rights.
@@ -85,20 +138,50 @@ to quickly create a Cobra application.`,
 
 			// ENSURE UN-SCOPED SIGNING KEY EXISTS (for admin user creation)
 			if !hasUnscopedSigningKey(accClaim) {
-				pterm.Warning.Printfln("Creating (un-scoped) default account signing key (for admin user generation)")
-				signingKey := genAndEncryptAccountSigningKey(cfg.MasterPasswordDecryptor())
+				result.Warnings.Printfln("Creating (un-scoped) default account signing key (for admin user generation)")
+				signingKey, err := genAndEncryptAccountSigningKey(keyStore)
+				if err != nil {
+					return err
+				}
 				accClaim.SigningKeys.Add(string(signingKey))
+				result.CreatedKeys = append(result.CreatedKeys, string(signingKey))
 
 				pterm.Success.Printfln("Key created.")
 			} else {
 				pterm.Success.Printfln("Found un-scoped default account signing key (for admin user generation)")
 			}
 
-			writeAccount(operator, accClaim, operatorSkNkey)
+			if dryRun {
+				// on signing, the issuer is set to the signing key.
+				accClaim.Issuer = operatorSk.Key()
+				changes, err := diffClaims(before, accClaim)
+				if err != nil {
+					return err
+				}
+				return printDryRun(len(result.CreatedKeys), JwtDiff{
+					Name:    fmt.Sprintf("account %s", account),
+					File:    result.JwtFile,
+					Created: result.Created,
+					Changes: changes,
+				})
+			}
+			if _, err := writeAccount(&cfg, tx, operator, accClaim, operatorSkNkey); err != nil {
+				return err
+			}
+			if err := tx.Commit(); err != nil {
+				return err
+			}
 
 			// TODO: DocsFn(operator)
+			return printResult(result)
 		},
 	}
+	cmd.Flags().StringVar(&operatorFlag, "operator", "", "operator name (env: OPERATOR_NAME)")
+	cmd.Flags().StringVar(&accountFlag, "account", "", "account name, by convention UPPERCASE (env: ACCOUNT_NAME)")
+	cmd.Flags().StringVar(&descriptionFlag, "description", "", "account description (env: ACCOUNT_DESCRIPTION)")
+	registerStoreCompletions(cmd, &cfg)
+	supportsDryRun(cmd)
+	return cmd
 }
 
 func hasUnscopedSigningKey(accClaim *jwt.AccountClaims) bool {
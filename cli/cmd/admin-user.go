@@ -9,11 +9,13 @@ import (
 	"github.com/sandstorm/natsCtl/cli/config"
 	"github.com/spf13/cobra"
 	"os"
+	"path/filepath"
 	"time"
 )
 
 func newAdminUserCmd(cfg config.Config) *cobra.Command {
-	return &cobra.Command{
+	var operatorFlag, accountFlag string
+	cmd := &cobra.Command{
 		Use:   "admin-user",
 		Short: "A brief description of your command",
 		Long: `A longer description that spans multiple lines and likely contains examples
@@ -22,10 +24,10 @@ and usage of using your command. For example:
 Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			var err error
-			operator := OperatorName(os.Getenv("OPERATOR_NAME"))
-			account := AccountName(os.Getenv("ACCOUNT_NAME"))
+			operator := OperatorName(flagOrEnv(operatorFlag, "OPERATOR_NAME"))
+			account := AccountName(flagOrEnv(accountFlag, "ACCOUNT_NAME"))
 
 			pterm.Printfln("This script generates a %s for an account valid for %s", bold.Sprint("temporary admin user"), bold.Sprint("24 hours"))
 			pterm.Println("")
@@ -35,25 +37,43 @@ to quickly create a Cobra application.`,
 			pterm.DefaultSection.Println("1) Select account to create admin user for")
 
 			if operator == "" {
-				operator = chooseOperator()
+				if operator, err = chooseOperator(&cfg); err != nil {
+					return err
+				}
 			}
 
 			if account == "" {
 				pterm.Printfln("Choose an account in operator %s:", bold.Sprint(operator))
-				account = chooseAccount(operator)
+				if account, err = chooseAccount(&cfg, operator); err != nil {
+					return err
+				}
 			}
 
-			cfg.MasterPasswordDecryptor().Unlock()
+			if err := unlock(&cfg); err != nil {
+				return err
+			}
 
-			accountClaims := readAccount(operator, account)
-			accountSkNkey := decryptNkey(getAccountSigningKey(accountClaims), cfg.MasterPasswordDecryptor())
+			accountClaims, err := readAccount(&cfg, operator, account)
+			if err != nil {
+				return err
+			}
+			accountSk, err := getAccountSigningKey(accountClaims)
+			if err != nil {
+				return err
+			}
+			accountSkNkey, err := loadKey(&cfg, accountSk)
+			if err != nil {
+				return err
+			}
 
 			pterm.DefaultSection.Println("2) Creating admin user")
 
 			user := "admin"
 			userNkey, err := nkeys.CreateUser()
-			panicOnErr(err)
-			userClaims := jwt.NewUserClaims(publicKey(userNkey))
+			if err != nil {
+				return err
+			}
+			userClaims := jwt.NewUserClaims(PublicKey(userNkey))
 			userClaims.Name = user
 			userClaims.IssuerAccount = accountClaims.Subject
 			userClaims.SetScoped(false)
@@ -64,17 +84,23 @@ to quickly create a Cobra application.`,
 			userClaims.Expires = time.Now().Add(24 * time.Hour).Unix()
 
 			encoded, err := userClaims.Encode(accountSkNkey)
-			panicOnErr(err)
-
-			userConfig, err := jwt.FormatUserConfig(encoded, seed(userNkey))
-			panicOnErr(err)
-			panicOnErr(os.MkdirAll(fmt.Sprintf("nsc/nkeys/creds/%s/%s", operator, account), 0755))
-			err = os.WriteFile(fmt.Sprintf("nsc/nkeys/creds/%s/%s/%s.creds", operator, account, user), userConfig, 0600)
-			panicOnErr(err)
+			if err != nil {
+				return fmt.Errorf("encoding JWT of user %s: %w", user, err)
+			}
 
-			wd, err := os.Getwd()
-			panicOnErr(err)
-			credsFile := fmt.Sprintf(`%s/nsc/nkeys/creds/%s/%s/%s.creds`, wd, operator, account, user)
+			userConfig, err := jwt.FormatUserConfig(encoded, Seed(userNkey))
+			if err != nil {
+				return err
+			}
+			// the path is absolute, as it is used in the nats context.
+			credsFile := credsPath(&cfg, operator, account, UserName(user))
+			if err := os.MkdirAll(filepath.Dir(credsFile), 0755); err != nil {
+				return err
+			}
+			err = os.WriteFile(credsFile, userConfig, 0600)
+			if err != nil {
+				return err
+			}
 			pterm.Success.Printfln(`Created credentials: %s`, credsFile)
 
 			serverUrl := ""
@@ -90,12 +116,31 @@ to quickly create a Cobra application.`,
 				natscontext.WithServerURL(serverUrl),
 				natscontext.WithCreds(credsFile),
 			)
-			panicOnErr(err)
-			panicOnErr(c.Save(""))
-			panicOnErr(natscontext.SelectContext(contextName))
+			if err != nil {
+				return err
+			}
+			if err := c.Save(""); err != nil {
+				return fmt.Errorf("saving nats context %s: %w", contextName, err)
+			}
+			if err := natscontext.SelectContext(contextName); err != nil {
+				return fmt.Errorf("selecting nats context %s: %w", contextName, err)
+			}
 			//nats --creds=./nsc/nkeys/creds/ROOT_natsv1/SANDSTORM/admin.creds --server tls://natsv1.cloud.sandstorm.de:32222  context save --select natsv1_sandstorm_admin
 
 			pterm.Success.Printfln(`Created and auto-selected nats context: %s. To switch to a different context, run %s`, bold.Sprint(contextName), bold.Sprint("nats context select"))
+			return printResult(UserResult{
+				Operator:      string(operator),
+				Account:       string(account),
+				User:          user,
+				UserPublicKey: PublicKey(userNkey),
+				CredsFile:     credsFile,
+				ContextName:   contextName,
+				Expires:       time.Unix(userClaims.Expires, 0).UTC().Format(time.RFC3339),
+			})
 		},
 	}
+	cmd.Flags().StringVar(&operatorFlag, "operator", "", "operator name (env: OPERATOR_NAME)")
+	cmd.Flags().StringVar(&accountFlag, "account", "", "account name (env: ACCOUNT_NAME)")
+	registerStoreCompletions(cmd, &cfg)
+	return cmd
 }
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/pterm/pterm"
+	"github.com/sandstorm/natsCtl/cli/agent"
+	"github.com/sandstorm/natsCtl/cli/common"
+	"github.com/sandstorm/natsCtl/cli/config"
+	"github.com/spf13/cobra"
+	"os"
+	"time"
+)
+
+func newAgentCmd(cfg config.Config) *cobra.Command {
+	var socketPath string
+	var ttl time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "agent",
+		Short: "Caches the unlocked master key in memory and serves it over a Unix socket.",
+		Long: `Similar to ssh-agent: unlocks the master key once, keeps it in memory for --ttl,
+and serves decrypt requests over a Unix socket. The master key never leaves the agent; for encryption, only
+the recipients are fetched from it, and the keys are encrypted locally.
+
+The socket is created in a directory only accessible by the current user (by default, $XDG_RUNTIME_DIR or
+/tmp/natsctl-<uid>); sockets owned by another user are refused.
+
+All other commands use the agent automatically when ` + agent.SocketEnvVar + ` is set:
+
+    natsCtl agent &
+    export ` + agent.SocketEnvVar + `=<printed socket path>
+
+The agent stops (and forgets the master key) when the TTL expires, or on SIGINT/SIGTERM.
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// the agent itself must load the identity from the real master key storage.
+			if err := os.Unsetenv(agent.SocketEnvVar); err != nil {
+				return err
+			}
+
+			if err := unlock(&cfg); err != nil {
+				return err
+			}
+			identity, err := cfg.MasterPasswordDecryptor().LoadMasterPassword()
+			if err != nil {
+				return fmt.Errorf("%w: %w", common.ErrDecryption, err)
+			}
+			identities, err := config.ParseIdentities(identity)
+			if err != nil {
+				return fmt.Errorf("%w: master key: %w", common.ErrConfig, err)
+			}
+			recipients, err := config.IdentityRecipients(identity)
+			if err != nil {
+				return fmt.Errorf("%w: recipients: %w", common.ErrConfig, err)
+			}
+
+			server := agent.NewServer(identities, recipients, ttl)
+			// on SIGINT/SIGTERM, the signal handler (see HandleSignals) forgets the identities and removes the socket.
+			OnCleanup(server.Close)
+
+			pterm.Success.Printfln("Agent unlocked until %s. To use it, run:", time.Now().Add(ttl).Format(time.Kitchen))
+			pterm.Printfln("")
+			pterm.Printfln("    export %s=%s", agent.SocketEnvVar, socketPath)
+			pterm.Printfln("")
+
+			if err := server.ListenAndServe(socketPath); err != nil {
+				return err
+			}
+			pterm.Info.Println("Agent TTL expired; master key removed from memory.")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&socketPath, "socket", agent.DefaultSocketPath(), "path of the Unix socket")
+	cmd.Flags().DurationVar(&ttl, "ttl", time.Hour, "how long the unlocked master key is kept in memory")
+	return cmd
+}
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sandstorm/natsCtl/cli/common"
+	"github.com/sandstorm/natsCtl/cli/config"
+	"github.com/spf13/cobra"
+)
+
+func newCompletionCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "completion bash|zsh|fish",
+		Short: "Generate the shell completion script",
+		Long: `Generate the shell completion script; operator, account, role and user names are completed from the store.
+
+The script completes the command "cli" - so put the built binary on your PATH under this name. Then:
+
+  bash: source <(cli completion bash)
+  zsh:  source <(cli completion zsh)
+  fish: cli completion fish | source`,
+		Args:      exactArgs(1),
+		ValidArgs: []string{"bash", "zsh", "fish"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch args[0] {
+			case "bash":
+				return rootCmd.GenBashCompletionV2(os.Stdout, true)
+			case "zsh":
+				return rootCmd.GenZshCompletion(os.Stdout)
+			case "fish":
+				return rootCmd.GenFishCompletion(os.Stdout, true)
+			default:
+				return fmt.Errorf("%w: unsupported shell %s; only supported: bash zsh fish", common.ErrValidation, args[0])
+			}
+		},
+	}
+}
+
+// IsCompletion is true for the completion command, and for the hidden __complete command called by the completion
+// scripts. Both must work without natsUtilsCfg.json, and must not print anything but the completion to stdout.
+func IsCompletion(args []string) bool {
+	if len(args) > 0 && (args[0] == cobra.ShellCompRequestCmd || args[0] == cobra.ShellCompNoDescRequestCmd) {
+		return true
+	}
+	c, _, err := rootCmd.Find(args)
+	return err == nil && c.Name() == "completion"
+}
+
+// IsDoctor is true for the doctor command, which must never prompt, and must run even if natsUtilsCfg.json is broken.
+func IsDoctor(args []string) bool {
+	c, _, err := rootCmd.Find(args)
+	return err == nil && c.Name() == "doctor"
+}
+
+// registerStoreCompletions completes the --operator, --account and --role flags of a command (if it has them)
+// with the names from the store.
+func registerStoreCompletions(cmd *cobra.Command, cfg *config.Config) {
+	completions := map[string]storeCompletionFunc{
+		"operator": completeOperators,
+		"account":  completeAccounts,
+		"role":     completeRoles,
+	}
+	for flag, completion := range completions {
+		if cmd.Flag(flag) != nil {
+			// only fails if the flag does not exist, or already has a completion.
+			_ = cmd.RegisterFlagCompletionFunc(flag, storeCompletion(cfg, completion))
+		}
+	}
+}
+
+// storeCompletionFunc completes names from the store of the config.
+type storeCompletionFunc func(cfg *config.Config, cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective)
+
+// storeCompletion binds the completion to the config of the command.
+func storeCompletion(cfg *config.Config, completion storeCompletionFunc) func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completion(cfg, cmd, args, toComplete)
+	}
+}
+
+func completeOperators(cfg *config.Config, cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	operators, err := getOperators(cfg)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return operators, cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeAccounts(cfg *config.Config, cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	operator := completionOperator(cfg, cmd)
+	if operator == "" {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	accounts, err := getAccounts(cfg, operator)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return accounts, cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeRoles(cfg *config.Config, cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	operator := completionOperator(cfg, cmd)
+	account := completionFlag(cmd, "account", "ACCOUNT_NAME")
+	if operator == "" || account == "" {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	accountClaims, err := readAccount(cfg, operator, AccountName(account))
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return getRoleNames(accountClaims), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeAccountArg completes the <account> argument of ls and describe.
+func completeAccountArg(cfg *config.Config, cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeAccounts(cfg, cmd, args, toComplete)
+}
+
+// completeAccountAndUserArgs completes the <account> <user> arguments of describe user.
+func completeAccountAndUserArgs(cfg *config.Config, cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	switch len(args) {
+	case 0:
+		return completeAccounts(cfg, cmd, args, toComplete)
+	case 1:
+		operator := completionOperator(cfg, cmd)
+		if operator == "" {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		account := AccountName(args[0])
+		accountClaims, err := readAccount(cfg, operator, account)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		users, err := listUsers(cfg, operator, account, accountClaims)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		var names []string
+		for _, user := range users {
+			names = append(names, user.Name)
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	default:
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completionOperator is the operator given via --operator or OPERATOR_NAME, or the only operator in the store.
+// As we must never prompt during completion, it is empty otherwise.
+func completionOperator(cfg *config.Config, cmd *cobra.Command) OperatorName {
+	if operator := completionFlag(cmd, "operator", "OPERATOR_NAME"); operator != "" {
+		return OperatorName(operator)
+	}
+	operators, err := getOperators(cfg)
+	if err == nil && len(operators) == 1 {
+		return OperatorName(operators[0])
+	}
+	return ""
+}
+
+// completionFlag reads an already typed flag of the command line being completed, with the environment variable as fallback.
+func completionFlag(cmd *cobra.Command, name string, envVar string) string {
+	value := ""
+	if flag := cmd.Flag(name); flag != nil {
+		value = flag.Value.String()
+	}
+	return flagOrEnv(value, envVar)
+}
@@ -1,31 +1,81 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
 	"github.com/pterm/pterm"
 	"github.com/sandstorm/natsCtl/cli/common"
 	"github.com/sandstorm/natsCtl/cli/config"
+	"github.com/sandstorm/natsCtl/cli/keystore"
 	"github.com/spf13/cobra"
-	"os"
 )
 
 func newDecryptNkeyCmd(cfg config.Config) *cobra.Command {
-	return &cobra.Command{
-		Use:   "decrypt-nkey",
-		Short: "A brief description of your command",
-		Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
+	var nkeyFlag string
+	cmd := &cobra.Command{
+		Use:   "decrypt-nkey [-- command [args...]]",
+		Short: "Run a command (by default, a shell) with a decrypted NKey",
+		Long: `Run a command (by default, $SHELL) with a decrypted NKey; f.e. to use it with nsc directly.
+
+The plaintext NKey is written to a private directory on a tmpfs (never to disk), which is passed to the command
+as NKEYS_PATH (the keys directory of nsc). When the command exits - or on SIGTERM - the NKey is wiped.`,
+		Example: `  decrypt-nkey --nkey OABC... -- nsc edit operator --service-url nats://localhost:4222`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key := AccountKey(flagOrEnv(nkeyFlag, "NKEY"))
+			if key == "" {
+				if err := common.RequireInteractive("NKEY", "nkey", "NKEY"); err != nil {
+					return err
+				}
+				pterm.Printfln("nkey to decrypt")
+				input, err := common.RequiredTextInput("NKEY")
+				if err != nil {
+					return err
+				}
+				key = AccountKey(input)
+			}
+			if len(args) == 0 {
+				shell := os.Getenv("SHELL")
+				if shell == "" {
+					shell = "/bin/sh"
+				}
+				args = []string{shell}
+			}
+			if err := unlock(&cfg); err != nil {
+				return err
+			}
+			keypair, err := loadKey(&cfg, key)
+			if err != nil {
+				return err
+			}
+			keysDir, err := keystore.WriteScratchKey(keypair)
+			keypair.Wipe()
+			if err != nil {
+				return err
+			}
+			defer Cleanup()
 
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			pterm.Printfln("nkey to decrypt")
-			key := AccountKey(common.RequiredTextInput("NKEY"))
-			cfg.MasterPasswordDecryptor().Unlock()
-			keypair := decryptNkey(key, cfg.MasterPasswordDecryptor())
+			child := exec.Command(args[0], args[1:]...)
+			child.Stdin, child.Stdout, child.Stderr = os.Stdin, os.Stdout, os.Stderr
+			child.Env = append(os.Environ(), "NKEYS_PATH="+filepath.Dir(keysDir))
+			pterm.Info.Printfln("Running %s with the decrypted NKey %s; it is wiped when the command exits.", args[0], key.Key())
+			if err := child.Start(); err != nil {
+				return fmt.Errorf("%w: %w", common.ErrValidation, err)
+			}
+			subprocess.Store(child.Process)
+			err = child.Wait()
+			subprocess.Store(nil)
 
-			err := os.WriteFile(keyPath(publicKey(keypair)), seed(keypair), 0600)
-			panicOnErr(err)
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				return fmt.Errorf("%s exited with code %d", args[0], exitErr.ExitCode())
+			}
+			return err
 		},
 	}
+	cmd.Flags().StringVar(&nkeyFlag, "nkey", "", "public key of the nkey to decrypt (env: NKEY)")
+	return cmd
 }
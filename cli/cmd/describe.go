@@ -0,0 +1,418 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/pterm/pterm"
+	"github.com/sandstorm/natsCtl/cli/common"
+	"github.com/sandstorm/natsCtl/cli/config"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// newDescribeCmd decodes the JWTs with jwt/v2 directly; so neither nsc nor jq are needed, and the master key
+// is never unlocked. With --output json|yaml, the decoded claims are printed as-is.
+func newDescribeCmd(cfg config.Config) *cobra.Command {
+	var operatorFlag string
+	cmd := &cobra.Command{
+		Use:   "describe",
+		Short: "Show all claims of an operator, account or user JWT (without nsc)",
+	}
+	cmd.PersistentFlags().StringVar(&operatorFlag, "operator", "", "operator name (env: OPERATOR_NAME)")
+	registerStoreCompletions(cmd, &cfg)
+
+	resolveOperator := func() (OperatorName, error) {
+		if operator := OperatorName(flagOrEnv(operatorFlag, "OPERATOR_NAME")); operator != "" {
+			return operator, nil
+		}
+		return chooseOperator(&cfg)
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "operator",
+		Short: "Describe the operator JWT",
+		Args:  exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operator, err := resolveOperator()
+			if err != nil {
+				return err
+			}
+			claims, err := readOperator(&cfg, operator)
+			if err != nil {
+				return err
+			}
+			if outputFormat != outputText {
+				return printClaims(claims)
+			}
+			return describeOperator(os.Stdout, claims)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:               "account <account>",
+		Short:             "Describe an account JWT, including limits, signing keys, imports/exports, revocations and mappings",
+		Args:              exactArgs(1),
+		ValidArgsFunction: storeCompletion(&cfg, completeAccountArg),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operator, err := resolveOperator()
+			if err != nil {
+				return err
+			}
+			claims, err := readAccount(&cfg, operator, AccountName(args[0]))
+			if err != nil {
+				return err
+			}
+			if outputFormat != outputText {
+				return printClaims(claims)
+			}
+			return describeAccount(os.Stdout, claims)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:               "user <account> <user>",
+		Short:             "Describe a user JWT, from its .creds file or the nsc store",
+		Args:              exactArgs(2),
+		ValidArgsFunction: storeCompletion(&cfg, completeAccountAndUserArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operator, err := resolveOperator()
+			if err != nil {
+				return err
+			}
+			account := AccountName(args[0])
+			accountClaims, err := readAccount(&cfg, operator, account)
+			if err != nil {
+				return err
+			}
+			users, err := listUsers(&cfg, operator, account, accountClaims)
+			if err != nil {
+				return err
+			}
+			for _, user := range users {
+				if user.Name == args[1] {
+					claims, err := readUserFile(user.File)
+					if err != nil {
+						return err
+					}
+					if outputFormat != outputText {
+						return printClaims(claims)
+					}
+					return describeUser(os.Stdout, claims)
+				}
+			}
+			return fmt.Errorf("%w: user %s in account %s of operator %s", common.ErrNotFound, args[1], account, operator)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "creds <file>",
+		Short: "Describe the user JWT of a .creds file (the seed is never printed)",
+		Args:  exactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			claims, err := readUserFile(args[0])
+			if err != nil {
+				return err
+			}
+			if outputFormat != outputText {
+				return printClaims(claims)
+			}
+			return describeUser(os.Stdout, claims)
+		},
+	})
+
+	return cmd
+}
+
+// readUserFile decodes the user JWT of a .creds file, or of a plain user JWT file (as in the nsc store).
+func readUserFile(path string) (*jwt.UserClaims, error) {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", common.ErrNotFound, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// ParseDecoratedJWT returns the contents unchanged if they are not decorated.
+	userJwt, err := jwt.ParseDecoratedJWT(contents)
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading user JWT from %s: %w", common.ErrValidation, path, err)
+	}
+	claims, err := jwt.DecodeUserClaims(strings.TrimSpace(userJwt))
+	if err != nil {
+		return nil, fmt.Errorf("%w: decoding user JWT from %s: %w", common.ErrValidation, path, err)
+	}
+	return claims, nil
+}
+
+// printClaims prints the decoded claims with their JWT field names - for YAML, the claims are converted
+// via JSON, as the jwt/v2 types only carry json tags. JSON is valid YAML, so decoding it as YAML keeps
+// the timestamps integers.
+func printClaims(claims any) error {
+	if outputFormat != outputYAML {
+		return printResult(claims)
+	}
+	encoded, err := json.Marshal(claims)
+	if err != nil {
+		return err
+	}
+	var generic any
+	if err := yaml.Unmarshal(encoded, &generic); err != nil {
+		return err
+	}
+	return printResult(generic)
+}
+
+func describeOperator(w io.Writer, claims *jwt.OperatorClaims) error {
+	if err := describeSection(w, "Operator Details", append(describeClaimsData(claims.ClaimsData), [][]string{
+		{"System Account", orDash(claims.SystemAccount)},
+		{"Account Server URL", orDash(claims.AccountServerURL)},
+		{"Operator Service URLs", joinOrDash(claims.OperatorServiceURLs)},
+		{"Assert Server Version", orDash(claims.AssertServerVersion)},
+		{"Strict Signing Key Usage", strconv.FormatBool(claims.StrictSigningKeyUsage)},
+		{"Tags", joinOrDash(claims.Tags)},
+	}...)); err != nil {
+		return err
+	}
+	rows := [][]string{{"Signing Key"}}
+	for _, key := range claims.SigningKeys {
+		rows = append(rows, []string{key})
+	}
+	return describeTable(w, "Signing Keys", rows)
+}
+
+func describeAccount(w io.Writer, claims *jwt.AccountClaims) error {
+	if err := describeSection(w, "Account Details", append(describeClaimsData(claims.ClaimsData), [][]string{
+		{"Description", orDash(claims.Description)},
+		{"Info URL", orDash(claims.InfoURL)},
+		{"Tags", joinOrDash(claims.Tags)},
+	}...)); err != nil {
+		return err
+	}
+
+	limits := claims.Limits
+	if err := describeSection(w, "Limits", [][]string{
+		{"Max Connections", formatLimit(limits.Conn)},
+		{"Max Leaf Node Connections", formatLimit(limits.LeafNodeConn)},
+		{"Max Data", formatLimit(limits.Data)},
+		{"Max Msg Payload", formatLimit(limits.Payload)},
+		{"Max Subscriptions", formatLimit(limits.Subs)},
+		{"Max Imports", formatLimit(limits.Imports)},
+		{"Max Exports", formatLimit(limits.Exports)},
+		{"Wildcard Exports", strconv.FormatBool(limits.WildcardExports)},
+		{"Disallow Bearer Token", strconv.FormatBool(limits.DisallowBearer)},
+	}); err != nil {
+		return err
+	}
+
+	jetStream := [][]string{{"Tier", "Memory", "Disk", "Streams", "Consumers", "Max Ack Pending", "Memory Max Stream", "Disk Max Stream", "Max Bytes Required"}}
+	jetStream = append(jetStream, jetStreamRow("(global)", limits.JetStreamLimits))
+	for _, tier := range sortedKeys(limits.JetStreamTieredLimits) {
+		jetStream = append(jetStream, jetStreamRow(tier, limits.JetStreamTieredLimits[tier]))
+	}
+	if err := describeTable(w, "JetStream Limits", jetStream); err != nil {
+		return err
+	}
+
+	signingKeys := [][]string{{"Signing Key", "Role"}}
+	var scopes []*jwt.UserScope
+	for _, key := range sortedKeys(claims.SigningKeys) {
+		role := "(unscoped)"
+		if userScope, ok := claims.SigningKeys[key].(*jwt.UserScope); ok {
+			role = userScope.Role
+			scopes = append(scopes, userScope)
+		}
+		signingKeys = append(signingKeys, []string{key, role})
+	}
+	if err := describeTable(w, "Signing Keys", signingKeys); err != nil {
+		return err
+	}
+	for _, scope := range scopes {
+		if err := describeSection(w, fmt.Sprintf("Scoped Signing Key %s (role %s)", scope.Key, scope.Role), describePermissionLimits(scope.Template)); err != nil {
+			return err
+		}
+	}
+
+	if err := describeSection(w, "Default Permissions", describePermissions(claims.DefaultPermissions)); err != nil {
+		return err
+	}
+
+	imports := [][]string{{"Name", "Type", "Subject", "Local Subject", "Account", "Token", "Share"}}
+	for _, imp := range claims.Imports {
+		localSubject := string(imp.LocalSubject)
+		if localSubject == "" {
+			localSubject = string(imp.To)
+		}
+		imports = append(imports, []string{orDash(imp.Name), imp.Type.String(), string(imp.Subject), orDash(localSubject), imp.Account, strconv.FormatBool(imp.Token != ""), strconv.FormatBool(imp.Share)})
+	}
+	if err := describeTable(w, "Imports", imports); err != nil {
+		return err
+	}
+
+	exports := [][]string{{"Name", "Type", "Subject", "Response Type", "Token Required", "Advertise", "Latency", "Revocations", "Description"}}
+	for _, exp := range claims.Exports {
+		latency := "-"
+		if exp.Latency != nil {
+			latency = fmt.Sprintf("%d%% to %s", exp.Latency.Sampling, exp.Latency.Results)
+		}
+		responseType := "-"
+		if exp.IsService() {
+			responseType = string(exp.ResponseType)
+		}
+		exports = append(exports, []string{orDash(exp.Name), exp.Type.String(), string(exp.Subject), responseType, strconv.FormatBool(exp.TokenReq), strconv.FormatBool(exp.Advertise), latency, strconv.Itoa(len(exp.Revocations)), orDash(exp.Description)})
+	}
+	if err := describeTable(w, "Exports", exports); err != nil {
+		return err
+	}
+
+	revocations := [][]string{{"Public Key", "Revoked Before"}}
+	for _, key := range sortedKeys(claims.Revocations) {
+		revocations = append(revocations, []string{key, orDash(formatUnix(claims.Revocations[key], time.RFC3339))})
+	}
+	if err := describeTable(w, "Revocations", revocations); err != nil {
+		return err
+	}
+
+	mappings := [][]string{{"Subject", "To", "Weight", "Cluster"}}
+	for _, subject := range sortedKeys(claims.Mappings) {
+		for _, m := range claims.Mappings[subject] {
+			mappings = append(mappings, []string{string(subject), string(m.Subject), fmt.Sprintf("%d%%", m.GetWeight()), orDash(m.Cluster)})
+		}
+	}
+	if err := describeTable(w, "Mappings", mappings); err != nil {
+		return err
+	}
+
+	return describeSection(w, "External Authorization", [][]string{
+		{"Auth Users", joinOrDash(claims.Authorization.AuthUsers)},
+		{"Allowed Accounts", joinOrDash(claims.Authorization.AllowedAccounts)},
+		{"XKey", orDash(claims.Authorization.XKey)},
+	})
+}
+
+func describeUser(w io.Writer, claims *jwt.UserClaims) error {
+	if err := describeSection(w, "User Details", append(describeClaimsData(claims.ClaimsData), [][]string{
+		{"Issuer Account", orDash(claims.IssuerAccount)},
+		{"Tags", joinOrDash(claims.Tags)},
+	}...)); err != nil {
+		return err
+	}
+	// users issued by a scoped signing key get their permissions from the account; the JWT carries none.
+	return describeSection(w, "Permissions and Limits", describePermissionLimits(claims.UserPermissionLimits))
+}
+
+func describeClaimsData(claims jwt.ClaimsData) [][]string {
+	return [][]string{
+		{"Name", claims.Name},
+		{"Public Key", claims.Subject},
+		{"Issuer", claims.Issuer},
+		{"Issued At", orDash(formatUnix(claims.IssuedAt, time.RFC3339))},
+		{"Not Before", orDash(formatUnix(claims.NotBefore, time.RFC3339))},
+		{"Expires", orDash(formatUnix(claims.Expires, time.RFC3339))},
+		{"ID", claims.ID},
+	}
+}
+
+func describePermissions(permissions jwt.Permissions) [][]string {
+	response := "-"
+	if permissions.Resp != nil {
+		response = fmt.Sprintf("max %d msgs, ttl %s", permissions.Resp.MaxMsgs, permissions.Resp.Expires)
+	}
+	return [][]string{
+		{"Pub Allow", joinOrDash(permissions.Pub.Allow)},
+		{"Pub Deny", joinOrDash(permissions.Pub.Deny)},
+		{"Sub Allow", joinOrDash(permissions.Sub.Allow)},
+		{"Sub Deny", joinOrDash(permissions.Sub.Deny)},
+		{"Allow Reply", response},
+	}
+}
+
+func describePermissionLimits(limits jwt.UserPermissionLimits) [][]string {
+	var times []string
+	for _, t := range limits.Times {
+		times = append(times, t.Start+"-"+t.End)
+	}
+	return append(describePermissions(limits.Permissions), [][]string{
+		{"Max Data", formatLimit(limits.Data)},
+		{"Max Msg Payload", formatLimit(limits.Payload)},
+		{"Max Subscriptions", formatLimit(limits.Subs)},
+		{"Bearer Token", strconv.FormatBool(limits.BearerToken)},
+		{"Allowed Connection Types", joinOrDash(limits.AllowedConnectionTypes)},
+		{"Source Networks", joinOrDash(limits.Src)},
+		{"Times", joinOrDash(times)},
+		{"Times Location", orDash(limits.Locale)},
+	}...)
+}
+
+func jetStreamRow(tier string, limits jwt.JetStreamLimits) []string {
+	return []string{
+		tier,
+		formatLimit(limits.MemoryStorage),
+		formatLimit(limits.DiskStorage),
+		formatLimit(limits.Streams),
+		formatLimit(limits.Consumer),
+		formatLimit(limits.MaxAckPending),
+		formatLimit(limits.MemoryMaxStreamBytes),
+		formatLimit(limits.DiskMaxStreamBytes),
+		strconv.FormatBool(limits.MaxBytesRequired),
+	}
+}
+
+// describeSection renders key/value rows below a title.
+func describeSection(w io.Writer, title string, rows [][]string) error {
+	if _, err := fmt.Fprintf(w, "%s\n", title); err != nil {
+		return err
+	}
+	// the table ends with an empty line, which separates the sections.
+	t := pterm.TablePrinter{}.WithData(rows).WithWriter(w).WithSeparator(" | ")
+	return t.Render()
+}
+
+// describeTable renders rows with a header; if there is only the header, "none" is shown instead.
+func describeTable(w io.Writer, title string, rows [][]string) error {
+	if len(rows) <= 1 {
+		_, err := fmt.Fprintf(w, "%s: none\n\n", title)
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "%s\n", title); err != nil {
+		return err
+	}
+	t := pterm.TablePrinter{}.WithData(rows).WithWriter(w).WithSeparator(" | ").WithHeaderRowSeparator("-").WithHasHeader(true)
+	return t.Render()
+}
+
+// formatLimit shows jwt.NoLimit as "unlimited".
+func formatLimit(limit int64) string {
+	if limit == jwt.NoLimit {
+		return "unlimited"
+	}
+	return strconv.FormatInt(limit, 10)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func joinOrDash[S ~[]string](values S) string {
+	return orDash(strings.Join(values, ", "))
+}
+
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/pterm/pterm"
+	"github.com/sandstorm/natsCtl/cli/common"
+)
+
+// describeLines renders with the describe function, and returns the lines with collapsed whitespace.
+func describeLines(t *testing.T, describe func(w *bytes.Buffer) error) []string {
+	t.Helper()
+	pterm.DisableStyling()
+	t.Cleanup(pterm.EnableStyling)
+	var out bytes.Buffer
+	if err := describe(&out); err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		lines = append(lines, strings.Join(strings.Fields(line), " "))
+	}
+	return lines
+}
+
+func assertLine(t *testing.T, lines []string, expected string) {
+	t.Helper()
+	for _, line := range lines {
+		if line == expected {
+			return
+		}
+	}
+	t.Errorf("expected the line %q in:\n%s", expected, strings.Join(lines, "\n"))
+}
+
+func TestDescribeAccount(t *testing.T) {
+	accountKey, err := nkeys.CreateAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.NewAccountClaims(PublicKey(accountKey))
+	claims.Name = "APP"
+	claims.Limits.Conn = 10
+	scope := jwt.NewUserScope()
+	scope.Key = "ASCOPED"
+	scope.Role = "billing"
+	scope.Template.Pub.Allow.Add("billing.>")
+	claims.SigningKeys.AddScopedSigner(scope)
+	claims.SigningKeys.Add("AUNSCOPED")
+	claims.Exports.Add(&jwt.Export{Name: "orders", Subject: "orders.>", Type: jwt.Stream})
+
+	lines := describeLines(t, func(w *bytes.Buffer) error {
+		return describeAccount(w, claims)
+	})
+	assertLine(t, lines, "Name | APP")
+	assertLine(t, lines, "Public Key | "+PublicKey(accountKey))
+	assertLine(t, lines, "Max Connections | 10")
+	assertLine(t, lines, "Max Data | unlimited")
+	assertLine(t, lines, "ASCOPED | billing")
+	assertLine(t, lines, "AUNSCOPED | (unscoped)")
+	assertLine(t, lines, "Scoped Signing Key ASCOPED (role billing)")
+	assertLine(t, lines, "Pub Allow | billing.>")
+	assertLine(t, lines, "orders | stream | orders.> | - | false | false | - | 0 | -")
+	assertLine(t, lines, "Imports: none")
+	assertLine(t, lines, "Revocations: none")
+}
+
+func TestDescribeOperatorWithoutSigningKeys(t *testing.T) {
+	operatorKey, err := nkeys.CreateOperator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.NewOperatorClaims(PublicKey(operatorKey))
+	claims.Name = "OP"
+	claims.AccountServerURL = "nats://localhost:4222"
+
+	lines := describeLines(t, func(w *bytes.Buffer) error {
+		return describeOperator(w, claims)
+	})
+	assertLine(t, lines, "Name | OP")
+	assertLine(t, lines, "Account Server URL | nats://localhost:4222")
+	assertLine(t, lines, "System Account | -")
+	assertLine(t, lines, "Signing Keys: none")
+}
+
+func TestReadUserFile(t *testing.T) {
+	accountKey, err := nkeys.CreateAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	userKey, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.NewUserClaims(PublicKey(userKey))
+	claims.Name = "app"
+	userJwt, err := claims.Encode(accountKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, err := userKey.Seed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := jwt.FormatUserConfig(userJwt, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"app.creds": creds,
+		"app.jwt":   []byte(userJwt + "\n"),
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, contents, 0600); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := readUserFile(path)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if loaded.Name != "app" || loaded.Subject != PublicKey(userKey) {
+			t.Errorf("%s: unexpected claims %+v", name, loaded)
+		}
+	}
+
+	if _, err := readUserFile(filepath.Join(dir, "missing.creds")); !errors.Is(err, common.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pterm/pterm"
+	"github.com/sandstorm/natsCtl/cli/common"
+	"github.com/sandstorm/natsCtl/cli/config"
+	"github.com/sandstorm/natsCtl/cli/keystore"
+	"github.com/sandstorm/natsCtl/cli/transaction"
+	"github.com/spf13/cobra"
+)
+
+// dryRun is set via --dry-run; then, commands supporting it print the changes of the claims instead of signing
+// and writing the JWTs - and do not decrypt any key.
+var dryRun bool
+
+// dryRunAnnotation marks the commands supporting --dry-run; all others fail with --dry-run, so that nothing is
+// changed unexpectedly.
+const dryRunAnnotation = "supportsDryRun"
+
+func supportsDryRun(cmd *cobra.Command) {
+	if cmd.Annotations == nil {
+		cmd.Annotations = map[string]string{}
+	}
+	cmd.Annotations[dryRunAnnotation] = "true"
+}
+
+func checkDryRun(cmd *cobra.Command) error {
+	if dryRun && cmd.Annotations[dryRunAnnotation] != "true" {
+		return fmt.Errorf("%w: %s does not support --dry-run", common.ErrValidation, cmd.CommandPath())
+	}
+	return nil
+}
+
+// keyStoreFor returns the key store writing into the transaction; for --dry-run, new keys are only kept in memory.
+func keyStoreFor(cfg *config.Config, tx *transaction.Tx) keystore.KeyStore {
+	if dryRun {
+		return keystore.NewMemoryStore()
+	}
+	return cfg.KeyStoreIn(tx)
+}
+
+// ignoredClaims are set on every signature; so they are not part of the diff.
+var ignoredClaims = map[string]bool{"iat": true, "jti": true, "nats.type": true, "nats.version": true}
+
+// diffClaims compares the JSON representation of two claims field by field; before is nil for a new JWT.
+// Lists of objects with a "key" (f.e. scoped signing keys) are compared by key, other lists as sets.
+func diffClaims(before any, after any) ([]ClaimChange, error) {
+	b, err := claimsToJson(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := claimsToJson(after)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]ClaimChange, 0)
+	diffValues("", b, a, &changes)
+	return changes, nil
+}
+
+func claimsToJson(claims any) (map[string]any, error) {
+	result := map[string]any{}
+	if claims == nil || reflect.ValueOf(claims).IsNil() {
+		return result, nil
+	}
+	encoded, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&result); err != nil {
+		return nil, err
+	}
+	return normalizeNumbers(result).(map[string]any), nil
+}
+
+// normalizeNumbers converts the json.Numbers to int64 (or float64), so that they are printed as such.
+func normalizeNumbers(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for key, element := range v {
+			v[key] = normalizeNumbers(element)
+		}
+	case []any:
+		for i, element := range v {
+			v[i] = normalizeNumbers(element)
+		}
+	}
+	return value
+}
+
+func diffValues(path string, before any, after any, changes *[]ClaimChange) {
+	if ignoredClaims[path] || reflect.DeepEqual(before, after) {
+		return
+	}
+	beforeMap, beforeIsMap := before.(map[string]any)
+	afterMap, afterIsMap := after.(map[string]any)
+	beforeList, beforeIsList := before.([]any)
+	afterList, afterIsList := after.([]any)
+	switch {
+	case (beforeIsMap || before == nil) && (afterIsMap || after == nil):
+		keys := map[string]bool{}
+		for key := range beforeMap {
+			keys[key] = true
+		}
+		for key := range afterMap {
+			keys[key] = true
+		}
+		for _, key := range sortedKeys(keys) {
+			diffValues(joinPath(path, key), beforeMap[key], afterMap[key], changes)
+		}
+	case (beforeIsList || before == nil) && (afterIsList || after == nil):
+		diffLists(path, beforeList, afterList, changes)
+	default:
+		*changes = append(*changes, ClaimChange{Path: path, Before: before, After: after})
+	}
+}
+
+func diffLists(path string, before []any, after []any, changes *[]ClaimChange) {
+	beforeByKey, beforeKeyed := byKey(before)
+	afterByKey, afterKeyed := byKey(after)
+	if beforeKeyed && afterKeyed {
+		keys := map[string]bool{}
+		for key := range beforeByKey {
+			keys[key] = true
+		}
+		for key := range afterByKey {
+			keys[key] = true
+		}
+		for _, key := range sortedKeys(keys) {
+			elementPath := fmt.Sprintf("%s[%s]", path, key)
+			before, after := beforeByKey[key], afterByKey[key]
+			if before == nil || after == nil {
+				// added and removed elements are shown as a whole.
+				*changes = append(*changes, ClaimChange{Path: elementPath, Before: before, After: after})
+			} else {
+				diffValues(elementPath, before, after, changes)
+			}
+		}
+		return
+	}
+	for _, element := range before {
+		if !containsValue(after, element) {
+			*changes = append(*changes, ClaimChange{Path: path, Before: element})
+		}
+	}
+	for _, element := range after {
+		if !containsValue(before, element) {
+			*changes = append(*changes, ClaimChange{Path: path, After: element})
+		}
+	}
+}
+
+// byKey indexes a list of objects by their "key" field, f.e. the signing keys of an account: plain keys are
+// strings, scoped ones objects. ok is false if an element has no key, or if it is a plain list of strings.
+func byKey(list []any) (indexed map[string]any, ok bool) {
+	indexed = map[string]any{}
+	hasObject := false
+	for _, element := range list {
+		switch v := element.(type) {
+		case string:
+			indexed[v] = v
+		case map[string]any:
+			key, hasKey := v["key"].(string)
+			if !hasKey {
+				return nil, false
+			}
+			indexed[key] = v
+			hasObject = true
+		default:
+			return nil, false
+		}
+	}
+	return indexed, hasObject || len(list) == 0
+}
+
+func containsValue(list []any, value any) bool {
+	for _, element := range list {
+		if reflect.DeepEqual(element, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// printDryRun prints the changes of all JWTs the command would write; and the DryRunResult for --output json|yaml.
+// createdKeys is the number of keys which were generated (but not stored) for the dry run.
+func printDryRun(createdKeys int, jwts ...JwtDiff) error {
+	pterm.DefaultSection.Println("Dry run - no key was decrypted, and nothing was written")
+	for _, diff := range jwts {
+		action := "updated"
+		if diff.Created {
+			action = "created"
+		}
+		pterm.Printfln("%s %s (%s)", bold.Sprint(diff.Name), action, diff.File)
+		printChanges(diff.Changes)
+		pterm.Println()
+	}
+	if createdKeys > 0 {
+		pterm.Info.Printfln("%d new key(s) were generated for the dry run only; the real run generates other ones.", createdKeys)
+	}
+	return printResult(DryRunResult{Jwts: jwts})
+}
+
+func printChanges(changes []ClaimChange) {
+	if len(changes) == 0 {
+		pterm.Println("  no changes")
+		return
+	}
+	for _, change := range changes {
+		switch {
+		case change.Before == nil:
+			pterm.Println(pterm.FgGreen.Sprintf("  + %s: %s", change.Path, formatClaimValue(change.After)))
+		case change.After == nil:
+			pterm.Println(pterm.FgRed.Sprintf("  - %s: %s", change.Path, formatClaimValue(change.Before)))
+		default:
+			pterm.Println(pterm.FgYellow.Sprintf("  ~ %s: %s → %s", change.Path, formatClaimValue(change.Before), formatClaimValue(change.After)))
+		}
+	}
+}
+
+func formatClaimValue(value any) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	// subjects contain > and *; which would be escaped otherwise.
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Sprint(value)
+	}
+	return strings.TrimSpace(buf.String())
+}
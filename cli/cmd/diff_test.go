@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nats-io/jwt/v2"
+)
+
+// testAccount is the subject of the compared account claims.
+const testAccount = "ACZSWBJ4SYILK7QVDELO64VC7VPHXJCUTKNL3K2IHPBVC7DMVAC2D6QL"
+
+func newAccountClaims() *jwt.AccountClaims {
+	claims := jwt.NewAccountClaims(testAccount)
+	claims.Name = "APP"
+	claims.IssuedAt = 1700000000
+	claims.ID = "before"
+	return claims
+}
+
+// changesByPath indexes the changes; a path may appear twice for plain lists (removed and added element).
+func changesByPath(t *testing.T, before any, after any) map[string][]ClaimChange {
+	t.Helper()
+	changes, err := diffClaims(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byPath := map[string][]ClaimChange{}
+	for _, change := range changes {
+		byPath[change.Path] = append(byPath[change.Path], change)
+	}
+	return byPath
+}
+
+func TestDiffClaimsOfNewJwt(t *testing.T) {
+	var before *jwt.AccountClaims
+	changes := changesByPath(t, before, newAccountClaims())
+
+	if name := changes["name"]; len(name) != 1 || name[0].Before != nil || name[0].After != "APP" {
+		t.Errorf("expected the name to be added, got %+v", name)
+	}
+	// numbers are compared (and printed) as integers.
+	if conn := changes["nats.limits.conn"]; len(conn) != 1 || conn[0].After != int64(jwt.NoLimit) {
+		t.Errorf("expected the connection limit to be added as int64, got %+v", conn)
+	}
+	for ignored := range ignoredClaims {
+		if _, ok := changes[ignored]; ok {
+			t.Errorf("expected %s to be ignored", ignored)
+		}
+	}
+}
+
+func TestDiffClaimsWithoutChanges(t *testing.T) {
+	before := newAccountClaims()
+	after := newAccountClaims()
+	// set on every signature
+	after.IssuedAt = 1800000000
+	after.ID = "after"
+
+	if changes := changesByPath(t, before, after); len(changes) != 0 {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+}
+
+func TestDiffClaimsComparesPlainListsAsSets(t *testing.T) {
+	before := newAccountClaims()
+	before.Tags.Add("team-a", "prod")
+	after := newAccountClaims()
+	after.Tags.Add("prod", "team-b")
+
+	expected := []ClaimChange{
+		{Path: "nats.tags", Before: "team-a"},
+		{Path: "nats.tags", After: "team-b"},
+	}
+	if changes := changesByPath(t, before, after)["nats.tags"]; !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected %+v, got %+v", expected, changes)
+	}
+}
+
+func TestDiffClaimsComparesSigningKeysByKey(t *testing.T) {
+	before := newAccountClaims()
+	scope := jwt.NewUserScope()
+	scope.Key = "ASCOPED"
+	scope.Role = "billing"
+	before.SigningKeys.AddScopedSigner(scope)
+	before.SigningKeys.Add("AREMOVED")
+
+	after := newAccountClaims()
+	changedScope := jwt.NewUserScope()
+	changedScope.Key = "ASCOPED"
+	changedScope.Role = "billing"
+	changedScope.Template.Pub.Allow.Add("billing.>")
+	after.SigningKeys.AddScopedSigner(changedScope)
+	after.SigningKeys.Add("AADDED")
+
+	changes := changesByPath(t, before, after)
+	if added := changes["nats.signing_keys[ASCOPED].template.pub.allow"]; len(added) != 1 || added[0].After != "billing.>" {
+		t.Errorf("expected the subject to be added to the template, got %+v", added)
+	}
+	if removed := changes["nats.signing_keys[AREMOVED]"]; len(removed) != 1 || removed[0].Before != "AREMOVED" || removed[0].After != nil {
+		t.Errorf("expected the plain signing key to be removed, got %+v", removed)
+	}
+	if added := changes["nats.signing_keys[AADDED]"]; len(added) != 1 || added[0].After != "AADDED" {
+		t.Errorf("expected the plain signing key to be added, got %+v", added)
+	}
+	if _, ok := changes["nats.signing_keys[ASCOPED].role"]; ok {
+		t.Error("expected the unchanged role not to be reported")
+	}
+}
+
+func TestDiffListsOfPlainKeys(t *testing.T) {
+	// without any scoped signing key, the signing keys are a plain list of strings - compared as set.
+	var changes []ClaimChange
+	diffLists("nats.signing_keys", []any{"A1", "A2"}, []any{"A2", "A3"}, &changes)
+	expected := []ClaimChange{
+		{Path: "nats.signing_keys", Before: "A1"},
+		{Path: "nats.signing_keys", After: "A3"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected %+v, got %+v", expected, changes)
+	}
+}
+
+func TestFormatClaimValueKeepsSubjects(t *testing.T) {
+	if formatted := formatClaimValue([]any{"orders.>", "a.*"}); formatted != `["orders.>","a.*"]` {
+		t.Errorf("expected the subjects unescaped, got %s", formatted)
+	}
+}
@@ -3,11 +3,12 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/bitfield/script"
+	"github.com/nats-io/jwt/v2"
 	"github.com/pterm/pterm"
 	"github.com/sandstorm/natsCtl/cli/config"
 	"github.com/spf13/cobra"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -21,29 +22,43 @@ and usage of using your command. For example:
 Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			DocsFn("TODO")
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return DocsFn(&cfg, "TODO")
 		},
 	}
 }
 
-func DocsFn(operator OperatorName) {
-	setupNsc(operator)
-
-	_, err := script.NewPipe().
-		Apply(ExecAndStdout(`rm -Rf nsc/docs`)).
-		Apply(ExecAndStdout(`mkdir nsc/docs`)).
-		Stdout()
-	panicOnErr(err)
+// DocsFn writes docs/README.md (in the store root) with the roles of all accounts, and a docs/<account>.md per account.
+// Everything is rendered from the JWTs directly.
+func DocsFn(cfg *config.Config, operator OperatorName) error {
+	docsDir := cfg.StorePath("docs")
+	if err := os.RemoveAll(docsDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(docsDir, 0755); err != nil {
+		return err
+	}
 
+	operators, err := getOperators(cfg)
+	if err != nil {
+		return err
+	}
 	b := strings.Builder{}
-	for _, o := range getOperators() {
+	for _, o := range operators {
 		operator := OperatorName(o)
 
 		b.WriteString(fmt.Sprintf("# Account overview for %s\n\n", operator))
 
-		for _, a := range getAccounts(operator) {
+		accounts, err := getAccounts(cfg, operator)
+		if err != nil {
+			return err
+		}
+		for _, a := range accounts {
 			account := AccountName(a)
+			accountClaims, err := readAccount(cfg, operator, account)
+			if err != nil {
+				return err
+			}
 
 			b.WriteString(fmt.Sprintf("## %s\n\n", account))
 			b.WriteString(fmt.Sprintf("[Details](./%s.md)\n\n", account))
@@ -52,28 +67,37 @@ func DocsFn(operator OperatorName) {
 			data := pterm.TableData{
 				{"Role", "Permissions", "Key"},
 			}
-
-			lines, err := script.Exec(fmt.Sprintf(`nsc describe account --name "%s" -J`, account)).
-				JQ(`(.nats.signing_keys[] | if (type == "string") then ["", "", .] else [.role, (.template | tostring), .key] end)?`).
-				Slice()
-			panicOnErr(err)
-			for _, line := range lines {
-				var tblRow []string
-				panicOnErr(json.Unmarshal([]byte(line), &tblRow))
-				data = append(data, tblRow)
+			for _, key := range sortedKeys(accountClaims.SigningKeys) {
+				userScope, ok := accountClaims.SigningKeys[key].(*jwt.UserScope)
+				if !ok {
+					data = append(data, []string{"", "", key})
+					continue
+				}
+				template, err := json.Marshal(userScope.Template)
+				if err != nil {
+					return err
+				}
+				data = append(data, []string{userScope.Role, string(template), key})
 			}
 
 			t := pterm.TablePrinter{}.WithData(data).WithWriter(&b).WithSeparator(" | ").WithHeaderRowSeparator("-").WithHasHeader(true)
-			panicOnErr(t.Render())
+			if err := t.Render(); err != nil {
+				return err
+			}
 
 			b.WriteString("```\n\n")
 
-			_, err = script.Exec(fmt.Sprintf(`nsc describe account --name "%s"`, account)).
-				WriteFile(fmt.Sprintf(`nsc/docs/%s.md`, account))
-			panicOnErr(err)
+			details := strings.Builder{}
+			details.WriteString(fmt.Sprintf("# %s\n\n```\n", account))
+			if err := describeAccount(&details, accountClaims); err != nil {
+				return err
+			}
+			details.WriteString("```\n")
+			if err := os.WriteFile(filepath.Join(docsDir, string(account)+".md"), []byte(details.String()), 0644); err != nil {
+				return err
+			}
 		}
 	}
 
-	err = os.WriteFile(fmt.Sprintf("nsc/docs/README.md"), []byte(b.String()), 0644)
-	panicOnErr(err)
+	return os.WriteFile(filepath.Join(docsDir, "README.md"), []byte(b.String()), 0644)
 }
@@ -0,0 +1,298 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/pterm/pterm"
+	"github.com/sandstorm/natsCtl/cli/common"
+	"github.com/sandstorm/natsCtl/cli/config"
+	"github.com/sandstorm/natsCtl/cli/keystore"
+	"github.com/spf13/cobra"
+)
+
+const (
+	findingOk      = "ok"
+	findingWarning = "warning"
+	findingProblem = "problem"
+)
+
+// newDoctorCmd does not get the config passed, as it must also run (and report) if the config is broken.
+func newDoctorCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the environment and the store; exits non-zero if a problem is found",
+		Long: `Check the environment and the store, without unlocking the master key:
+
+- nsc and the password manager CLI are installed, and the Bitwarden vault is unlocked
+- a tmpfs is available for plaintext keys (see decrypt-nkey)
+- natsUtilsCfg.json is valid
+- no unencrypted .nk files are lying around
+- keys and .creds files are only readable by the owner
+- every JWT decodes, and its signature chain is valid (operator -> account -> signing key -> user)
+- every signing key referenced in a JWT has an encrypted .nk.age file
+
+Every problem comes with a hint how to fix it. The exit code is 7 if a problem was found; so it can run in CI.`,
+		Args: exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			d := &doctor{}
+
+			pterm.DefaultSection.Println("Environment")
+			d.checkBinaries()
+			d.checkScratchDir()
+			// main() continues with an empty config if it is broken; so we load it ourselves to report the error.
+			cfg, err := config.LoadConfig(flagOrEnv(root, config.RootEnvVar))
+			d.checkConfig(cfg, err)
+
+			pterm.DefaultSection.Println("Files")
+			d.checkFiles(cfg)
+
+			pterm.DefaultSection.Println("JWTs")
+			d.checkJwts(&cfg)
+
+			result := DoctorResult{
+				Findings: d.findings,
+				Problems: d.count(findingProblem),
+				Warnings: d.count(findingWarning),
+			}
+			if err := printResult(result); err != nil {
+				return err
+			}
+			if result.Problems > 0 {
+				return fmt.Errorf("%w: %d problem(s) found", common.ErrUnhealthy, result.Problems)
+			}
+			pterm.Success.Printfln("No problems found (%d warning(s)).", result.Warnings)
+			return nil
+		},
+	}
+}
+
+// doctor prints the findings immediately, and collects them for the result object.
+type doctor struct {
+	findings []DoctorFinding
+}
+
+func (d *doctor) ok(check string, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	pterm.Success.Println(message)
+	d.findings = append(d.findings, DoctorFinding{Check: check, Status: findingOk, Message: message})
+}
+
+func (d *doctor) warning(check string, fix string, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	pterm.Warning.Printfln("%s\n→ %s", message, fix)
+	d.findings = append(d.findings, DoctorFinding{Check: check, Status: findingWarning, Message: message, Fix: fix})
+}
+
+func (d *doctor) problem(check string, fix string, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	pterm.Error.Printfln("%s\n→ %s", message, fix)
+	d.findings = append(d.findings, DoctorFinding{Check: check, Status: findingProblem, Message: message, Fix: fix})
+}
+
+// checkBinaries only warns: push and pull sign in process; nsc is only needed by init-operator, and to run nsc
+// directly (f.e. via decrypt-nkey).
+func (d *doctor) checkBinaries() {
+	if path, err := exec.LookPath("nsc"); err != nil {
+		d.warning("binaries", "install nsc: https://github.com/nats-io/nsc", "nsc not found in $PATH; it is needed for init-operator, and to run nsc directly (f.e. via decrypt-nkey)")
+	} else {
+		d.ok("binaries", "nsc found: %s", path)
+	}
+}
+
+func (d *doctor) checkScratchDir() {
+	if dir, err := keystore.ScratchBase(); err != nil {
+		d.warning("scratch directory", fmt.Sprintf("set %s to a RAM disk; only needed for decrypt-nkey", keystore.ScratchDirEnvVar), "%s", err)
+	} else {
+		d.ok("scratch directory", "plaintext keys for decrypt-nkey are kept in %s", dir)
+	}
+}
+
+func (d *doctor) checkConfig(cfg config.Config, loadErr error) {
+	if loadErr != nil {
+		configFile, _ := config.FindConfigFile(flagOrEnv(root, config.RootEnvVar))
+		d.problem("config", fmt.Sprintf("fix %s, or run any command interactively in the repository to create it (see also --root)", configFile), "%s", loadErr)
+		return
+	}
+	d.ok("config", "%s is valid (master password type %s, store %s)", config.NatsUtilsConfigFile, cfg.MasterPassword.Type, cfg.StorePath())
+
+	problems := cfg.CheckBackend()
+	for _, p := range problems {
+		d.problem("master password", p.Fix, "%s", p.Problem)
+	}
+	if len(problems) == 0 {
+		d.ok("master password", "master password backend %s is ready", cfg.MasterPassword.Type)
+	}
+}
+
+// checkFiles finds unencrypted NKeys, and keys and .creds files readable by others.
+func (d *doctor) checkFiles(cfg config.Config) {
+	stray, loose := 0, 0
+	err := filepath.WalkDir(cfg.StorePath(), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		if strings.HasSuffix(path, ".nk") {
+			stray++
+			fix := fmt.Sprintf("rm %s - the encrypted %s.age is kept", path, path)
+			if _, err := os.Stat(path + ".age"); err != nil {
+				fix = fmt.Sprintf("there is no %s.age, so this might be the only copy of the key: back it up (outside the repository), then rm %s", path, path)
+			}
+			d.problem("unencrypted keys", fix, "unencrypted NKey %s", path)
+		}
+		if strings.HasSuffix(path, ".nk") || strings.HasSuffix(path, ".age") || strings.HasSuffix(path, ".creds") {
+			loose += d.checkPermissions(path)
+		}
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		d.warning("files", "run init-operator", "store %s does not exist", cfg.StorePath())
+		return
+	}
+	if err != nil {
+		d.problem("files", "check the permissions of the store", "scanning %s: %s", cfg.StorePath(), err)
+		return
+	}
+	if cfg.MasterPassword.KeyFilePath != "" {
+		loose += d.checkPermissions(cfg.MasterPassword.KeyFilePath)
+	}
+	if stray == 0 {
+		d.ok("unencrypted keys", "no unencrypted NKeys in %s", cfg.StorePath())
+	}
+	if loose == 0 {
+		d.ok("permissions", "keys and .creds files are only readable by their owner")
+	}
+}
+
+// checkPermissions returns 1 if the file is accessible by group or others.
+func (d *doctor) checkPermissions(path string) int {
+	info, err := os.Stat(path)
+	if err != nil {
+		// missing key files are reported by checkFiles or CheckBackend.
+		return 0
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		d.problem("permissions", fmt.Sprintf("chmod 600 %s", path), "%s is accessible by group or others (%s)", path, info.Mode().Perm())
+		return 1
+	}
+	return 0
+}
+
+// checkJwts decodes every JWT (which verifies its signature), validates the claims, and checks the chain
+// operator -> account -> user; and that every signing key has an encrypted NKey.
+func (d *doctor) checkJwts(cfg *config.Config) {
+	operators, err := getOperators(cfg)
+	if err != nil {
+		d.problem("jwt", "check the permissions of the store", "%s", err)
+		return
+	}
+	keys := keystore.NewAgeDirStore(cfg.KeysDir(), nil)
+	problemsBefore := d.count(findingProblem)
+	checked := 0
+	for _, o := range operators {
+		operator := OperatorName(o)
+		operatorClaims, err := readOperator(cfg, operator)
+		if err != nil {
+			d.problem("jwt", fmt.Sprintf("restore %s from git, or remove the directory of the operator", operatorJwtPath(cfg, operator)), "%s", err)
+			continue
+		}
+		checked++
+		d.validate(operatorJwtPath(cfg, operator), operatorClaims)
+		if operatorClaims.Issuer != operatorClaims.Subject && !operatorClaims.SigningKeys.Contains(operatorClaims.Issuer) {
+			d.problem("signature chain", "re-sign the operator JWT with the operator root key", "operator %s is signed by %s, which is neither the operator nor one of its signing keys", operator, operatorClaims.Issuer)
+		}
+		for _, key := range operatorClaims.SigningKeys {
+			d.checkSigningKey(keys, key, fmt.Sprintf("operator %s", operator))
+		}
+
+		accounts, err := getAccounts(cfg, operator)
+		if err != nil {
+			d.problem("jwt", "check the permissions of the store", "%s", err)
+			continue
+		}
+		for _, a := range accounts {
+			account := AccountName(a)
+			accountClaims, err := readAccount(cfg, operator, account)
+			if err != nil {
+				d.problem("jwt", fmt.Sprintf("restore %s from git, or pull it from the account server", accountJwtPath(cfg, operator, account)), "%s", err)
+				continue
+			}
+			checked++
+			d.validate(accountJwtPath(cfg, operator, account), accountClaims)
+			switch {
+			case accountClaims.Issuer == operatorClaims.Subject && operatorClaims.StrictSigningKeyUsage:
+				d.problem("signature chain", "re-sign the account JWT with an operator signing key (f.e. by running account for it)", "account %s is signed by the operator root key, but the operator requires signing keys", account)
+			case accountClaims.Issuer != operatorClaims.Subject && !operatorClaims.SigningKeys.Contains(accountClaims.Issuer):
+				d.problem("signature chain", "re-sign the account JWT with an operator signing key (f.e. by running account for it)", "account %s is signed by %s, which is neither operator %s nor one of its signing keys", account, accountClaims.Issuer, operator)
+			}
+			for _, key := range accountClaims.SigningKeys.Keys() {
+				d.checkSigningKey(keys, key, fmt.Sprintf("account %s", account))
+			}
+
+			users, err := listUsers(cfg, operator, account, accountClaims)
+			if err != nil {
+				d.problem("jwt", "fix or remove the user file", "%s", err)
+				continue
+			}
+			for _, user := range users {
+				userClaims, err := readUserFile(user.File)
+				if err != nil {
+					d.problem("jwt", "fix or remove the user file", "%s", err)
+					continue
+				}
+				checked++
+				d.validate(user.File, userClaims)
+				switch {
+				case userClaims.Issuer != accountClaims.Subject && !accountClaims.SigningKeys.Contains(userClaims.Issuer):
+					d.problem("signature chain", fmt.Sprintf("re-create the user (f.e. with user --account %s --user %s)", account, user.Name), "user %s (%s) is signed by %s, which is neither account %s nor one of its signing keys - it was probably removed", user.Name, user.File, userClaims.Issuer, account)
+				case userClaims.Issuer != accountClaims.Subject && userClaims.IssuerAccount != accountClaims.Subject:
+					d.problem("signature chain", fmt.Sprintf("re-create the user (f.e. with user --account %s --user %s)", account, user.Name), "user %s (%s) is signed by a signing key, but its issuer account is %q instead of %s", user.Name, user.File, userClaims.IssuerAccount, accountClaims.Subject)
+				}
+			}
+		}
+	}
+	if d.count(findingProblem) == problemsBefore {
+		d.ok("jwt", "%d JWTs decoded; all signatures, issuers and signing keys are valid", checked)
+	}
+}
+
+func (d *doctor) count(status string) int {
+	n := 0
+	for _, f := range d.findings {
+		if f.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+type validatable interface {
+	Validate(vr *jwt.ValidationResults)
+}
+
+func (d *doctor) validate(file string, claims validatable) {
+	vr := jwt.CreateValidationResults()
+	claims.Validate(vr)
+	for _, issue := range vr.Issues {
+		if issue.Blocking || issue.TimeCheck {
+			d.problem("jwt", fmt.Sprintf("fix the claims and re-sign %s", file), "%s: %s", file, issue.Description)
+		} else {
+			d.warning("jwt", fmt.Sprintf("fix the claims and re-sign %s", file), "%s: %s", file, issue.Description)
+		}
+	}
+}
+
+func (d *doctor) checkSigningKey(keys *keystore.AgeDirStore, key string, owner string) {
+	if _, err := os.Stat(keys.Path(key)); err != nil {
+		d.problem("signing keys", fmt.Sprintf("restore %s from git or a backup; otherwise, replace the signing key of %s", keys.Path(key), owner), "signing key %s of %s has no encrypted NKey", key, owner)
+	}
+}
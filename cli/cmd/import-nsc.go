@@ -0,0 +1,439 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/pterm/pterm"
+	"github.com/sandstorm/natsCtl/cli/common"
+	"github.com/sandstorm/natsCtl/cli/config"
+	"github.com/sandstorm/natsCtl/cli/keystore"
+	"github.com/sandstorm/natsCtl/cli/shamir"
+	"github.com/sandstorm/natsCtl/cli/transaction"
+	"github.com/spf13/cobra"
+)
+
+func newImportNscCmd(cfg config.Config) *cobra.Command {
+	var storeDirFlag, nkeysPathFlag, operatorFlag string
+	var deletePlaintext bool
+	cmd := &cobra.Command{
+		Use:   "import-nsc",
+		Short: "Import operators created with plain nsc, and encrypt their plaintext NKeys",
+		Long: `Import operators created with plain nsc into the store:
+
+1. the JWTs of every operator (or only --operator) are decoded, and their chain is verified
+   (operator -> account -> signing key -> user); nothing is imported if it is broken
+2. the JWTs and .creds files are copied into the store
+3. every seed of the operators, accounts and users is encrypted into the key store; the operator root key is
+   NOT stored (as for init-operator) - keep the nsc file in a safe place, or print it
+4. signing keys without a seed, and seeds which belong to no JWT of the nsc store, are reported
+5. all encrypted keys are decrypted again to verify them; afterwards, the plaintext .nk and .creds files of nsc
+   can be deleted (--delete-plaintext, or after confirmation) - except the operator root key`,
+		Args: exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			storeDir := flagOrEnv(storeDirFlag, "NSC_STORE_DIR")
+			nkeysPath := flagOrEnv(nkeysPathFlag, "NKEYS_PATH")
+			if storeDir == "" || nkeysPath == "" {
+				home, err := os.UserHomeDir()
+				if err != nil {
+					return fmt.Errorf("%w: specify --store-dir and --nkeys-path: %w", common.ErrValidation, err)
+				}
+				if storeDir == "" {
+					storeDir = filepath.Join(home, ".local", "share", "nats", "nsc", "stores")
+				}
+				if nkeysPath == "" {
+					nkeysPath = filepath.Join(home, ".local", "share", "nats", "nsc", "keys")
+				}
+			}
+
+			operator := flagOrEnv(operatorFlag, "OPERATOR_NAME")
+			operators := []string{operator}
+			if operator == "" {
+				if operators, err = listNscOperators(storeDir); err != nil {
+					return err
+				}
+			}
+			imports := make([]*nscOperator, 0, len(operators))
+			for _, operator := range operators {
+				if _, err := os.Stat(operatorJwtPath(&cfg, OperatorName(operator))); err == nil {
+					return fmt.Errorf("%w: operator %s already exists in %s", common.ErrValidation, operator, cfg.StorePath("store"))
+				}
+				imported, err := readNscOperator(storeDir, operator)
+				if err != nil {
+					return err
+				}
+				if err := imported.verifyChain(); err != nil {
+					return err
+				}
+				pterm.Success.Printfln("Verified the JWT chain of operator %s: %d account(s), %d user(s).", bold.Sprint(operator), len(imported.accounts), len(imported.users))
+				imports = append(imports, imported)
+			}
+
+			pterm.Info.Printfln(bold.Sprint("Specify your Master Password") + " for encrypting the NKeys.")
+			if err := unlock(&cfg); err != nil {
+				return err
+			}
+
+			// all JWTs, .creds files and encrypted keys are written together on commit.
+			tx := transaction.New()
+			defer tx.Rollback()
+			keyStore := cfg.KeyStoreIn(tx)
+			result := ImportNscResult{
+				Operators:          operators,
+				ImportedKeys:       []string{},
+				MissingSigningKeys: []string{},
+				UnmatchedKeys:      []string{},
+				RootKeyFiles:       []string{},
+				DeletedFiles:       []string{},
+			}
+			// plaintext are the nsc files which may be deleted after the import was verified.
+			var plaintext []string
+			referenced := map[string]bool{}
+			for _, imported := range imports {
+				files, err := imported.copyFiles(&cfg, tx, storeDir, nkeysPath)
+				if err != nil {
+					return err
+				}
+				plaintext = append(plaintext, files...)
+
+				for _, key := range imported.keys() {
+					if referenced[key.pubKey] {
+						continue
+					}
+					referenced[key.pubKey] = true
+					seedFile := keystore.KeyPath(filepath.Join(nkeysPath, "keys"), key.pubKey)
+					kp, err := readNscSeed(seedFile, key.pubKey)
+					switch {
+					case errors.Is(err, os.ErrNotExist):
+						if key.signingKey {
+							result.MissingSigningKeys = append(result.MissingSigningKeys, key.pubKey)
+							result.Warnings.Printfln("No seed for the %s %s; it cannot sign anymore, and should be replaced.", key.owner, key.pubKey)
+						}
+						continue
+					case err != nil:
+						return err
+					}
+					if key.root {
+						kp.Wipe()
+						result.RootKeyFiles = append(result.RootKeyFiles, seedFile)
+						result.Warnings.Printfln("The root key of operator %s is not stored; move %s to a safe place (it is not deleted).", imported.name, seedFile)
+						continue
+					}
+					err = keyStore.Put(kp)
+					kp.Wipe()
+					if err != nil {
+						return fmt.Errorf("storing the %s: %w", key.owner, err)
+					}
+					result.ImportedKeys = append(result.ImportedKeys, key.pubKey)
+					plaintext = append(plaintext, seedFile)
+				}
+			}
+			// the keys directory of nsc is shared by all operators; so with --operator, the seeds of the other
+			// operators are not unmatched.
+			referenceNscOperators(storeDir, referenced)
+			if result.UnmatchedKeys, err = unmatchedNscKeys(filepath.Join(nkeysPath, "keys"), referenced); err != nil {
+				return err
+			}
+			for _, key := range result.UnmatchedKeys {
+				result.Warnings.Printfln("The seed %s belongs to no JWT of the nsc store; it was not imported.", key)
+			}
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+			pterm.Success.Printfln("Imported %s, and encrypted %d NKeys.", strings.Join(operators, ", "), len(result.ImportedKeys))
+
+			// the encrypted keys are decrypted again, before the plaintext originals may be deleted.
+			for _, pubKey := range result.ImportedKeys {
+				kp, err := cfg.KeyStore().Get(pubKey)
+				if err != nil {
+					return fmt.Errorf("%w: verifying the encrypted key %s: %w", common.ErrDecryption, pubKey, err)
+				}
+				kp.Wipe()
+			}
+			pterm.Success.Printfln("Verified all encrypted NKeys.")
+
+			if !deletePlaintext && common.IsInteractive() {
+				if deletePlaintext, err = pterm.DefaultInteractiveConfirm.Show(fmt.Sprintf("Delete the %d plaintext .nk and .creds files of nsc", len(plaintext))); err != nil {
+					return err
+				}
+			}
+			if !deletePlaintext {
+				result.Warnings.Printfln("The plaintext .nk and .creds files in %s were kept; delete them with --delete-plaintext.", nkeysPath)
+				return printResult(result)
+			}
+			for _, file := range plaintext {
+				if err := os.Remove(file); err != nil {
+					result.Warnings.Printfln("Could not delete %s: %s", file, err)
+					continue
+				}
+				result.DeletedFiles = append(result.DeletedFiles, file)
+			}
+			pterm.Success.Printfln("Deleted %d plaintext files.", len(result.DeletedFiles))
+			return printResult(result)
+		},
+	}
+	cmd.Flags().StringVar(&storeDirFlag, "store-dir", "", "nsc store directory, containing one directory per operator; default: ~/.local/share/nats/nsc/stores (env: NSC_STORE_DIR)")
+	cmd.Flags().StringVar(&nkeysPathFlag, "nkeys-path", "", "nsc keys directory, containing keys/ and creds/; default: ~/.local/share/nats/nsc/keys (env: NKEYS_PATH)")
+	cmd.Flags().StringVar(&operatorFlag, "operator", "", "only import this operator; default: all operators of the nsc store (env: OPERATOR_NAME)")
+	cmd.Flags().BoolVar(&deletePlaintext, "delete-plaintext", false, "delete the plaintext .nk and .creds files of nsc after the import was verified (never the operator root key)")
+	return cmd
+}
+
+// nscOperator is an operator of a plain nsc store, with the decoded claims of its JWTs.
+type nscOperator struct {
+	name     string
+	dir      string
+	claims   *jwt.OperatorClaims
+	accounts map[string]*jwt.AccountClaims
+	// accountNames are the names of the accounts by public key; they are the directory names in the store.
+	accountNames map[string]string
+	users        []*jwt.UserClaims
+}
+
+// nscKey is a public key referenced by the JWTs of an operator.
+type nscKey struct {
+	pubKey     string
+	owner      string
+	root       bool
+	signingKey bool
+}
+
+func listNscOperators(storeDir string) ([]string, error) {
+	entries, err := os.ReadDir(storeDir)
+	if err != nil {
+		return nil, fmt.Errorf("%w: nsc store: %w", common.ErrNotFound, err)
+	}
+	var operators []string
+	for _, entry := range entries {
+		if _, err := os.Stat(filepath.Join(storeDir, entry.Name(), entry.Name()+".jwt")); entry.IsDir() && err == nil {
+			operators = append(operators, entry.Name())
+		}
+	}
+	if len(operators) == 0 {
+		return nil, fmt.Errorf("%w: no operator in the nsc store %s", common.ErrNotFound, storeDir)
+	}
+	return operators, nil
+}
+
+// readNscOperator decodes every JWT of the operator, which also verifies their signatures.
+func readNscOperator(storeDir string, operator string) (*nscOperator, error) {
+	imported := &nscOperator{
+		name:         operator,
+		dir:          filepath.Join(storeDir, operator),
+		accounts:     map[string]*jwt.AccountClaims{},
+		accountNames: map[string]string{},
+	}
+	operatorJwt, err := os.ReadFile(filepath.Join(imported.dir, operator+".jwt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: operator %s in the nsc store %s", common.ErrNotFound, operator, storeDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if imported.claims, err = jwt.DecodeOperatorClaims(strings.TrimSpace(string(operatorJwt))); err != nil {
+		return nil, fmt.Errorf("%w: decoding JWT of operator %s: %w", common.ErrValidation, operator, err)
+	}
+
+	accountDirs, err := filepath.Glob(filepath.Join(imported.dir, "accounts", "*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, accountDir := range accountDirs {
+		account := filepath.Base(accountDir)
+		accountJwt, err := os.ReadFile(filepath.Join(accountDir, account+".jwt"))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		accountClaims, err := jwt.DecodeAccountClaims(strings.TrimSpace(string(accountJwt)))
+		if err != nil {
+			return nil, fmt.Errorf("%w: decoding JWT of account %s: %w", common.ErrValidation, account, err)
+		}
+		imported.accounts[accountClaims.Subject] = accountClaims
+		imported.accountNames[accountClaims.Subject] = account
+
+		userFiles, err := filepath.Glob(filepath.Join(accountDir, "users", "*.jwt"))
+		if err != nil {
+			return nil, err
+		}
+		for _, userFile := range userFiles {
+			userJwt, err := os.ReadFile(userFile)
+			if err != nil {
+				return nil, err
+			}
+			userClaims, err := jwt.DecodeUserClaims(strings.TrimSpace(string(userJwt)))
+			if err != nil {
+				return nil, fmt.Errorf("%w: decoding JWT %s: %w", common.ErrValidation, userFile, err)
+			}
+			imported.users = append(imported.users, userClaims)
+		}
+	}
+	return imported, nil
+}
+
+// verifyChain checks operator -> account -> signing key -> user; the same as doctor does for the store.
+func (o *nscOperator) verifyChain() error {
+	var errs []error
+	if o.claims.Issuer != o.claims.Subject && !o.claims.SigningKeys.Contains(o.claims.Issuer) {
+		errs = append(errs, fmt.Errorf("operator %s is signed by %s, which is neither the operator nor one of its signing keys", o.name, o.claims.Issuer))
+	}
+	for _, pubKey := range sortedAccountKeys(o.accountNames) {
+		accountClaims := o.accounts[pubKey]
+		if accountClaims.Name != o.accountNames[pubKey] {
+			errs = append(errs, fmt.Errorf("the directory of account %s contains the JWT of account %s", o.accountNames[pubKey], accountClaims.Name))
+		}
+		if !o.claims.DidSign(accountClaims) {
+			errs = append(errs, fmt.Errorf("account %s is not signed by operator %s or one of its signing keys (issuer %s)", o.accountNames[pubKey], o.name, accountClaims.Issuer))
+		}
+	}
+	for _, userClaims := range o.users {
+		issuerAccount := userClaims.IssuerAccount
+		if issuerAccount == "" {
+			issuerAccount = userClaims.Issuer
+		}
+		accountClaims, ok := o.accounts[issuerAccount]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("user %s is signed by %s, which is no account of operator %s", userClaims.Name, userClaims.Issuer, o.name))
+		case !accountClaims.DidSign(userClaims):
+			errs = append(errs, fmt.Errorf("user %s is not signed by account %s or one of its signing keys (issuer %s)", userClaims.Name, o.accountNames[issuerAccount], userClaims.Issuer))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: JWT chain of operator %s is broken; nothing was imported: %w", common.ErrValidation, o.name, errors.Join(errs...))
+	}
+	return nil
+}
+
+// keys returns all public keys referenced by the JWTs; the root key first.
+func (o *nscOperator) keys() []nscKey {
+	keys := []nscKey{{pubKey: o.claims.Subject, owner: fmt.Sprintf("root key of operator %s", o.name), root: true}}
+	for _, key := range o.claims.SigningKeys {
+		keys = append(keys, nscKey{pubKey: key, owner: fmt.Sprintf("signing key of operator %s", o.name), signingKey: true})
+	}
+	for _, pubKey := range sortedAccountKeys(o.accountNames) {
+		accountClaims := o.accounts[pubKey]
+		keys = append(keys, nscKey{pubKey: pubKey, owner: fmt.Sprintf("key of account %s", o.accountNames[pubKey])})
+		for _, key := range accountClaims.SigningKeys.Keys() {
+			keys = append(keys, nscKey{pubKey: key, owner: fmt.Sprintf("signing key of account %s", o.accountNames[pubKey]), signingKey: true})
+		}
+	}
+	for _, userClaims := range o.users {
+		keys = append(keys, nscKey{pubKey: userClaims.Subject, owner: fmt.Sprintf("key of user %s", userClaims.Name)})
+	}
+	return keys
+}
+
+func sortedAccountKeys(accountNames map[string]string) []string {
+	keys := make([]string, 0, len(accountNames))
+	for key := range accountNames {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return accountNames[keys[i]] < accountNames[keys[j]]
+	})
+	return keys
+}
+
+// copyFiles stages the JWTs (and the other files of the operator directory) and the .creds files; it returns the
+// copied .creds files of nsc, which contain plaintext seeds.
+func (o *nscOperator) copyFiles(cfg *config.Config, tx *transaction.Tx, storeDir string, nkeysPath string) ([]string, error) {
+	var credsFiles []string
+	copyTree := func(src string, dst string, isCreds bool) error {
+		return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+			if errors.Is(err, os.ErrNotExist) && path == src {
+				return nil
+			}
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(src, path)
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			perm := os.FileMode(0644)
+			if isCreds {
+				perm = 0600
+				credsFiles = append(credsFiles, path)
+			}
+			return tx.WriteFile(filepath.Join(dst, rel), data, perm)
+		})
+	}
+	if err := copyTree(o.dir, cfg.StorePath("store", o.name), false); err != nil {
+		return nil, fmt.Errorf("copying the nsc store of operator %s: %w", o.name, err)
+	}
+	if err := copyTree(filepath.Join(nkeysPath, "creds", o.name), cfg.StorePath("nkeys", "creds", o.name), true); err != nil {
+		return nil, fmt.Errorf("copying the .creds files of operator %s: %w", o.name, err)
+	}
+	return credsFiles, nil
+}
+
+// readNscSeed reads a plaintext seed of nsc; it must match the public key of its file name.
+func readNscSeed(seedFile string, pubKey string) (nkeys.KeyPair, error) {
+	seed, err := os.ReadFile(seedFile)
+	if err != nil {
+		return nil, err
+	}
+	defer shamir.Wipe(seed)
+	// bytes.TrimSpace returns a sub-slice; so no unwiped copy of the seed is left behind.
+	kp, err := nkeys.FromSeed(bytes.TrimSpace(seed))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", common.ErrValidation, seedFile, err)
+	}
+	if PublicKey(kp) != pubKey {
+		kp.Wipe()
+		return nil, fmt.Errorf("%w: %s does not contain the seed of %s", common.ErrValidation, seedFile, pubKey)
+	}
+	return kp, nil
+}
+
+// referenceNscOperators adds the keys of all operators of the nsc store to referenced. Operators which cannot be
+// read are skipped; they are reported when they are imported.
+func referenceNscOperators(storeDir string, referenced map[string]bool) {
+	operators, err := listNscOperators(storeDir)
+	if err != nil {
+		return
+	}
+	for _, operator := range operators {
+		other, err := readNscOperator(storeDir, operator)
+		if err != nil {
+			continue
+		}
+		for _, key := range other.keys() {
+			referenced[key.pubKey] = true
+		}
+	}
+}
+
+// unmatchedNscKeys returns the public keys of all seeds in the nsc keys directory which are not referenced.
+func unmatchedNscKeys(keysDir string, referenced map[string]bool) ([]string, error) {
+	unmatched := []string{}
+	err := filepath.WalkDir(keysDir, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) && path == keysDir {
+			return nil
+		}
+		if err != nil || entry.IsDir() || !strings.HasSuffix(path, ".nk") {
+			return err
+		}
+		if pubKey := strings.TrimSuffix(entry.Name(), ".nk"); !referenced[pubKey] {
+			unmatched = append(unmatched, pubKey)
+		}
+		return nil
+	})
+	return unmatched, err
+}
@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/sandstorm/natsCtl/cli/common"
+	"github.com/sandstorm/natsCtl/cli/keystore"
+)
+
+// nscStore is a plain nsc store in a temp dir: stores/<operator>/... for the JWTs, and keys/ for the seeds.
+type nscStore struct {
+	t         *testing.T
+	storeDir  string
+	nkeysPath string
+}
+
+func newNscStore(t *testing.T) *nscStore {
+	dir := t.TempDir()
+	return &nscStore{t: t, storeDir: filepath.Join(dir, "stores"), nkeysPath: filepath.Join(dir, "nkeys")}
+}
+
+func (s *nscStore) createKey(create func() (nkeys.KeyPair, error)) nkeys.KeyPair {
+	s.t.Helper()
+	key, err := create()
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return key
+}
+
+// writeSeed writes the seed as nsc does, with a trailing newline.
+func (s *nscStore) writeSeed(key nkeys.KeyPair) string {
+	s.t.Helper()
+	seed, err := key.Seed()
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	seedFile := keystore.KeyPath(filepath.Join(s.nkeysPath, "keys"), PublicKey(key))
+	if err := os.MkdirAll(filepath.Dir(seedFile), 0700); err != nil {
+		s.t.Fatal(err)
+	}
+	if err := os.WriteFile(seedFile, append(seed, '\n'), 0600); err != nil {
+		s.t.Fatal(err)
+	}
+	return seedFile
+}
+
+func (s *nscStore) writeJwt(path string, claims jwt.Claims, signer nkeys.KeyPair) {
+	s.t.Helper()
+	token, err := claims.Encode(signer)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		s.t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(token), 0644); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// addOperator creates an operator with a signing key, an account APP with a signing key, and a user signed by
+// it; all seeds are written to the keys directory. It returns the keys in the order of nscOperator.keys().
+func (s *nscStore) addOperator(name string) []nkeys.KeyPair {
+	s.t.Helper()
+	operatorKey := s.createKey(nkeys.CreateOperator)
+	operatorSk := s.createKey(nkeys.CreateOperator)
+	accountKey := s.createKey(nkeys.CreateAccount)
+	accountSk := s.createKey(nkeys.CreateAccount)
+	userKey := s.createKey(nkeys.CreateUser)
+
+	operatorClaims := jwt.NewOperatorClaims(PublicKey(operatorKey))
+	operatorClaims.Name = name
+	operatorClaims.SigningKeys.Add(PublicKey(operatorSk))
+	s.writeJwt(filepath.Join(s.storeDir, name, name+".jwt"), operatorClaims, operatorKey)
+
+	accountClaims := jwt.NewAccountClaims(PublicKey(accountKey))
+	accountClaims.Name = "APP"
+	accountClaims.SigningKeys.Add(PublicKey(accountSk))
+	s.writeJwt(filepath.Join(s.storeDir, name, "accounts", "APP", "APP.jwt"), accountClaims, operatorSk)
+
+	userClaims := jwt.NewUserClaims(PublicKey(userKey))
+	userClaims.Name = "app"
+	userClaims.IssuerAccount = PublicKey(accountKey)
+	s.writeJwt(filepath.Join(s.storeDir, name, "accounts", "APP", "users", "app.jwt"), userClaims, accountSk)
+
+	keys := []nkeys.KeyPair{operatorKey, operatorSk, accountKey, accountSk, userKey}
+	for _, key := range keys {
+		s.writeSeed(key)
+	}
+	return keys
+}
+
+func (s *nscStore) read(name string) *nscOperator {
+	s.t.Helper()
+	operator, err := readNscOperator(s.storeDir, name)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return operator
+}
+
+func TestReadNscOperator(t *testing.T) {
+	store := newNscStore(t)
+	keys := store.addOperator("OP")
+
+	operator := store.read("OP")
+	if err := operator.verifyChain(); err != nil {
+		t.Fatal(err)
+	}
+	var expected, actual []string
+	for _, key := range keys {
+		expected = append(expected, PublicKey(key))
+	}
+	for _, key := range operator.keys() {
+		actual = append(actual, key.pubKey)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected the keys %v, got %v", expected, actual)
+	}
+	if !operator.keys()[0].root || !operator.keys()[1].signingKey || !operator.keys()[3].signingKey {
+		t.Errorf("expected the root key first, and the signing keys to be marked: %+v", operator.keys())
+	}
+}
+
+func TestVerifyChainRejectsForeignSignatures(t *testing.T) {
+	store := newNscStore(t)
+	store.addOperator("OP")
+	foreignKey := store.createKey(nkeys.CreateOperator)
+
+	// an account signed by a key which is not one of the operator
+	accountClaims := jwt.NewAccountClaims(PublicKey(store.createKey(nkeys.CreateAccount)))
+	accountClaims.Name = "FOREIGN"
+	store.writeJwt(filepath.Join(store.storeDir, "OP", "accounts", "FOREIGN", "FOREIGN.jwt"), accountClaims, foreignKey)
+
+	err := store.read("OP").verifyChain()
+	if !errors.Is(err, common.ErrValidation) || !strings.Contains(err.Error(), "account FOREIGN is not signed by operator OP") {
+		t.Errorf("expected the foreign account to be reported, got %v", err)
+	}
+}
+
+func TestVerifyChainRejectsRenamedAccountDirectories(t *testing.T) {
+	store := newNscStore(t)
+	store.addOperator("OP")
+	if err := os.Rename(filepath.Join(store.storeDir, "OP", "accounts", "APP", "APP.jwt"), filepath.Join(store.storeDir, "OP", "accounts", "APP", "OTHER.jwt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(store.storeDir, "OP", "accounts", "APP"), filepath.Join(store.storeDir, "OP", "accounts", "OTHER")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.read("OP").verifyChain(); err == nil || !strings.Contains(err.Error(), "the directory of account OTHER contains the JWT of account APP") {
+		t.Errorf("expected the renamed directory to be reported, got %v", err)
+	}
+}
+
+func TestVerifyChainRejectsUsersOfOtherAccounts(t *testing.T) {
+	store := newNscStore(t)
+	store.addOperator("OP")
+	otherAccount := store.createKey(nkeys.CreateAccount)
+	userClaims := jwt.NewUserClaims(PublicKey(store.createKey(nkeys.CreateUser)))
+	userClaims.Name = "stray"
+	store.writeJwt(filepath.Join(store.storeDir, "OP", "accounts", "APP", "users", "stray.jwt"), userClaims, otherAccount)
+
+	if err := store.read("OP").verifyChain(); err == nil || !strings.Contains(err.Error(), "user stray is signed by") {
+		t.Errorf("expected the user of another account to be reported, got %v", err)
+	}
+}
+
+func TestReadNscSeed(t *testing.T) {
+	store := newNscStore(t)
+	key := store.createKey(nkeys.CreateAccount)
+	seedFile := store.writeSeed(key)
+
+	loaded, err := readNscSeed(seedFile, PublicKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.Wipe()
+	if PublicKey(loaded) != PublicKey(key) {
+		t.Errorf("expected %s, got %s", PublicKey(key), PublicKey(loaded))
+	}
+
+	other := store.createKey(nkeys.CreateAccount)
+	if _, err := readNscSeed(seedFile, PublicKey(other)); !errors.Is(err, common.ErrValidation) {
+		t.Errorf("expected a validation error for a seed in the file of another key, got %v", err)
+	}
+}
+
+func TestUnmatchedNscKeys(t *testing.T) {
+	store := newNscStore(t)
+	store.addOperator("OP")
+	otherKeys := store.addOperator("OTHER")
+	stray := store.createKey(nkeys.CreateUser)
+	store.writeSeed(stray)
+
+	// import-nsc --operator OP: only the keys of OP were imported.
+	referenced := map[string]bool{}
+	for _, key := range store.read("OP").keys() {
+		referenced[key.pubKey] = true
+	}
+	keysDir := filepath.Join(store.nkeysPath, "keys")
+	unmatched, err := unmatchedNscKeys(keysDir, referenced)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unmatched) != len(otherKeys)+1 {
+		t.Fatalf("expected the keys of OTHER and the stray key without the other operators, got %v", unmatched)
+	}
+
+	referenceNscOperators(store.storeDir, referenced)
+	unmatched, err = unmatchedNscKeys(keysDir, referenced)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(unmatched)
+	if !reflect.DeepEqual(unmatched, []string{PublicKey(stray)}) {
+		t.Errorf("expected only the stray key %s, got %v", PublicKey(stray), unmatched)
+	}
+}
+
+func TestUnmatchedNscKeysWithoutKeysDirectory(t *testing.T) {
+	unmatched, err := unmatchedNscKeys(filepath.Join(t.TempDir(), "missing"), map[string]bool{})
+	if err != nil || len(unmatched) != 0 {
+		t.Errorf("expected no unmatched keys, got %v (%v)", unmatched, err)
+	}
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/nats-io/jwt/v2"
 	"github.com/nats-io/nkeys"
@@ -9,15 +10,19 @@ import (
 	"github.com/pterm/pterm"
 	"github.com/sandstorm/natsCtl/cli/common"
 	"github.com/sandstorm/natsCtl/cli/config"
+	"github.com/sandstorm/natsCtl/cli/transaction"
 	"github.com/spf13/cobra"
-	"os"
 	"regexp"
 	"strings"
 )
 
+var natsServerUrlRegexp = regexp.MustCompile(`^(tls|nats)://`)
+
 //nolint:funlen
 func newInitOperatorCmd(cfg config.Config) *cobra.Command {
-	return &cobra.Command{
+	var operatorFlag, natsServerUrlFlag, accountServerUrlFlag string
+	var backupFlags rootKeyBackupFlags
+	cmd := &cobra.Command{
 		Use:   "init-operator",
 		Short: "Sets up a new NATS operator.",
 		Long: `A NATS "operator" is the root configuration element for a NATS cluster.
@@ -26,11 +31,15 @@ Only needed once per NATS cluster.
 
 When you run this command, 
 `,
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			var err error
-			operator := OperatorName(os.Getenv("OPERATOR_NAME"))
-			natsServerUrl := os.Getenv("NATS_SERVER_URL")
-			accountServerUrl := os.Getenv("ACCOUNT_SERVER_URL")
+			operator := OperatorName(flagOrEnv(operatorFlag, "OPERATOR_NAME"))
+			natsServerUrl := flagOrEnv(natsServerUrlFlag, "NATS_SERVER_URL")
+			accountServerUrl := flagOrEnv(accountServerUrlFlag, "ACCOUNT_SERVER_URL")
+			backup, err := backupFlags.parse()
+			if err != nil {
+				return err
+			}
 
 			//////////////////////////////////////////
 			pterm.DefaultSection.Println("1) Current NATS keys")
@@ -47,25 +56,39 @@ When you run this command,
 			pterm.DefaultSection.Printfln("2) Operator Creation and configuration")
 
 			if operator == "" {
+				if err := common.RequireInteractive("OPERATOR_NAME", "operator", "OPERATOR_NAME"); err != nil {
+					return err
+				}
 				pterm.Println("Operator name - our convention is ROOT_...., so f.e. ROOT_natsv1 or ROOT_local:")
-				operator = OperatorName(common.RequiredTextInput("OPERATOR_NAME"))
+				input, err := common.RequiredTextInput("OPERATOR_NAME")
+				if err != nil {
+					return err
+				}
+				operator = OperatorName(input)
 			}
 
 			// the service URL is the default server URL for connecting
 			if natsServerUrl == "" {
+				if err := common.RequireInteractive("NATS_SERVER_URL", "nats-server-url", "NATS_SERVER_URL"); err != nil {
+					return err
+				}
 				pterm.Println("Specify NATS service URL where this operator will be used:")
-				pterm.Println("(required for nsc push and nsc pull). Examples: tls://your.domain:4222")
-				natsServerUrl = common.TextInputMatchingRegex("NATS_SERVER_URL", regexp.MustCompile(`^(tls|nats)://`))
+				pterm.Println("(required for push and pull). Examples: tls://your.domain:4222")
+				if natsServerUrl, err = common.TextInputMatchingRegex("NATS_SERVER_URL", natsServerUrlRegexp); err != nil {
+					return err
+				}
+			} else if !natsServerUrlRegexp.MatchString(natsServerUrl) {
+				return fmt.Errorf("%w: NATS_SERVER_URL %s must start with tls:// or nats://", common.ErrValidation, natsServerUrl)
 			}
 
-			// the service URL is required for "nsc push" and "nsc pull" to work properly.
+			// the service URL is required for push and pull to work properly.
 			if accountServerUrl == "" {
 				accountServerUrl = strings.ReplaceAll(natsServerUrl, "tls://", "nats://")
 				pterm.Println("NATS account server URL where this operator will be used is derived from NATS_SERVER_URL")
-				pterm.Println("(required for nsc push and nsc pull).")
+				pterm.Println("(required for push and pull).")
 				pterm.Println("NOTE: This must be specified with the nats:// protocol to work, without encryption - so tls:// protocol does NOT work here.")
 				pterm.Println("The server needs tls.allowNonTLS: true to work with this.")
-				pterm.Printfln("    ACCOUNT_SERVER_URL=", accountServerUrl)
+				pterm.Printfln("    ACCOUNT_SERVER_URL=%s", accountServerUrl)
 				// TODO: seems that NSC push do not work over TLS for whatever reason :(
 			}
 
@@ -73,89 +96,139 @@ When you run this command,
 			pterm.Info.Printfln("- with signing key")
 			pterm.Info.Printfln("- with system account")
 
-			pterm.Info.Printfln("We use a single AGE key to protect all NATS NKEYS except the Root Key")
-			pterm.Info.Printfln("This AGE key can be protected via a master key.")
-			cfg.MasterPasswordDecryptor().Unlock()
+			if !dryRun {
+				pterm.Info.Printfln("We use a single AGE key to protect all NATS NKEYS except the Root Key")
+				pterm.Info.Printfln("This AGE key can be protected via a master key.")
+				if err := unlock(&cfg); err != nil {
+					return err
+				}
+			}
+
+			// all keys, JWTs and the NATS config are written together on commit.
+			tx := transaction.New()
+			defer tx.Rollback()
+			keyStore := keyStoreFor(&cfg, tx)
 
 			operatorRootNkey, err := nkeys.CreateOperator()
-			panicOnErr(err)
+			if err != nil {
+				return err
+			}
 			// we do NOT store the root key, but only print it.
 
 			// to quote the docs: "it is good hygiene to create operators with signing keys."
 			operatorSigningNkey, err := nkeys.CreateOperator()
-			panicOnErr(err)
-			storeAndEncryptNkey(operatorSigningNkey, cfg.MasterPasswordDecryptor())
+			if err != nil {
+				return err
+			}
+			if err := keyStore.Put(operatorSigningNkey); err != nil {
+				return fmt.Errorf("storing operator signing key: %w", err)
+			}
 
 			// we need a system account (--sys) to be able to push/pull accounts then.
 			// we do not need a SYS user for pushing/pulling, because it is auto-created anyway on-demand from the SYS Signing Key when pushing.
-			systemAccountNKey, systemAccountSigningNKey, sysClaims := createSystemAccount()
-			storeAndEncryptNkey(systemAccountNKey, cfg.MasterPasswordDecryptor())
-			storeAndEncryptNkey(systemAccountSigningNKey, cfg.MasterPasswordDecryptor())
-			sysClaims.Issuer = publicKey(systemAccountSigningNKey)
+			systemAccountNKey, systemAccountSigningNKey, sysClaims, err := createSystemAccount()
+			if err != nil {
+				return err
+			}
+			if err := keyStore.Put(systemAccountNKey); err != nil {
+				return fmt.Errorf("storing system account key: %w", err)
+			}
+			if err := keyStore.Put(systemAccountSigningNKey); err != nil {
+				return fmt.Errorf("storing system account signing key: %w", err)
+			}
+			sysClaims.Issuer = PublicKey(systemAccountSigningNKey)
 
-			operatorClaims := jwt.NewOperatorClaims(publicKey(operatorRootNkey))
-			operatorClaims.Issuer = publicKey(operatorSigningNkey)
+			operatorClaims := jwt.NewOperatorClaims(PublicKey(operatorRootNkey))
+			operatorClaims.Issuer = PublicKey(operatorSigningNkey)
 			// we want to require signing keys to create accounts (ensures that nobody
 			// accidentally uses the root key during normal operations)
 			// https://github.com/nats-io/nats-server/blame/d90854a45fe9405198093ab1489f8b3e5e11dcf8/server/jwt.go#L134
 			operatorClaims.StrictSigningKeyUsage = true
 			operatorClaims.Name = string(operator)
-			operatorClaims.SystemAccount = publicKey(systemAccountNKey)
+			operatorClaims.SystemAccount = PublicKey(systemAccountNKey)
 			operatorClaims.AccountServerURL = accountServerUrl
 			// this way, we do not need to specify the server URLs when connecting.
 			operatorClaims.OperatorServiceURLs = strings.Split(natsServerUrl, ",")
-			operatorClaims.SigningKeys.Add(publicKey(operatorSigningNkey))
-			operatorJwt := writeOperator(operator, operatorClaims, operatorSigningNkey)
-			sysAccountJwt := writeAccount(operator, sysClaims, operatorSigningNkey)
+			operatorClaims.SigningKeys.Add(PublicKey(operatorSigningNkey))
+			if dryRun {
+				// on signing, the issuer is set to the signing key.
+				sysClaims.Issuer = operatorClaims.Issuer
+				return printInitOperatorDryRun(&cfg, operator, operatorClaims, sysClaims)
+			}
+			operatorJwt, err := writeOperator(&cfg, tx, operator, operatorClaims, operatorSigningNkey)
+			if err != nil {
+				return err
+			}
+			sysAccountJwt, err := writeAccount(&cfg, tx, operator, sysClaims, operatorSigningNkey)
+			if err != nil {
+				return err
+			}
 
 			//////////////////////////////////////////
 			pterm.DefaultSection.Println("3) Removing operator Root Keys")
 
-			pterm.Printfln(`
-    The public root key is: %s
-    Please store the private root key safely. THE FOLLOWING PRINTOUT IS
-    THE ONLY COPY; the file is removed directly after the printout.
-    Please also store the instructions along with the key.
-
-    -----------------------------------------------
-    This is the root key of the NATS operator %s.
-    This key is only needed in case the signing key of the operator was compromised or lost,
-    and in this case we do *not* need to re-create the NATS cluster (but can issue a new signing key,
-    and need to create then new accounts + users).
-    To restore it, place it inside the file %s.
-
-    PRIVATE ROOT KEY:
-
-        %s
-
-    -----------------------------------------------
-`, bold.Sprint(publicKey(operatorRootNkey)), operator, keyPath(publicKey(operatorRootNkey)), seed(operatorRootNkey))
+			rootKeySheets, err := backup.handOut(tx, operator, operatorRootNkey)
+			if err != nil {
+				return err
+			}
 
 			//////////////////////////////////////////
 			pterm.DefaultSection.Println("4) Encrypting signing key via AGE and bitwarden CLI")
 
-			pterm.Info.Printfln("Operator Signing Key: %s located in %s", publicKey(operatorSigningNkey), keyPath(publicKey(operatorSigningNkey)))
+			pterm.Info.Printfln("Operator Signing Key: %s stored in the key store", PublicKey(operatorSigningNkey))
 
 			// TODO: why do we do this, instead of storing each NKEY in bitwarden? We could also do this, but it feels somehow wrong.
-			// TODO: age-yubikey maybe would be a good argument. TODO maybe ramdisk?
+			// NOTE: hardware backed master keys are supported via AGE plugin identities (f.e. age-plugin-yubikey).
 			pterm.Success.Printfln("Encrypted %s Signing Key.", operator)
 			//////////////////////////////////////////
 			pterm.DefaultSection.Println("5) Generate Bootstrap NATS config")
 
-			configBuilder := nsccmd.NewNatsResolverConfigBuilder(false)
-			_ = configBuilder.SetSystemAccount(publicKey(systemAccountNKey))
-			_ = configBuilder.Add([]byte(operatorJwt))
-			_ = configBuilder.Add([]byte(sysAccountJwt))
-
-			generatedConfig, err := configBuilder.Generate()
-			panicOnErr(err)
-			_ = os.WriteFile(fmt.Sprintf("nsc/config-%s.cfg", operator), generatedConfig, 0644)
-
-			pterm.Success.Printfln("Generated NATS config %s. Now, continue with configuring your NATS system.", bold.Sprintf("nsc/config-%s.cfg", operator))
+			natsConfigFile, err := writeNatsConfig(&cfg, tx, operator, operatorJwt, PublicKey(systemAccountNKey), sysAccountJwt)
+			if err != nil {
+				return err
+			}
+			if err := tx.Commit(); err != nil {
+				return err
+			}
 
-			//DocsFn(operator)
+			backup.printSheetsHint()
+			pterm.Success.Printfln("Generated NATS config %s. Now, continue with configuring your NATS system.", bold.Sprint(natsConfigFile))
+
+			//DocsFn(cfg, operator)
+			return printResult(InitOperatorResult{
+				Operator:                string(operator),
+				OperatorPublicKey:       PublicKey(operatorRootNkey),
+				OperatorSigningKey:      PublicKey(operatorSigningNkey),
+				SystemAccountPublicKey:  PublicKey(systemAccountNKey),
+				SystemAccountSigningKey: PublicKey(systemAccountSigningNKey),
+				OperatorJwtFile:         operatorJwtPath(&cfg, operator),
+				SystemAccountJwtFile:    accountJwtPath(&cfg, operator, AccountName(sysClaims.Name)),
+				NatsConfigFile:          natsConfigFile,
+				NatsServerUrl:           natsServerUrl,
+				AccountServerUrl:        accountServerUrl,
+				RootKeyShares:           backup.shares,
+				RootKeySheets:           rootKeySheets,
+			})
 		},
 	}
+	cmd.Flags().StringVar(&operatorFlag, "operator", "", "operator name, f.e. ROOT_local (env: OPERATOR_NAME)")
+	cmd.Flags().StringVar(&natsServerUrlFlag, "nats-server-url", "", "NATS service URL(s), comma separated, f.e. tls://your.domain:4222 (env: NATS_SERVER_URL)")
+	cmd.Flags().StringVar(&accountServerUrlFlag, "account-server-url", "", "account server URL; derived from the NATS service URL if empty (env: ACCOUNT_SERVER_URL)")
+	backupFlags.register(cmd)
+	supportsDryRun(cmd)
+	return cmd
+}
+
+// rootKeyInstructions are stored along with the root key, or with each of its shares.
+func rootKeyInstructions(operator OperatorName) string {
+	return fmt.Sprintf(`    This is the root key of the NATS operator %s.
+    This key is only needed to change the operator, or in case the signing key of the operator
+    was compromised or lost; then we do *not* need to re-create the NATS cluster, but can issue
+    a new signing key and re-sign all accounts - users stay valid.
+    It is never stored; the following commands prompt for it (or read it from --root-seed-file):
+        operator edit --operator %s
+        operator rotate-signing-key --operator %s
+`, operator, operator, operator)
 }
 
 func executeSubCommand(cmd ...string) (string, error) {
@@ -166,21 +239,70 @@ func executeSubCommand(cmd ...string) (string, error) {
 	return buf.String(), err
 }
 
-// createSystemAccount  is taken from // see https://github.com/nats-io/nsc/blob/45f67cca820760edde74dbc1ce0abcaecf4f0986/cmd/init.go#L309
-func createSystemAccount() (nkeys.KeyPair, nkeys.KeyPair, *jwt.AccountClaims) {
+// writeNatsConfig stages the bootstrap NATS server config (NATS resolver, with the operator and the SYS account JWT)
+// in the transaction, and returns its path.
+func writeNatsConfig(cfg *config.Config, tx *transaction.Tx, operator OperatorName, operatorJwt string, sysAccountPubKey string, sysAccountJwt string) (string, error) {
+	configBuilder := nsccmd.NewNatsResolverConfigBuilder(false)
+	_ = configBuilder.SetSystemAccount(sysAccountPubKey)
+	_ = configBuilder.Add([]byte(operatorJwt))
+	_ = configBuilder.Add([]byte(sysAccountJwt))
+
+	generatedConfig, err := configBuilder.Generate()
+	if err != nil {
+		return "", fmt.Errorf("%w: generating NATS config: %w", common.ErrNsc, err)
+	}
+	natsConfigFile := cfg.StorePath(fmt.Sprintf("config-%s.cfg", operator))
+	return natsConfigFile, tx.WriteFile(natsConfigFile, generatedConfig, 0644)
+}
+
+// printInitOperatorDryRun compares the new operator and SYS account with the existing ones (if init-operator is run
+// again for an existing operator, they are replaced).
+func printInitOperatorDryRun(cfg *config.Config, operator OperatorName, operatorClaims *jwt.OperatorClaims, sysClaims *jwt.AccountClaims) error {
+	beforeOperator, err := readOperator(cfg, operator)
+	if err != nil && !errors.Is(err, common.ErrNotFound) {
+		return err
+	}
+	beforeSys, err := readAccount(cfg, operator, AccountName(sysClaims.Name))
+	if err != nil && !errors.Is(err, common.ErrNotFound) {
+		return err
+	}
+	operatorChanges, err := diffClaims(beforeOperator, operatorClaims)
+	if err != nil {
+		return err
+	}
+	sysChanges, err := diffClaims(beforeSys, sysClaims)
+	if err != nil {
+		return err
+	}
+	// root key, operator signing key, SYS account key and SYS account signing key.
+	return printDryRun(4, JwtDiff{
+		Name:    fmt.Sprintf("operator %s", operator),
+		File:    operatorJwtPath(cfg, operator),
+		Created: beforeOperator == nil,
+		Changes: operatorChanges,
+	}, JwtDiff{
+		Name:    fmt.Sprintf("account %s", sysClaims.Name),
+		File:    accountJwtPath(cfg, operator, AccountName(sysClaims.Name)),
+		Created: beforeSys == nil,
+		Changes: sysChanges,
+	})
+}
+
+// createSystemAccount is taken from https://github.com/nats-io/nsc/blob/45f67cca820760edde74dbc1ce0abcaecf4f0986/cmd/init.go#L309
+func createSystemAccount() (nkeys.KeyPair, nkeys.KeyPair, *jwt.AccountClaims, error) {
 	var acc nkeys.KeyPair
 	var sig nkeys.KeyPair
 	var err error
 	// create system account, signed by this operator
 	if acc, err = nkeys.CreateAccount(); err != nil {
-		panic(err)
+		return nil, nil, nil, err
 	}
 	if sig, err = nkeys.CreateAccount(); err != nil {
-		panic(err)
+		return nil, nil, nil, err
 	}
-	sysAccClaim := jwt.NewAccountClaims(publicKey(acc))
+	sysAccClaim := jwt.NewAccountClaims(PublicKey(acc))
 	sysAccClaim.Name = "SYS"
-	sysAccClaim.SigningKeys.Add(publicKey(sig))
+	sysAccClaim.SigningKeys.Add(PublicKey(sig))
 	sysAccClaim.Exports = jwt.Exports{&jwt.Export{
 		Name:                 "account-monitoring-services",
 		Subject:              "$SYS.REQ.ACCOUNT.*.*",
@@ -201,17 +323,5 @@ func createSystemAccount() (nkeys.KeyPair, nkeys.KeyPair, *jwt.AccountClaims) {
 			InfoURL:     "https://docs.nats.io/nats-server/configuration/sys_accounts",
 		},
 	}}
-	return acc, sig, sysAccClaim
-}
-
-func publicKey(nkey nkeys.KeyPair) string {
-	p, err := nkey.PublicKey()
-	panicOnErr(err)
-	return p
-}
-
-func seed(nkey nkeys.KeyPair) []byte {
-	p, err := nkey.Seed()
-	panicOnErr(err)
-	return p
+	return acc, sig, sysAccClaim, nil
 }
@@ -0,0 +1,281 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/pterm/pterm"
+	"github.com/sandstorm/natsCtl/cli/config"
+	"github.com/spf13/cobra"
+)
+
+// newLsCmd lists the contents of the store. Everything is read from the JWTs and .creds files directly,
+// so the master key is never unlocked.
+func newLsCmd(cfg config.Config) *cobra.Command {
+	var operatorFlag string
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List operators, accounts, roles and users (without unlocking the master key)",
+	}
+	cmd.PersistentFlags().StringVar(&operatorFlag, "operator", "", "operator name (env: OPERATOR_NAME)")
+	registerStoreCompletions(cmd, &cfg)
+
+	// resolveOperator is only needed for accounts, roles and users.
+	resolveOperator := func() (OperatorName, error) {
+		if operator := OperatorName(flagOrEnv(operatorFlag, "OPERATOR_NAME")); operator != "" {
+			return operator, nil
+		}
+		return chooseOperator(&cfg)
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "operators",
+		Short: "List all operators",
+		Args:  exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operators, err := getOperators(&cfg)
+			if err != nil {
+				return err
+			}
+			items := make([]OperatorListItem, 0, len(operators))
+			for _, o := range operators {
+				operator := OperatorName(o)
+				claims, err := readOperator(&cfg, operator)
+				if err != nil {
+					return err
+				}
+				accounts, err := getAccounts(&cfg, operator)
+				if err != nil {
+					return err
+				}
+				items = append(items, OperatorListItem{
+					Name:        string(operator),
+					PublicKey:   claims.Subject,
+					SigningKeys: len(claims.SigningKeys),
+					Accounts:    len(accounts),
+					IssuedAt:    formatUnix(claims.IssuedAt, time.RFC3339),
+					Expires:     formatUnix(claims.Expires, time.RFC3339),
+				})
+			}
+
+			if outputFormat != outputText {
+				return printResult(items)
+			}
+			data := pterm.TableData{{"Operator", "Public Key", "Signing Keys", "Accounts", "Issued At", "Expires"}}
+			for _, item := range items {
+				data = append(data, []string{item.Name, item.PublicKey, strconv.Itoa(item.SigningKeys), strconv.Itoa(item.Accounts), displayDate(item.IssuedAt), displayDate(item.Expires)})
+			}
+			return pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "accounts",
+		Short: "List all accounts of an operator",
+		Args:  exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operator, err := resolveOperator()
+			if err != nil {
+				return err
+			}
+			// fails with ErrNotFound for an unknown operator.
+			if _, err := readOperator(&cfg, operator); err != nil {
+				return err
+			}
+			accounts, err := getAccounts(&cfg, operator)
+			if err != nil {
+				return err
+			}
+			items := make([]AccountListItem, 0, len(accounts))
+			for _, a := range accounts {
+				claims, err := readAccount(&cfg, operator, AccountName(a))
+				if err != nil {
+					return err
+				}
+				items = append(items, AccountListItem{
+					Name:        a,
+					PublicKey:   claims.Subject,
+					Description: claims.Description,
+					SigningKeys: len(claims.SigningKeys),
+					Roles:       len(getRoleNames(claims)),
+					IssuedAt:    formatUnix(claims.IssuedAt, time.RFC3339),
+					Expires:     formatUnix(claims.Expires, time.RFC3339),
+				})
+			}
+
+			if outputFormat != outputText {
+				return printResult(items)
+			}
+			data := pterm.TableData{{"Account", "Public Key", "Description", "Signing Keys", "Roles", "Issued At", "Expires"}}
+			for _, item := range items {
+				data = append(data, []string{item.Name, item.PublicKey, item.Description, strconv.Itoa(item.SigningKeys), strconv.Itoa(item.Roles), displayDate(item.IssuedAt), displayDate(item.Expires)})
+			}
+			return pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:               "roles <account>",
+		Short:             "List the roles (scoped signing keys) of an account",
+		Args:              exactArgs(1),
+		ValidArgsFunction: storeCompletion(&cfg, completeAccountArg),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operator, err := resolveOperator()
+			if err != nil {
+				return err
+			}
+			claims, err := readAccount(&cfg, operator, AccountName(args[0]))
+			if err != nil {
+				return err
+			}
+			items := make([]RoleListItem, 0, len(claims.SigningKeys))
+			for _, role := range getRoleNames(claims) {
+				scope := scopedSigningKeyForRole(claims, RoleName(role))
+				items = append(items, RoleListItem{
+					Role:       role,
+					SigningKey: scope.Key,
+					Permissions: rolePermissions{
+						Pub:        scope.Template.Pub.Allow,
+						Sub:        scope.Template.Sub.Allow,
+						AllowReply: scope.Template.Resp != nil,
+					},
+				})
+			}
+
+			if outputFormat != outputText {
+				return printResult(items)
+			}
+			data := pterm.TableData{{"Role", "Signing Key", "Pub", "Sub", "Allow Reply"}}
+			for _, item := range items {
+				data = append(data, []string{item.Role, item.SigningKey, strings.Join(item.Permissions.Pub, ", "), strings.Join(item.Permissions.Sub, ", "), strconv.FormatBool(item.Permissions.AllowReply)})
+			}
+			return pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:               "users <account>",
+		Short:             "List the users of an account, from the .creds files and the user JWTs in the store",
+		Args:              exactArgs(1),
+		ValidArgsFunction: storeCompletion(&cfg, completeAccountArg),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operator, err := resolveOperator()
+			if err != nil {
+				return err
+			}
+			account := AccountName(args[0])
+			accountClaims, err := readAccount(&cfg, operator, account)
+			if err != nil {
+				return err
+			}
+			items, err := listUsers(&cfg, operator, account, accountClaims)
+			if err != nil {
+				return err
+			}
+
+			if outputFormat != outputText {
+				return printResult(items)
+			}
+			data := pterm.TableData{{"User", "Public Key", "Role", "Issued At", "Expires", "File"}}
+			for _, item := range items {
+				data = append(data, []string{item.Name, item.PublicKey, item.Role, displayDate(item.IssuedAt), displayDate(item.Expires), item.File})
+			}
+			return pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+		},
+	})
+
+	return cmd
+}
+
+// listUsers reads the .creds files written by user/admin-user, and the user JWTs nsc keeps in the store
+// (f.e. for the system account). A user found in both places is only listed once, with its .creds file.
+func listUsers(cfg *config.Config, operator OperatorName, account AccountName, accountClaims *jwt.AccountClaims) ([]UserListItem, error) {
+	items := make([]UserListItem, 0)
+	seen := map[string]bool{}
+
+	sources := []struct {
+		dir    string
+		suffix string
+		decode func(contents []byte) (string, error)
+	}{
+		{cfg.StorePath("nkeys", "creds", string(operator), string(account)), ".creds", func(contents []byte) (string, error) {
+			return jwt.ParseDecoratedJWT(contents)
+		}},
+		{cfg.StorePath("store", string(operator), "accounts", string(account), "users"), ".jwt", func(contents []byte) (string, error) {
+			return strings.TrimSpace(string(contents)), nil
+		}},
+	}
+	for _, source := range sources {
+		entries, err := os.ReadDir(source.dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("listing users of account %s: %w", account, err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), source.suffix) {
+				continue
+			}
+			file := filepath.Join(source.dir, entry.Name())
+			contents, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			userJwt, err := source.decode(contents)
+			if err != nil {
+				return nil, fmt.Errorf("reading user JWT from %s: %w", file, err)
+			}
+			claims, err := jwt.DecodeUserClaims(userJwt)
+			if err != nil {
+				return nil, fmt.Errorf("decoding user JWT from %s: %w", file, err)
+			}
+			if seen[claims.Subject] {
+				continue
+			}
+			seen[claims.Subject] = true
+
+			role := ""
+			if scope, ok := accountClaims.SigningKeys.GetScope(claims.Issuer); ok && scope != nil {
+				if userScope, ok := scope.(*jwt.UserScope); ok {
+					role = userScope.Role
+				}
+			}
+			items = append(items, UserListItem{
+				Name:      strings.TrimSuffix(entry.Name(), source.suffix),
+				PublicKey: claims.Subject,
+				Role:      role,
+				IssuedAt:  formatUnix(claims.IssuedAt, time.RFC3339),
+				Expires:   formatUnix(claims.Expires, time.RFC3339),
+				File:      file,
+			})
+		}
+	}
+	return items, nil
+}
+
+// formatUnix formats a JWT timestamp; 0 (f.e. no expiry) is formatted as empty string.
+func formatUnix(timestamp int64, layout string) string {
+	if timestamp == 0 {
+		return ""
+	}
+	return time.Unix(timestamp, 0).UTC().Format(layout)
+}
+
+// displayDate shortens an RFC 3339 date for the tables.
+func displayDate(rfc3339 string) string {
+	if rfc3339 == "" {
+		return "-"
+	}
+	t, err := time.Parse(time.RFC3339, rfc3339)
+	if err != nil {
+		return rfc3339
+	}
+	return t.Format("2006-01-02 15:04")
+}
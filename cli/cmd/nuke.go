@@ -3,12 +3,14 @@ package cmd
 import (
 	"github.com/bitfield/script"
 	"github.com/pterm/pterm"
+	"github.com/sandstorm/natsCtl/cli/common"
 	"github.com/sandstorm/natsCtl/cli/config"
 	"github.com/spf13/cobra"
 )
 
 func newNukeCmd(cfg config.Config) *cobra.Command {
-	return &cobra.Command{
+	var yes bool
+	cmd := &cobra.Command{
 		Use:   "nuke",
 		Short: "A brief description of your command",
 		Long: `A longer description that spans multiple lines and likely contains examples
@@ -17,21 +19,30 @@ and usage of using your command. For example:
 Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			shouldRemove, err := pterm.DefaultInteractiveConfirm.Show("Do you *REALLY* want to remove all Operators, Accounts, Users and associated NKEYS?")
-			panicOnErr(err)
-			if !shouldRemove {
-				return
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !yes {
+				if err := common.RequireInteractive("confirmation", "yes", ""); err != nil {
+					return err
+				}
+				shouldRemove, err := pterm.DefaultInteractiveConfirm.Show("Do you *REALLY* want to remove all Operators, Accounts, Users and associated NKEYS?")
+				if err != nil {
+					return err
+				}
+				if !shouldRemove {
+					return nil
+				}
 			}
 
-			_, err = script.NewPipe().
+			_, err := script.NewPipe().
 				// we should never use this directory, so it"s safe to remove.
 				Apply(ExecAndStdout(`rm -Rf ~/.local/share/nats/nsc/`)).
-				Apply(ExecAndStdout(`rm -Rf ./nsc`)).
+				Apply(ExecAndStdout(`rm -Rf '%s'`, cfg.StorePath())).
 				Apply(Printfln(pterm.Success, `All removed`)).
 				Apply(ExecAndStdout(`docker compose down`)).
 				Stdout()
-			panicOnErr(err)
+			return err
 		},
 	}
+	cmd.Flags().BoolVar(&yes, "yes", false, "remove everything without asking for confirmation")
+	return cmd
 }
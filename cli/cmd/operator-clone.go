@@ -0,0 +1,305 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/pterm/pterm"
+	"github.com/sandstorm/natsCtl/cli/common"
+	"github.com/sandstorm/natsCtl/cli/config"
+	"github.com/sandstorm/natsCtl/cli/transaction"
+	"github.com/spf13/cobra"
+)
+
+//nolint:funlen
+func newOperatorCloneCmd(cfg config.Config) *cobra.Command {
+	var natsServerUrlFlag, accountServerUrlFlag string
+	var backupFlags rootKeyBackupFlags
+	cmd := &cobra.Command{
+		Use:   "clone <src> <dst>",
+		Short: "Create a new operator with fresh keys, and the same accounts and roles as an existing one",
+		Long: `Create a new operator with fresh keys, and the same accounts and roles as an existing one - f.e. to set up
+staging and production like ROOT_local:
+
+1. a new operator (root key, signing key) and a new SYS account are created, like with init-operator
+2. every account (except SYS) is re-created with a new account key; descriptions, tags, limits, default
+   permissions, mappings, exports and imports are copied
+3. every signing key is replaced by a new one; scoped signing keys keep their role and template
+4. imports between the cloned accounts point to the new accounts; activation tokens are re-issued
+5. the NATS config is generated
+
+Users (and their .creds files) are NOT copied; create them with user or admin-user in the new operator.
+The source operator is only read; its root key is not needed.`,
+		Args: exactArgs(2),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			// only the source exists already.
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return completeOperators(&cfg, cmd, args, toComplete)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			source, operator := OperatorName(args[0]), OperatorName(args[1])
+			natsServerUrl := flagOrEnv(natsServerUrlFlag, "NATS_SERVER_URL")
+			accountServerUrl := flagOrEnv(accountServerUrlFlag, "ACCOUNT_SERVER_URL")
+			backup, err := backupFlags.parse()
+			if err != nil {
+				return err
+			}
+
+			sourceClaims, err := readOperator(&cfg, source)
+			if err != nil {
+				return err
+			}
+			if _, err := readOperator(&cfg, operator); err == nil {
+				return fmt.Errorf("%w: operator %s already exists", common.ErrValidation, operator)
+			} else if !errors.Is(err, common.ErrNotFound) {
+				return err
+			}
+			accounts, err := getAccounts(&cfg, source)
+			if err != nil {
+				return err
+			}
+			var sourceAccounts []*jwt.AccountClaims
+			for _, a := range accounts {
+				accountClaims, err := readAccount(&cfg, source, AccountName(a))
+				if err != nil {
+					return err
+				}
+				// the new operator gets a new SYS account, as with init-operator.
+				if accountClaims.Subject != sourceClaims.SystemAccount {
+					sourceAccounts = append(sourceAccounts, accountClaims)
+				}
+			}
+
+			if natsServerUrl == "" {
+				if err := common.RequireInteractive("NATS_SERVER_URL", "nats-server-url", "NATS_SERVER_URL"); err != nil {
+					return err
+				}
+				pterm.Printfln("Specify NATS service URL where the operator %s will be used:", bold.Sprint(operator))
+				pterm.Println("(required for push and pull). Examples: tls://your.domain:4222")
+				if natsServerUrl, err = common.TextInputMatchingRegex("NATS_SERVER_URL", natsServerUrlRegexp); err != nil {
+					return err
+				}
+			} else if !natsServerUrlRegexp.MatchString(natsServerUrl) {
+				return fmt.Errorf("%w: NATS_SERVER_URL %s must start with tls:// or nats://", common.ErrValidation, natsServerUrl)
+			}
+			if accountServerUrl == "" {
+				// see init-operator: push and pull do not work over TLS.
+				accountServerUrl = strings.ReplaceAll(natsServerUrl, "tls://", "nats://")
+				pterm.Info.Printfln("Account server URL derived from the NATS service URL: %s", accountServerUrl)
+			}
+
+			if err := unlock(&cfg); err != nil {
+				return err
+			}
+
+			// all keys, JWTs and the NATS config are written together on commit.
+			tx := transaction.New()
+			defer tx.Rollback()
+			keyStore := cfg.KeyStoreIn(tx)
+
+			pterm.Info.Printfln("Cloning operator %s into %s", bold.Sprint(source), bold.Sprint(operator))
+			operatorRootNkey, err := nkeys.CreateOperator()
+			if err != nil {
+				return err
+			}
+			defer operatorRootNkey.Wipe()
+			operatorSigningNkey, err := nkeys.CreateOperator()
+			if err != nil {
+				return err
+			}
+			defer operatorSigningNkey.Wipe()
+			if err := keyStore.Put(operatorSigningNkey); err != nil {
+				return fmt.Errorf("storing operator signing key: %w", err)
+			}
+			systemAccountNKey, systemAccountSigningNKey, sysClaims, err := createSystemAccount()
+			if err != nil {
+				return err
+			}
+			defer systemAccountNKey.Wipe()
+			if err := keyStore.Put(systemAccountNKey); err != nil {
+				return fmt.Errorf("storing system account key: %w", err)
+			}
+			if err := keyStore.Put(systemAccountSigningNKey); err != nil {
+				return fmt.Errorf("storing system account signing key: %w", err)
+			}
+
+			// same settings as init-operator; only the URLs differ between the environments.
+			operatorClaims := jwt.NewOperatorClaims(PublicKey(operatorRootNkey))
+			operatorClaims.StrictSigningKeyUsage = true
+			operatorClaims.Name = string(operator)
+			operatorClaims.SystemAccount = PublicKey(systemAccountNKey)
+			operatorClaims.AccountServerURL = accountServerUrl
+			operatorClaims.OperatorServiceURLs = strings.Split(natsServerUrl, ",")
+			operatorClaims.SigningKeys.Add(PublicKey(operatorSigningNkey))
+
+			result := CloneOperatorResult{
+				Source:                 string(source),
+				Operator:               string(operator),
+				OperatorPublicKey:      PublicKey(operatorRootNkey),
+				OperatorSigningKey:     PublicKey(operatorSigningNkey),
+				SystemAccountPublicKey: PublicKey(systemAccountNKey),
+				Accounts:               []ClonedAccount{},
+				RootKeyShares:          backup.shares,
+			}
+
+			// first, all account keys are created - imports can reference any of the accounts. The account keys are
+			// kept in memory, to re-issue the activation tokens of the imports.
+			accountKeys := map[string]nkeys.KeyPair{sourceClaims.SystemAccount: systemAccountNKey}
+			for _, sourceAccount := range sourceAccounts {
+				accountKey, err := nkeys.CreateAccount()
+				if err != nil {
+					return err
+				}
+				defer accountKey.Wipe()
+				if err := keyStore.Put(accountKey); err != nil {
+					return fmt.Errorf("storing account key: %w", err)
+				}
+				accountKeys[sourceAccount.Subject] = accountKey
+			}
+			newPublicKey := func(sourcePublicKey string) (string, bool) {
+				if accountKey, ok := accountKeys[sourcePublicKey]; ok {
+					return PublicKey(accountKey), true
+				}
+				return "", false
+			}
+
+			for _, sourceAccount := range sourceAccounts {
+				accountKey := accountKeys[sourceAccount.Subject]
+				accountClaims := jwt.NewAccountClaims(PublicKey(accountKey))
+				accountClaims.Name = sourceAccount.Name
+				// description, info URL, tags, limits, default permissions, mappings and exports.
+				accountClaims.Account = sourceAccount.Account
+				// revocations only reference users, which are not copied.
+				accountClaims.Revocations = nil
+				accountClaims.SigningKeys = jwt.SigningKeys{}
+				for key, scope := range sourceAccount.SigningKeys {
+					signingKey, err := genAndEncryptAccountSigningKey(keyStore)
+					if err != nil {
+						return err
+					}
+					if userScope, ok := scope.(*jwt.UserScope); ok {
+						newScope := *userScope
+						newScope.Key = string(signingKey)
+						accountClaims.SigningKeys.AddScopedSigner(&newScope)
+						pterm.Success.Printfln("%s: created scoped signing key %s for role %s", sourceAccount.Name, signingKey, userScope.Role)
+					} else {
+						if scope != nil {
+							result.Warnings.Printfln("%s: signing key %s has an unknown scope; it was replaced by an un-scoped signing key.", sourceAccount.Name, key)
+						}
+						accountClaims.SigningKeys.Add(string(signingKey))
+					}
+				}
+
+				accountClaims.Exports = jwt.Exports{}
+				for _, sourceExport := range sourceAccount.Exports {
+					export := *sourceExport
+					// export revocations reference importing accounts.
+					export.Revocations = nil
+					for key, at := range sourceExport.Revocations {
+						if export.Revocations == nil {
+							export.Revocations = jwt.RevocationList{}
+						}
+						if key == jwt.All {
+							export.Revocations[key] = at
+						} else if newKey, ok := newPublicKey(key); ok {
+							export.Revocations[newKey] = at
+						}
+					}
+					accountClaims.Exports = append(accountClaims.Exports, &export)
+				}
+
+				accountClaims.Imports = jwt.Imports{}
+				for _, sourceImport := range sourceAccount.Imports {
+					imp := *sourceImport
+					exporter, ok := newPublicKey(sourceImport.Account)
+					if !ok {
+						result.Warnings.Printfln("%s: import %s is from account %s outside of operator %s; it was copied unchanged, and may need a new activation token.", sourceAccount.Name, sourceImport.Subject, sourceImport.Account, source)
+						accountClaims.Imports.Add(&imp)
+						continue
+					}
+					imp.Account = exporter
+					if sourceImport.Token != "" {
+						if imp.Token, err = reissueActivation(sourceImport.Token, accountKeys[sourceImport.Account], accountClaims.Subject); err != nil {
+							return fmt.Errorf("%s: import %s: %w", sourceAccount.Name, sourceImport.Subject, err)
+						}
+					}
+					accountClaims.Imports.Add(&imp)
+				}
+
+				// external authorization references users, which are not copied.
+				if len(sourceAccount.Authorization.AuthUsers) > 0 {
+					result.Warnings.Printfln("%s: the auth callout users were removed, as users are not copied; configure the auth callout again.", sourceAccount.Name)
+					accountClaims.Authorization = jwt.ExternalAuthorization{}
+				} else {
+					accountClaims.Authorization.AllowedAccounts = nil
+					for _, allowed := range sourceAccount.Authorization.AllowedAccounts {
+						if newKey, ok := newPublicKey(allowed); ok {
+							accountClaims.Authorization.AllowedAccounts.Add(newKey)
+						} else {
+							accountClaims.Authorization.AllowedAccounts.Add(allowed)
+						}
+					}
+				}
+
+				if _, err := writeAccount(&cfg, tx, operator, accountClaims, operatorSigningNkey); err != nil {
+					return err
+				}
+				result.Accounts = append(result.Accounts, ClonedAccount{
+					Account:         sourceAccount.Name,
+					SourcePublicKey: sourceAccount.Subject,
+					PublicKey:       accountClaims.Subject,
+				})
+				pterm.Success.Printfln("Cloned account %s.", bold.Sprint(sourceAccount.Name))
+			}
+
+			operatorJwt, err := writeOperator(&cfg, tx, operator, operatorClaims, operatorSigningNkey)
+			if err != nil {
+				return err
+			}
+			sysAccountJwt, err := writeAccount(&cfg, tx, operator, sysClaims, operatorSigningNkey)
+			if err != nil {
+				return err
+			}
+			if result.NatsConfigFile, err = writeNatsConfig(&cfg, tx, operator, operatorJwt, PublicKey(systemAccountNKey), sysAccountJwt); err != nil {
+				return err
+			}
+			if result.RootKeySheets, err = backup.handOut(tx, operator, operatorRootNkey); err != nil {
+				return err
+			}
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+
+			backup.printSheetsHint()
+			pterm.Success.Printfln("Generated NATS config %s.", bold.Sprint(result.NatsConfigFile))
+			result.Warnings.Printfln("Users were not copied; create them with user or admin-user --operator %s.", operator)
+			return printResult(result)
+		},
+	}
+	cmd.Flags().StringVar(&natsServerUrlFlag, "nats-server-url", "", "NATS service URL(s) of the new operator, comma separated, f.e. tls://your.domain:4222 (env: NATS_SERVER_URL)")
+	cmd.Flags().StringVar(&accountServerUrlFlag, "account-server-url", "", "account server URL; derived from the NATS service URL if empty (env: ACCOUNT_SERVER_URL)")
+	backupFlags.register(cmd)
+	return cmd
+}
+
+// reissueActivation issues the activation token again for the cloned accounts: signed by the new exporting account,
+// for the new importing account; the subject, type and expiry are kept.
+func reissueActivation(token string, exporter nkeys.KeyPair, importer string) (string, error) {
+	sourceActivation, err := jwt.DecodeActivationClaims(token)
+	if err != nil {
+		return "", fmt.Errorf("%w: decoding activation token: %w", common.ErrValidation, err)
+	}
+	activation := jwt.NewActivationClaims(importer)
+	activation.Name = sourceActivation.Name
+	activation.Expires = sourceActivation.Expires
+	activation.ImportSubject = sourceActivation.ImportSubject
+	activation.ImportType = sourceActivation.ImportType
+	activation.Tags = sourceActivation.Tags
+	return activation.Encode(exporter)
+}
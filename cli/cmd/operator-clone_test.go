@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/sandstorm/natsCtl/cli/agent"
+	"github.com/sandstorm/natsCtl/cli/common"
+	"github.com/sandstorm/natsCtl/cli/config"
+)
+
+func newActivation(t *testing.T, exporter nkeys.KeyPair, importer string, subject jwt.Subject) string {
+	t.Helper()
+	activation := jwt.NewActivationClaims(importer)
+	activation.Name = "svc"
+	activation.ImportSubject = subject
+	activation.ImportType = jwt.Service
+	activation.Expires = time.Now().Add(time.Hour).Unix()
+	token, err := activation.Encode(exporter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestReissueActivation(t *testing.T) {
+	oldExporter, err := nkeys.CreateAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newExporter, err := nkeys.CreateAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldImporter, err := nkeys.CreateAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newImporter, err := nkeys.CreateAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := newActivation(t, oldExporter, PublicKey(oldImporter), "svc.>")
+	sourceClaims, err := jwt.DecodeActivationClaims(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := reissueActivation(source, newExporter, PublicKey(newImporter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	activation, err := jwt.DecodeActivationClaims(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if activation.Issuer != PublicKey(newExporter) || activation.Subject != PublicKey(newImporter) {
+		t.Errorf("expected the activation of %s for %s, got %s for %s", PublicKey(newExporter), PublicKey(newImporter), activation.Issuer, activation.Subject)
+	}
+	if activation.ImportSubject != "svc.>" || activation.ImportType != jwt.Service || activation.Expires != sourceClaims.Expires {
+		t.Errorf("expected subject, type and expiry to be kept, got %+v", activation)
+	}
+
+	if _, err := reissueActivation("garbage", newExporter, PublicKey(newImporter)); err == nil {
+		t.Error("expected an invalid token to be rejected")
+	}
+}
+
+// useMasterKey configures a fresh master key via the environment (see config.envVarDecryptor).
+func useMasterKey(t *testing.T, cfg *config.Config) {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MASTER_KEY", identity.String())
+	t.Setenv(agent.SocketEnvVar, "")
+	cfg.MasterPassword = config.MasterPasswordConfig{Type: "EnvVar"}
+}
+
+func TestOperatorClone(t *testing.T) {
+	o := newTestOperator(t, "OP")
+	useMasterKey(t, o.cfg)
+	common.SetNonInteractive(true)
+	t.Cleanup(func() { common.SetNonInteractive(false) })
+
+	outsideAccount, err := nkeys.CreateAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	scopedSigningKey, err := nkeys.CreateAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporterKey := o.addAccount(t, "EXPORTER", o.signingKey, func(claims *jwt.AccountClaims) {
+		claims.Exports.Add(&jwt.Export{Name: "svc", Subject: "svc.>", Type: jwt.Service, TokenReq: true})
+		scope := jwt.NewUserScope()
+		scope.Key = PublicKey(scopedSigningKey)
+		scope.Role = "billing"
+		scope.Template.Pub.Allow.Add("billing.>")
+		claims.SigningKeys.AddScopedSigner(scope)
+	})
+	importerKey := o.addAccount(t, "IMPORTER", o.signingKey, func(claims *jwt.AccountClaims) {
+		claims.Imports.Add(&jwt.Import{
+			Name:    "svc",
+			Subject: "svc.>",
+			Account: PublicKey(exporterKey),
+			Token:   newActivation(t, exporterKey, claims.Subject, "svc.>"),
+			Type:    jwt.Service,
+		})
+		claims.Imports.Add(&jwt.Import{Name: "outside", Subject: "outside.>", Account: PublicKey(outsideAccount), Type: jwt.Stream})
+	})
+
+	cmd := newOperatorCloneCmd(*o.cfg)
+	cmd.SetArgs([]string{"OP", "CLONE", "--nats-server-url", "nats://localhost:4222"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	clone, err := readOperator(o.cfg, "CLONE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter, err := readAccount(o.cfg, "CLONE", "EXPORTER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	importer, err := readAccount(o.cfg, "CLONE", "IMPORTER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exporter.Subject == PublicKey(exporterKey) || importer.Subject == PublicKey(importerKey) {
+		t.Error("expected new account keys")
+	}
+	if !clone.DidSign(exporter) || !clone.DidSign(importer) {
+		t.Error("expected the accounts to be signed by the new operator")
+	}
+
+	scopes := exporter.SigningKeys.Keys()
+	if len(scopes) != 1 {
+		t.Fatalf("expected one signing key, got %v", scopes)
+	}
+	scope, _ := exporter.SigningKeys.GetScope(scopes[0])
+	if userScope, ok := scope.(*jwt.UserScope); !ok || userScope.Role != "billing" || !userScope.Template.Pub.Allow.Contains("billing.>") {
+		t.Errorf("expected the scoped signing key to keep role and template, got %+v", scope)
+	}
+
+	if len(importer.Imports) != 2 {
+		t.Fatalf("expected 2 imports, got %d", len(importer.Imports))
+	}
+	for _, imp := range importer.Imports {
+		switch imp.Name {
+		case "svc":
+			if imp.Account != exporter.Subject {
+				t.Errorf("expected the import from the cloned exporter %s, got %s", exporter.Subject, imp.Account)
+			}
+			activation, err := jwt.DecodeActivationClaims(imp.Token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if activation.Issuer != exporter.Subject || activation.Subject != importer.Subject {
+				t.Errorf("expected the activation to be re-issued by %s for %s, got %s for %s", exporter.Subject, importer.Subject, activation.Issuer, activation.Subject)
+			}
+		case "outside":
+			if imp.Account != PublicKey(outsideAccount) || imp.Token != "" {
+				t.Errorf("expected the import from outside of the operator to be copied unchanged, got %+v", imp)
+			}
+		default:
+			t.Errorf("unexpected import %s", imp.Name)
+		}
+	}
+}
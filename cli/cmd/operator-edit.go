@@ -0,0 +1,282 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/pterm/pterm"
+	"github.com/sandstorm/natsCtl/cli/common"
+	"github.com/sandstorm/natsCtl/cli/config"
+	"github.com/sandstorm/natsCtl/cli/keystore"
+	"github.com/sandstorm/natsCtl/cli/transaction"
+	"github.com/spf13/cobra"
+)
+
+// operatorEditFlags are the flags changing the operator; if none is given, the changes are asked for interactively.
+var operatorEditFlags = []string{"service-url", "rm-service-url", "account-server-url", "tag", "rm-tag", "generate-signing-key", "rm-signing-key", "strict-signing-key-usage"}
+
+func newOperatorEditCmd(cfg config.Config) *cobra.Command {
+	var operatorFlag, rootSeedFile, accountServerURL string
+	var serviceURLs, rmServiceURLs, tags, rmTags, rmSigningKeys []string
+	var generateSigningKey, strictSigningKeyUsage bool
+	cmd := &cobra.Command{
+		Use:   "edit",
+		Short: "Change the operator JWT (service URLs, account server URL, tags, signing keys), signed with the root key",
+		Long: `Change the operator JWT; it is signed with the root key of the operator, which is prompted for (or read from
+--root-seed-file), verified against the operator JWT, and only kept in memory.
+
+Without any of the change flags, the changes are asked for interactively. Afterwards, the NATS config is
+re-generated; deploy it to the NATS servers and reload them.
+
+Signing keys which still signed an account cannot be removed - use "operator rotate-signing-key" for that.`,
+		Args: exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			operator := OperatorName(flagOrEnv(operatorFlag, "OPERATOR_NAME"))
+			if operator == "" {
+				if operator, err = chooseOperator(&cfg); err != nil {
+					return err
+				}
+			}
+			operatorClaims, err := readOperator(&cfg, operator)
+			if err != nil {
+				return err
+			}
+			// before is kept unmodified for --dry-run.
+			before, err := readOperator(&cfg, operator)
+			if err != nil {
+				return err
+			}
+
+			hasChangeFlags := false
+			for _, name := range operatorEditFlags {
+				hasChangeFlags = hasChangeFlags || cmd.Flags().Changed(name)
+			}
+			if !hasChangeFlags {
+				if err := common.RequireInteractive("changes", strings.Join(operatorEditFlags, ", --"), ""); err != nil {
+					return err
+				}
+				if err := promptOperatorChanges(operatorClaims, &generateSigningKey, &rmSigningKeys); err != nil {
+					return err
+				}
+			} else {
+				operatorClaims.OperatorServiceURLs.Add(serviceURLs...)
+				operatorClaims.OperatorServiceURLs.Remove(rmServiceURLs...)
+				if cmd.Flags().Changed("account-server-url") {
+					operatorClaims.AccountServerURL = accountServerURL
+				}
+				operatorClaims.Tags.Add(tags...)
+				operatorClaims.Tags.Remove(rmTags...)
+				if cmd.Flags().Changed("strict-signing-key-usage") {
+					operatorClaims.StrictSigningKeyUsage = strictSigningKeyUsage
+				}
+			}
+			for _, key := range rmSigningKeys {
+				if !operatorClaims.SigningKeys.Contains(key) {
+					return fmt.Errorf("%w: %s is no signing key of operator %s", common.ErrNotFound, key, operator)
+				}
+				operatorClaims.SigningKeys.Remove(key)
+			}
+
+			var signingKey nkeys.KeyPair
+			if generateSigningKey {
+				if signingKey, err = nkeys.CreateOperator(); err != nil {
+					return err
+				}
+				defer signingKey.Wipe()
+				operatorClaims.SigningKeys.Add(PublicKey(signingKey))
+			}
+			// validated before asking for the root seed.
+			if err := validateOperatorEdit(&cfg, operator, operatorClaims); err != nil {
+				return err
+			}
+
+			var rootKey nkeys.KeyPair
+			if !dryRun {
+				if rootKey, err = readRootSeed(operatorClaims, flagOrEnv(rootSeedFile, "OPERATOR_ROOT_SEED_FILE")); err != nil {
+					return err
+				}
+				defer rootKey.Wipe()
+				pterm.Success.Printfln("Root key matches operator %s.", operator)
+				if generateSigningKey {
+					if err := unlock(&cfg); err != nil {
+						return err
+					}
+				}
+			}
+
+			// the new signing key, the operator and the NATS config are written together on commit.
+			tx := transaction.New()
+			defer tx.Rollback()
+
+			result := OperatorEditResult{
+				Operator:           string(operator),
+				CreatedKeys:        []string{},
+				RemovedSigningKeys: rmSigningKeys,
+				JwtFile:            operatorJwtPath(&cfg, operator),
+			}
+			if result.RemovedSigningKeys == nil {
+				result.RemovedSigningKeys = []string{}
+			}
+			if signingKey != nil {
+				if err := keyStoreFor(&cfg, tx).Put(signingKey); err != nil {
+					return fmt.Errorf("storing operator signing key: %w", err)
+				}
+				result.CreatedKeys = append(result.CreatedKeys, PublicKey(signingKey))
+			}
+
+			if dryRun {
+				changes, err := diffClaims(before, operatorClaims)
+				if err != nil {
+					return err
+				}
+				return printDryRun(len(result.CreatedKeys), JwtDiff{
+					Name:    fmt.Sprintf("operator %s", operator),
+					File:    result.JwtFile,
+					Changes: changes,
+				})
+			}
+
+			operatorJwt, err := writeOperator(&cfg, tx, operator, operatorClaims, rootKey)
+			if err != nil {
+				return err
+			}
+			sysAccountJwt, err := os.ReadFile(accountJwtPath(&cfg, operator, "SYS"))
+			if err != nil {
+				return fmt.Errorf("%w: reading JWT of account SYS: %w", common.ErrNotFound, err)
+			}
+			if result.NatsConfigFile, err = writeNatsConfig(&cfg, tx, operator, operatorJwt, operatorClaims.SystemAccount, string(sysAccountJwt)); err != nil {
+				return err
+			}
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+			pterm.Success.Printfln("Updated operator %s.", bold.Sprint(operator))
+			for _, key := range result.CreatedKeys {
+				pterm.Success.Printfln("Created and encrypted the operator signing key %s.", bold.Sprint(key))
+			}
+			for _, key := range rmSigningKeys {
+				if err := cfg.KeyStore().Delete(key); err != nil && !errors.Is(err, keystore.ErrNotFound) {
+					result.Warnings.Printfln("Could not remove the signing key %s: %s", key, err)
+				} else {
+					pterm.Success.Printfln("Removed the signing key %s.", key)
+				}
+			}
+			pterm.Success.Printfln("Re-generated the NATS config %s.", bold.Sprint(result.NatsConfigFile))
+			result.Warnings.Printfln("Deploy %s (or at least the new operator JWT) to all NATS servers, and reload them.", result.NatsConfigFile)
+			return printResult(result)
+		},
+	}
+	cmd.Flags().StringVar(&operatorFlag, "operator", "", "operator name (env: OPERATOR_NAME)")
+	cmd.Flags().StringVar(&rootSeedFile, "root-seed-file", "", "file containing the root seed of the operator; prompted for otherwise (env: OPERATOR_ROOT_SEED_FILE)")
+	cmd.Flags().StringArrayVar(&serviceURLs, "service-url", nil, "add an operator service URL, f.e. nats://localhost:4222 (repeatable)")
+	cmd.Flags().StringArrayVar(&rmServiceURLs, "rm-service-url", nil, "remove an operator service URL (repeatable)")
+	cmd.Flags().StringVar(&accountServerURL, "account-server-url", "", "set the account server URL used by push and pull; empty to remove it")
+	cmd.Flags().StringArrayVar(&tags, "tag", nil, "add a tag (repeatable)")
+	cmd.Flags().StringArrayVar(&rmTags, "rm-tag", nil, "remove a tag (repeatable)")
+	cmd.Flags().BoolVar(&generateSigningKey, "generate-signing-key", false, "generate and encrypt an additional operator signing key")
+	cmd.Flags().StringArrayVar(&rmSigningKeys, "rm-signing-key", nil, "remove an operator signing key which signed no account (repeatable)")
+	cmd.Flags().BoolVar(&strictSigningKeyUsage, "strict-signing-key-usage", false, "only accept accounts signed by a signing key, not by the root key")
+	registerStoreCompletions(cmd, &cfg)
+	supportsDryRun(cmd)
+	return cmd
+}
+
+// promptOperatorChanges asks for every field; an empty input keeps the current value, and "-" clears it.
+func promptOperatorChanges(operatorClaims *jwt.OperatorClaims, generateSigningKey *bool, rmSigningKeys *[]string) error {
+	serviceURLs, err := promptList("Operator service URLs, comma separated (f.e. nats://localhost:4222)", operatorClaims.OperatorServiceURLs)
+	if err != nil {
+		return err
+	}
+	operatorClaims.OperatorServiceURLs = serviceURLs
+
+	accountServerURL, err := promptList("Account server URL (used by push and pull)", []string{operatorClaims.AccountServerURL})
+	if err != nil {
+		return err
+	}
+	operatorClaims.AccountServerURL = strings.Join(accountServerURL, "")
+
+	tags, err := promptList("Tags, comma separated", operatorClaims.Tags)
+	if err != nil {
+		return err
+	}
+	operatorClaims.Tags = tags
+
+	if operatorClaims.StrictSigningKeyUsage, err = pterm.DefaultInteractiveConfirm.WithDefaultValue(operatorClaims.StrictSigningKeyUsage).
+		Show("Strict signing key usage (only accept accounts signed by a signing key)"); err != nil {
+		return err
+	}
+	if *generateSigningKey, err = pterm.DefaultInteractiveConfirm.Show("Generate an additional operator signing key"); err != nil {
+		return err
+	}
+	if len(operatorClaims.SigningKeys) > 0 {
+		if *rmSigningKeys, err = pterm.DefaultInteractiveMultiselect.
+			WithDefaultText("Signing keys to remove (none to keep all)").
+			WithOptions(operatorClaims.SigningKeys).
+			Show(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func promptList(prompt string, current []string) ([]string, error) {
+	currentText := strings.Join(current, ", ")
+	if currentText == "" {
+		currentText = "-"
+	}
+	pterm.Printfln("%s - currently %s (empty to keep, - to clear):", prompt, bold.Sprint(currentText))
+	input, err := pterm.DefaultInteractiveTextInput.Show()
+	if err != nil {
+		return nil, err
+	}
+	switch input = strings.TrimSpace(input); input {
+	case "":
+		return current, nil
+	case "-":
+		return nil, nil
+	}
+	var values []string
+	for _, value := range strings.Split(input, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values, nil
+}
+
+// validateOperatorEdit checks the changed operator claims; and that all accounts are still signed by a key of
+// the operator - which would not be the case after removing their signing key, or with strict signing key usage.
+func validateOperatorEdit(cfg *config.Config, operator OperatorName, operatorClaims *jwt.OperatorClaims) error {
+	vr := jwt.CreateValidationResults()
+	operatorClaims.Validate(vr)
+	if vr.IsBlocking(true) {
+		return fmt.Errorf("%w: %w", common.ErrValidation, errors.Join(vr.Errors()...))
+	}
+	if len(operatorClaims.SigningKeys) == 0 {
+		return fmt.Errorf("%w: operator %s needs at least one signing key", common.ErrValidation, operator)
+	}
+	accounts, err := getAccounts(cfg, operator)
+	if err != nil {
+		return err
+	}
+	var invalidated []string
+	for _, account := range accounts {
+		accountClaims, err := readAccount(cfg, operator, AccountName(account))
+		if err != nil {
+			return err
+		}
+		if !operatorClaims.DidSign(accountClaims) {
+			invalidated = append(invalidated, fmt.Sprintf("%s (signed by %s)", account, accountClaims.Issuer))
+		}
+	}
+	if len(invalidated) > 0 {
+		return fmt.Errorf("%w: the change would invalidate the accounts %s - use operator rotate-signing-key to replace a signing key",
+			common.ErrValidation, strings.Join(invalidated, ", "))
+	}
+	return nil
+}
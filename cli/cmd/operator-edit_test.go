@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/sandstorm/natsCtl/cli/common"
+)
+
+func TestValidateOperatorEdit(t *testing.T) {
+	o := newTestOperator(t, "OP")
+	o.addAccount(t, "APP", o.signingKey, nil)
+
+	edited := *o.claims
+	edited.OperatorServiceURLs = jwt.StringList{"nats://nats.example.com:4222"}
+	if err := validateOperatorEdit(o.cfg, o.name, &edited); err != nil {
+		t.Errorf("expected the edit to be valid, got %s", err)
+	}
+}
+
+func TestValidateOperatorEditRejectsInvalidatedAccounts(t *testing.T) {
+	o := newTestOperator(t, "OP")
+	o.addAccount(t, "APP", o.signingKey, nil)
+	o.addAccount(t, "LEGACY", o.rootKey, nil)
+
+	// removing the signing key invalidates APP.
+	withoutSigningKey := *o.claims
+	withoutSigningKey.SigningKeys = jwt.StringList{PublicKey(newOperatorKey(t))}
+	err := validateOperatorEdit(o.cfg, o.name, &withoutSigningKey)
+	if !errors.Is(err, common.ErrValidation) || !strings.Contains(err.Error(), "APP (signed by") || strings.Contains(err.Error(), "LEGACY") {
+		t.Errorf("expected only APP to be invalidated, got %v", err)
+	}
+
+	// strict signing key usage invalidates the accounts signed with the root key.
+	strict := *o.claims
+	strict.StrictSigningKeyUsage = true
+	err = validateOperatorEdit(o.cfg, o.name, &strict)
+	if !errors.Is(err, common.ErrValidation) || !strings.Contains(err.Error(), "LEGACY (signed by") || strings.Contains(err.Error(), "APP") {
+		t.Errorf("expected only LEGACY to be invalidated, got %v", err)
+	}
+}
+
+func TestValidateOperatorEditRequiresSigningKey(t *testing.T) {
+	o := newTestOperator(t, "OP")
+
+	edited := *o.claims
+	edited.SigningKeys = nil
+	if err := validateOperatorEdit(o.cfg, o.name, &edited); !errors.Is(err, common.ErrValidation) {
+		t.Errorf("expected a validation error without signing keys, got %v", err)
+	}
+
+	invalidUrl := *o.claims
+	invalidUrl.OperatorServiceURLs = jwt.StringList{"http://not-a-nats-url"}
+	if err := validateOperatorEdit(o.cfg, o.name, &invalidUrl); !errors.Is(err, common.ErrValidation) {
+		t.Errorf("expected a validation error for the service URL, got %v", err)
+	}
+}
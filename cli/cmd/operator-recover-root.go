@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pterm/pterm"
+	"github.com/sandstorm/natsCtl/cli/common"
+	"github.com/sandstorm/natsCtl/cli/config"
+	"github.com/sandstorm/natsCtl/cli/shamir"
+	"github.com/spf13/cobra"
+)
+
+func newOperatorRecoverRootCmd(cfg config.Config) *cobra.Command {
+	var operatorFlag, outFlag string
+	var shareFiles []string
+	cmd := &cobra.Command{
+		Use:   "recover-root",
+		Short: "Rebuild the root key of an operator from its Shamir shares (init-operator --root-key-shares)",
+		Long: `Rebuild the root key of an operator from its Shamir shares, as created by init-operator --root-key-shares.
+
+The shares are read from files (f.e. the share sheets, or a scanned QR code), or prompted for until enough of them
+were entered. The rebuilt root key is verified against the operator JWT, and printed - or written to --out, to be
+used with --root-seed-file of the other operator commands.`,
+		Args: exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			operator := OperatorName(flagOrEnv(operatorFlag, "OPERATOR_NAME"))
+			if operator == "" {
+				if operator, err = chooseOperator(&cfg); err != nil {
+					return err
+				}
+			}
+			operatorClaims, err := readOperator(&cfg, operator)
+			if err != nil {
+				return err
+			}
+
+			var shares [][]byte
+			defer func() {
+				for _, share := range shares {
+					shamir.Wipe(share)
+				}
+			}()
+			// the threshold is part of every share; so we know how many to ask for after the first one.
+			threshold := 0
+			addShare := func(text string) error {
+				shareThreshold, share, err := decodeShare(text)
+				if err != nil {
+					return err
+				}
+				if threshold != 0 && shareThreshold != threshold {
+					return fmt.Errorf("%w: the share needs %d shares, the previous ones %d - are they from different splits?", common.ErrValidation, shareThreshold, threshold)
+				}
+				for _, existing := range shares {
+					if existing[0] == share[0] {
+						return fmt.Errorf("%w: share %d was already given", common.ErrValidation, share[0])
+					}
+				}
+				threshold = shareThreshold
+				shares = append(shares, share)
+				return nil
+			}
+
+			for _, file := range shareFiles {
+				contents, err := os.ReadFile(file)
+				if err != nil {
+					return fmt.Errorf("%w: reading share: %w", common.ErrValidation, err)
+				}
+				err = addShare(string(contents))
+				shamir.Wipe(contents)
+				if err != nil {
+					return fmt.Errorf("%s: %w", file, err)
+				}
+			}
+			for threshold == 0 || len(shares) < threshold {
+				if err := common.RequireInteractive("root key share", "share-file", ""); err != nil {
+					return err
+				}
+				if threshold == 0 {
+					pterm.Printfln("Root key share of operator %s (NATSSHARE1-...):", bold.Sprint(operator))
+				} else {
+					pterm.Printfln("Root key share %d of %d needed:", len(shares)+1, threshold)
+				}
+				input, err := common.RequiredTextInput("SHARE")
+				if err != nil {
+					return err
+				}
+				if err := addShare(input); err != nil {
+					// typos are detected by the checksum; so the share can simply be entered again.
+					pterm.Error.Println(err)
+				}
+			}
+
+			rootKey, err := combineRootKey(shares, operatorClaims.Subject)
+			if err != nil {
+				return err
+			}
+			defer rootKey.Wipe()
+			pterm.Success.Printfln("Rebuilt the root key of operator %s from %d shares.", operator, len(shares))
+
+			result := RecoverRootResult{
+				Operator:      string(operator),
+				RootPublicKey: operatorClaims.Subject,
+				SharesUsed:    len(shares),
+				SeedFile:      outFlag,
+			}
+			if outFlag != "" {
+				// O_EXCL: an existing file is never overwritten.
+				f, err := os.OpenFile(outFlag, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+				if err != nil {
+					return fmt.Errorf("%w: writing root seed: %w", common.ErrValidation, err)
+				}
+				_, err = f.Write(Seed(rootKey))
+				if closeErr := f.Close(); err == nil {
+					err = closeErr
+				}
+				if err != nil {
+					return fmt.Errorf("writing root seed: %w", err)
+				}
+				pterm.Success.Printfln("Wrote the root seed to %s.", bold.Sprint(outFlag))
+				result.Warnings.Printfln("%s contains the UNENCRYPTED root key; delete it as soon as it is not needed anymore.", outFlag)
+			} else {
+				pterm.Printfln(`
+    -----------------------------------------------
+%s
+    PRIVATE ROOT KEY:
+
+        %s
+
+    -----------------------------------------------
+`, rootKeyInstructions(operator), Seed(rootKey))
+			}
+			return printResult(result)
+		},
+	}
+	cmd.Flags().StringVar(&operatorFlag, "operator", "", "operator name (env: OPERATOR_NAME)")
+	cmd.Flags().StringArrayVar(&shareFiles, "share-file", nil, "file containing a share, f.e. a share sheet (repeatable); the missing shares are prompted for")
+	cmd.Flags().StringVar(&outFlag, "out", "", "write the root seed to this new file (mode 0600), instead of printing it")
+	registerStoreCompletions(cmd, &cfg)
+	return cmd
+}
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nkeys"
+	"github.com/pterm/pterm"
+	"github.com/sandstorm/natsCtl/cli/common"
+	"github.com/sandstorm/natsCtl/cli/config"
+	"github.com/sandstorm/natsCtl/cli/keystore"
+	"github.com/sandstorm/natsCtl/cli/transaction"
+	"github.com/spf13/cobra"
+)
+
+func newOperatorRotateSigningKeyCmd(cfg config.Config) *cobra.Command {
+	var operatorFlag, signingKeyFlag, rootSeedFile string
+	var pushFlag bool
+	cmd := &cobra.Command{
+		Use:   "rotate-signing-key",
+		Short: "Replace an operator signing key (f.e. after it leaked), and re-sign all accounts",
+		Long: `Replace an operator signing key - f.e. after it leaked:
+
+1. the root seed (as printed by init-operator) is verified against the operator JWT
+2. a new operator signing key is generated and encrypted
+3. the operator JWT is re-signed with the root key; with the new signing key, and without the old one
+4. every account JWT (including SYS) is re-signed with the new signing key
+5. the NATS config is re-generated with the new operator JWT
+6. the encrypted old signing key is removed
+7. all accounts are pushed (with --push, or after confirmation)
+
+The NATS servers only accept the re-signed accounts after they were reloaded with the new operator JWT (from the
+re-generated NATS config); so push only afterwards. Users are signed by account keys, and stay valid.`,
+		Args: exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			operator := OperatorName(flagOrEnv(operatorFlag, "OPERATOR_NAME"))
+			if operator == "" {
+				if operator, err = chooseOperator(&cfg); err != nil {
+					return err
+				}
+			}
+			operatorClaims, err := readOperator(&cfg, operator)
+			if err != nil {
+				return err
+			}
+
+			oldKey := flagOrEnv(signingKeyFlag, "OPERATOR_SIGNING_KEY")
+			switch {
+			case oldKey != "":
+				if !operatorClaims.SigningKeys.Contains(oldKey) {
+					return fmt.Errorf("%w: %s is no signing key of operator %s", common.ErrNotFound, oldKey, operator)
+				}
+			case len(operatorClaims.SigningKeys) == 0:
+				return fmt.Errorf("%w: no signing key for operator %s", common.ErrNotFound, operator)
+			case len(operatorClaims.SigningKeys) == 1:
+				oldKey = operatorClaims.SigningKeys[0]
+			default:
+				if err := common.RequireInteractive("OPERATOR_SIGNING_KEY", "signing-key", "OPERATOR_SIGNING_KEY"); err != nil {
+					return err
+				}
+				pterm.Printfln("Signing key of operator %s to replace:", bold.Sprint(operator))
+				if oldKey, err = pterm.DefaultInteractiveSelect.WithOptions(operatorClaims.SigningKeys).Show(); err != nil {
+					return err
+				}
+			}
+
+			rootKey, err := readRootSeed(operatorClaims, flagOrEnv(rootSeedFile, "OPERATOR_ROOT_SEED_FILE"))
+			if err != nil {
+				return err
+			}
+			defer rootKey.Wipe()
+			pterm.Success.Printfln("Root key matches operator %s.", operator)
+
+			if err := unlock(&cfg); err != nil {
+				return err
+			}
+
+			// the new key, the operator, all accounts and the NATS config are written together on commit.
+			tx := transaction.New()
+			defer tx.Rollback()
+
+			newKey, err := nkeys.CreateOperator()
+			if err != nil {
+				return err
+			}
+			defer newKey.Wipe()
+			if err := cfg.KeyStoreIn(tx).Put(newKey); err != nil {
+				return fmt.Errorf("storing operator signing key: %w", err)
+			}
+			pterm.Success.Printfln("Created and encrypted the new operator signing key %s.", bold.Sprint(PublicKey(newKey)))
+
+			operatorClaims.SigningKeys.Add(PublicKey(newKey))
+			operatorClaims.SigningKeys.Remove(oldKey)
+			operatorJwt, err := writeOperator(&cfg, tx, operator, operatorClaims, rootKey)
+			if err != nil {
+				return err
+			}
+
+			result := RotateSigningKeyResult{
+				Operator:         string(operator),
+				OldSigningKey:    oldKey,
+				NewSigningKey:    PublicKey(newKey),
+				ResignedAccounts: []string{},
+			}
+			accounts, err := getAccounts(&cfg, operator)
+			if err != nil {
+				return err
+			}
+			sysAccountJwt := ""
+			for _, a := range accounts {
+				accountClaims, err := readAccount(&cfg, operator, AccountName(a))
+				if err != nil {
+					return err
+				}
+				accountJwt, err := writeAccount(&cfg, tx, operator, accountClaims, newKey)
+				if err != nil {
+					return err
+				}
+				if accountClaims.Subject == operatorClaims.SystemAccount {
+					sysAccountJwt = accountJwt
+				}
+				result.ResignedAccounts = append(result.ResignedAccounts, a)
+				pterm.Success.Printfln("Re-signed account %s.", a)
+			}
+			if sysAccountJwt == "" {
+				return fmt.Errorf("%w: system account %s of operator %s", common.ErrNotFound, operatorClaims.SystemAccount, operator)
+			}
+			if result.NatsConfigFile, err = writeNatsConfig(&cfg, tx, operator, operatorJwt, operatorClaims.SystemAccount, sysAccountJwt); err != nil {
+				return err
+			}
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+			pterm.Success.Printfln("Re-generated the NATS config %s.", bold.Sprint(result.NatsConfigFile))
+
+			if err := cfg.KeyStore().Delete(oldKey); errors.Is(err, keystore.ErrNotFound) {
+				result.Warnings.Printfln("The old signing key %s was not in the key store.", oldKey)
+			} else if err != nil {
+				result.Warnings.Printfln("Could not remove the old signing key %s: %s", oldKey, err)
+			} else {
+				pterm.Success.Printfln("Removed the old signing key %s.", oldKey)
+			}
+
+			pterm.Warning.Printfln("Deploy %s (or at least the new operator JWT) to all NATS servers, and reload them. Until then, they reject the re-signed accounts.", result.NatsConfigFile)
+			push := pushFlag
+			if !push && common.IsInteractive() {
+				push, err = pterm.DefaultInteractiveConfirm.Show("Were the NATS servers reloaded? Then push all accounts now")
+				if err != nil {
+					return err
+				}
+			}
+			if push {
+				pushResult, err := pushAccounts(operator, &cfg)
+				if err != nil {
+					return err
+				}
+				result.Pushed = true
+				result.Warnings = append(result.Warnings, pushResult.Warnings...)
+			} else {
+				result.Warnings.Printfln("Accounts were not pushed; run push after the NATS servers were reloaded.")
+			}
+			return printResult(result)
+		},
+	}
+	cmd.Flags().StringVar(&operatorFlag, "operator", "", "operator name (env: OPERATOR_NAME)")
+	cmd.Flags().StringVar(&signingKeyFlag, "signing-key", "", "public key of the signing key to replace; only needed if the operator has several (env: OPERATOR_SIGNING_KEY)")
+	cmd.Flags().StringVar(&rootSeedFile, "root-seed-file", "", "file containing the root seed of the operator; prompted for otherwise (env: OPERATOR_ROOT_SEED_FILE)")
+	cmd.Flags().BoolVar(&pushFlag, "push", false, "push all accounts afterwards - only once the NATS servers were reloaded with the new operator JWT")
+	registerStoreCompletions(cmd, &cfg)
+	return cmd
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/pterm/pterm"
+	"github.com/sandstorm/natsCtl/cli/common"
+	"github.com/sandstorm/natsCtl/cli/config"
+	"github.com/sandstorm/natsCtl/cli/shamir"
+	"github.com/spf13/cobra"
+)
+
+// newOperatorCmd groups the commands which change the operator itself; most of them need the root key of the
+// operator, which is only printed by init-operator and never stored.
+func newOperatorCmd(cfg config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "operator",
+		Short: "Manage an operator with its root key (edit, signing key rotation, root key recovery), or clone it",
+	}
+	cmd.AddCommand(newOperatorEditCmd(cfg))
+	cmd.AddCommand(newOperatorRotateSigningKeyCmd(cfg))
+	cmd.AddCommand(newOperatorRecoverRootCmd(cfg))
+	cmd.AddCommand(newOperatorCloneCmd(cfg))
+	return cmd
+}
+
+// readRootSeed reads the root seed of the operator from the file, or prompts for it (masked), and verifies it
+// against the subject of the operator JWT. The seed is only kept in memory; call Wipe() on the key pair when done.
+func readRootSeed(operatorClaims *jwt.OperatorClaims, seedFile string) (nkeys.KeyPair, error) {
+	var contents []byte
+	if seedFile != "" {
+		var err error
+		if contents, err = os.ReadFile(seedFile); err != nil {
+			return nil, fmt.Errorf("%w: reading root seed: %w", common.ErrValidation, err)
+		}
+	} else {
+		if err := common.RequireInteractive("root seed", "root-seed-file", "OPERATOR_ROOT_SEED_FILE"); err != nil {
+			return nil, err
+		}
+		pterm.Printfln("Private root key of operator %s (SO..., as printed by init-operator):", bold.Sprint(operatorClaims.Name))
+		input, err := common.RequiredPasswordInput("ROOT_SEED")
+		if err != nil {
+			return nil, err
+		}
+		contents = []byte(input)
+	}
+	defer shamir.Wipe(contents)
+	// a sub-slice of contents; so no unwiped copy of the seed is left behind.
+	seed := bytes.TrimSpace(contents)
+
+	rootKey, err := nkeys.FromSeed(seed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid root seed: %w", common.ErrValidation, err)
+	}
+	if err := verifyRootKey(operatorClaims, rootKey); err != nil {
+		rootKey.Wipe()
+		return nil, err
+	}
+	return rootKey, nil
+}
+
+// verifyRootKey checks that the key pair is the root key of the operator.
+func verifyRootKey(operatorClaims *jwt.OperatorClaims, rootKey nkeys.KeyPair) error {
+	if pubKey, err := rootKey.PublicKey(); err != nil || pubKey != operatorClaims.Subject {
+		return fmt.Errorf("%w: the seed is not the root key of operator %s (%s)", common.ErrValidation, operatorClaims.Name, operatorClaims.Subject)
+	}
+	return nil
+}
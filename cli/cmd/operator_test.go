@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/sandstorm/natsCtl/cli/common"
+)
+
+// writeSeedFile writes the seed of the key with surrounding whitespace, as written by editors.
+func writeSeedFile(t *testing.T, key nkeys.KeyPair) string {
+	t.Helper()
+	seed, err := key.Seed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seedFile := filepath.Join(t.TempDir(), "root.nk")
+	if err := os.WriteFile(seedFile, append(append([]byte("  "), seed...), '\n'), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return seedFile
+}
+
+func TestReadRootSeed(t *testing.T) {
+	rootKey := newOperatorKey(t)
+	operatorClaims := jwt.NewOperatorClaims(PublicKey(rootKey))
+	operatorClaims.Name = "OP"
+
+	loaded, err := readRootSeed(operatorClaims, writeSeedFile(t, rootKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.Wipe()
+	if PublicKey(loaded) != operatorClaims.Subject {
+		t.Errorf("expected the root key %s, got %s", operatorClaims.Subject, PublicKey(loaded))
+	}
+}
+
+func TestReadRootSeedRejectsOtherKeys(t *testing.T) {
+	operatorClaims := jwt.NewOperatorClaims(PublicKey(newOperatorKey(t)))
+	operatorClaims.Name = "OP"
+
+	if _, err := readRootSeed(operatorClaims, writeSeedFile(t, newOperatorKey(t))); !errors.Is(err, common.ErrValidation) {
+		t.Errorf("expected a validation error for the seed of another operator, got %v", err)
+	}
+	garbage := filepath.Join(t.TempDir(), "garbage.nk")
+	if err := os.WriteFile(garbage, []byte("SOGARBAGE\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readRootSeed(operatorClaims, garbage); !errors.Is(err, common.ErrValidation) {
+		t.Errorf("expected a validation error for an invalid seed, got %v", err)
+	}
+}
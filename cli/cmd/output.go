@@ -0,0 +1,307 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pterm/pterm"
+	"github.com/sandstorm/natsCtl/cli/common"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+	outputYAML = "yaml"
+)
+
+// outputFormat is set via --output. For json and yaml, the human readable output goes to stderr,
+// and stdout only contains the result object of the command.
+var outputFormat = outputText
+
+func setupOutput() error {
+	switch outputFormat {
+	case outputText:
+		return nil
+	case outputJSON, outputYAML:
+		pterm.SetDefaultOutput(os.Stderr)
+		return nil
+	default:
+		return fmt.Errorf("%w: unsupported --output %s; only supported: %s %s %s", common.ErrValidation, outputFormat, outputText, outputJSON, outputYAML)
+	}
+}
+
+// humanOutput is where human readable output (f.e. of nsc) goes; stderr for machine readable output.
+func humanOutput() io.Writer {
+	if outputFormat == outputText {
+		return os.Stdout
+	}
+	return os.Stderr
+}
+
+// printResult prints the result object of a command as JSON or YAML to stdout. For text output,
+// everything was already printed along the way; so nothing happens.
+func printResult(result any) error {
+	switch outputFormat {
+	case outputJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	case outputYAML:
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		defer encoder.Close()
+		return encoder.Encode(result)
+	}
+	return nil
+}
+
+// warnings are printed immediately, and collected for the result object.
+type warnings []string
+
+func (w *warnings) Printfln(format string, args ...any) {
+	pterm.Warning.Printfln(format, args...)
+	*w = append(*w, fmt.Sprintf(format, args...))
+}
+
+// InitOperatorResult is printed by init-operator.
+type InitOperatorResult struct {
+	Operator string `json:"operator" yaml:"operator"`
+	// OperatorPublicKey is the public root key of the operator; the private root key is only printed to the terminal,
+	// or split into RootKeyShares (f.e. "3-of-5"), which are written to RootKeySheets with --root-key-sheets-dir.
+	OperatorPublicKey       string   `json:"operatorPublicKey" yaml:"operatorPublicKey"`
+	OperatorSigningKey      string   `json:"operatorSigningKey" yaml:"operatorSigningKey"`
+	SystemAccountPublicKey  string   `json:"systemAccountPublicKey" yaml:"systemAccountPublicKey"`
+	SystemAccountSigningKey string   `json:"systemAccountSigningKey" yaml:"systemAccountSigningKey"`
+	OperatorJwtFile         string   `json:"operatorJwtFile" yaml:"operatorJwtFile"`
+	SystemAccountJwtFile    string   `json:"systemAccountJwtFile" yaml:"systemAccountJwtFile"`
+	NatsConfigFile          string   `json:"natsConfigFile" yaml:"natsConfigFile"`
+	NatsServerUrl           string   `json:"natsServerUrl" yaml:"natsServerUrl"`
+	AccountServerUrl        string   `json:"accountServerUrl" yaml:"accountServerUrl"`
+	RootKeyShares           string   `json:"rootKeyShares,omitempty" yaml:"rootKeyShares,omitempty"`
+	RootKeySheets           []string `json:"rootKeySheets,omitempty" yaml:"rootKeySheets,omitempty"`
+	Warnings                warnings `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// AccountResult is printed by account.
+type AccountResult struct {
+	Operator         string `json:"operator" yaml:"operator"`
+	Account          string `json:"account" yaml:"account"`
+	AccountPublicKey string `json:"accountPublicKey" yaml:"accountPublicKey"`
+	// Created is false if an existing account was updated.
+	Created bool `json:"created" yaml:"created"`
+	// CreatedKeys are the public keys of all newly created (and encrypted) NKeys.
+	CreatedKeys []string `json:"createdKeys" yaml:"createdKeys"`
+	JwtFile     string   `json:"jwtFile" yaml:"jwtFile"`
+	Warnings    warnings `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// ScopedSigningKeyResult is printed by scoped-signing-key.
+type ScopedSigningKeyResult struct {
+	Operator string `json:"operator" yaml:"operator"`
+	Account  string `json:"account" yaml:"account"`
+	Role     string `json:"role" yaml:"role"`
+	// SigningKey is the public key of the scoped signing key.
+	SigningKey string `json:"signingKey" yaml:"signingKey"`
+	// Created is false if an existing role was updated.
+	Created     bool            `json:"created" yaml:"created"`
+	Permissions rolePermissions `json:"permissions" yaml:"permissions"`
+	JwtFile     string          `json:"jwtFile" yaml:"jwtFile"`
+	Warnings    warnings        `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// UserResult is printed by user and admin-user.
+type UserResult struct {
+	Operator string `json:"operator" yaml:"operator"`
+	Account  string `json:"account" yaml:"account"`
+	// Role is empty for admin users, as they are not scoped.
+	Role          string `json:"role,omitempty" yaml:"role,omitempty"`
+	User          string `json:"user" yaml:"user"`
+	UserPublicKey string `json:"userPublicKey" yaml:"userPublicKey"`
+	// CredsFile is the absolute path of the .creds file.
+	CredsFile string `json:"credsFile" yaml:"credsFile"`
+	// InboxPrefix must be configured in the client; empty for admin users, which may use any inbox.
+	InboxPrefix string `json:"inboxPrefix,omitempty" yaml:"inboxPrefix,omitempty"`
+	// ContextName is the name of the created nats CLI context.
+	ContextName string `json:"contextName" yaml:"contextName"`
+	// Expires is set for admin users (RFC 3339).
+	Expires  string   `json:"expires,omitempty" yaml:"expires,omitempty"`
+	Warnings warnings `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// PushResult is printed by push.
+type PushResult struct {
+	Operator string `json:"operator" yaml:"operator"`
+	// Accounts are the names of the pushed accounts.
+	Accounts []string `json:"accounts" yaml:"accounts"`
+	// Diffs are the changes of the pushed JWTs, compared with the ones on the account server.
+	Diffs []JwtDiff `json:"diffs" yaml:"diffs"`
+	// UnknownAccounts are the public keys of accounts which are on the account server, but not in the store.
+	UnknownAccounts []string `json:"unknownAccounts,omitempty" yaml:"unknownAccounts,omitempty"`
+	Warnings        warnings `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// PullResult is printed by pull.
+type PullResult struct {
+	Operator string `json:"operator" yaml:"operator"`
+	// Pulled is false if the account server was not reachable, and the local JWTs are used.
+	Pulled bool `json:"pulled" yaml:"pulled"`
+	// Accounts are the names of the accounts whose JWT was updated (or added) from the account server.
+	Accounts []string `json:"accounts" yaml:"accounts"`
+	Warnings warnings `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// RotateSigningKeyResult is printed by operator rotate-signing-key.
+type RotateSigningKeyResult struct {
+	Operator      string `json:"operator" yaml:"operator"`
+	OldSigningKey string `json:"oldSigningKey" yaml:"oldSigningKey"`
+	NewSigningKey string `json:"newSigningKey" yaml:"newSigningKey"`
+	// ResignedAccounts are the names of all accounts, which are now signed by the new signing key.
+	ResignedAccounts []string `json:"resignedAccounts" yaml:"resignedAccounts"`
+	// NatsConfigFile contains the new operator JWT; it must be deployed to the NATS servers.
+	NatsConfigFile string   `json:"natsConfigFile" yaml:"natsConfigFile"`
+	Pushed         bool     `json:"pushed" yaml:"pushed"`
+	Warnings       warnings `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// OperatorEditResult is printed by operator edit.
+type OperatorEditResult struct {
+	Operator string `json:"operator" yaml:"operator"`
+	// CreatedKeys are the public keys of the newly created (and encrypted) operator signing keys.
+	CreatedKeys        []string `json:"createdKeys" yaml:"createdKeys"`
+	RemovedSigningKeys []string `json:"removedSigningKeys" yaml:"removedSigningKeys"`
+	JwtFile            string   `json:"jwtFile" yaml:"jwtFile"`
+	// NatsConfigFile contains the new operator JWT; it must be deployed to the NATS servers.
+	NatsConfigFile string   `json:"natsConfigFile" yaml:"natsConfigFile"`
+	Warnings       warnings `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// RecoverRootResult is printed by operator recover-root; the root seed itself is only printed to the terminal, or
+// written to SeedFile.
+type RecoverRootResult struct {
+	Operator      string   `json:"operator" yaml:"operator"`
+	RootPublicKey string   `json:"rootPublicKey" yaml:"rootPublicKey"`
+	SharesUsed    int      `json:"sharesUsed" yaml:"sharesUsed"`
+	SeedFile      string   `json:"seedFile,omitempty" yaml:"seedFile,omitempty"`
+	Warnings      warnings `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// ImportNscResult is printed by import-nsc.
+type ImportNscResult struct {
+	Operators []string `json:"operators" yaml:"operators"`
+	// ImportedKeys are the public keys of all seeds which were encrypted into the key store.
+	ImportedKeys []string `json:"importedKeys" yaml:"importedKeys"`
+	// MissingSigningKeys are referenced by a JWT, but nsc had no seed for them.
+	MissingSigningKeys []string `json:"missingSigningKeys" yaml:"missingSigningKeys"`
+	// UnmatchedKeys are seeds of nsc which belong to no imported JWT; they were not imported.
+	UnmatchedKeys []string `json:"unmatchedKeys" yaml:"unmatchedKeys"`
+	// RootKeyFiles are the plaintext operator root keys of nsc; they are neither imported nor deleted.
+	RootKeyFiles []string `json:"rootKeyFiles" yaml:"rootKeyFiles"`
+	// DeletedFiles are the plaintext .nk and .creds files of nsc which were deleted with --delete-plaintext.
+	DeletedFiles []string `json:"deletedFiles" yaml:"deletedFiles"`
+	Warnings     warnings `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// CloneOperatorResult is printed by operator clone. As with init-operator, the private root key is only printed to
+// the terminal, or split into RootKeyShares, which are written to RootKeySheets with --root-key-sheets-dir.
+type CloneOperatorResult struct {
+	Source                 string          `json:"source" yaml:"source"`
+	Operator               string          `json:"operator" yaml:"operator"`
+	OperatorPublicKey      string          `json:"operatorPublicKey" yaml:"operatorPublicKey"`
+	OperatorSigningKey     string          `json:"operatorSigningKey" yaml:"operatorSigningKey"`
+	SystemAccountPublicKey string          `json:"systemAccountPublicKey" yaml:"systemAccountPublicKey"`
+	Accounts               []ClonedAccount `json:"accounts" yaml:"accounts"`
+	NatsConfigFile         string          `json:"natsConfigFile" yaml:"natsConfigFile"`
+	RootKeyShares          string          `json:"rootKeyShares,omitempty" yaml:"rootKeyShares,omitempty"`
+	RootKeySheets          []string        `json:"rootKeySheets,omitempty" yaml:"rootKeySheets,omitempty"`
+	Warnings               warnings        `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// ClonedAccount maps an account of the source operator to its clone.
+type ClonedAccount struct {
+	Account         string `json:"account" yaml:"account"`
+	SourcePublicKey string `json:"sourcePublicKey" yaml:"sourcePublicKey"`
+	PublicKey       string `json:"publicKey" yaml:"publicKey"`
+}
+
+// OperatorListItem is printed by ls operators.
+type OperatorListItem struct {
+	Name        string `json:"name" yaml:"name"`
+	PublicKey   string `json:"publicKey" yaml:"publicKey"`
+	SigningKeys int    `json:"signingKeys" yaml:"signingKeys"`
+	Accounts    int    `json:"accounts" yaml:"accounts"`
+	// IssuedAt and Expires are RFC 3339; Expires is empty if the JWT does not expire.
+	IssuedAt string `json:"issuedAt,omitempty" yaml:"issuedAt,omitempty"`
+	Expires  string `json:"expires,omitempty" yaml:"expires,omitempty"`
+}
+
+// AccountListItem is printed by ls accounts.
+type AccountListItem struct {
+	Name        string `json:"name" yaml:"name"`
+	PublicKey   string `json:"publicKey" yaml:"publicKey"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// SigningKeys counts all signing keys, Roles only the scoped ones.
+	SigningKeys int    `json:"signingKeys" yaml:"signingKeys"`
+	Roles       int    `json:"roles" yaml:"roles"`
+	IssuedAt    string `json:"issuedAt,omitempty" yaml:"issuedAt,omitempty"`
+	Expires     string `json:"expires,omitempty" yaml:"expires,omitempty"`
+}
+
+// RoleListItem is printed by ls roles.
+type RoleListItem struct {
+	Role        string          `json:"role" yaml:"role"`
+	SigningKey  string          `json:"signingKey" yaml:"signingKey"`
+	Permissions rolePermissions `json:"permissions" yaml:"permissions"`
+}
+
+// UserListItem is printed by ls users.
+type UserListItem struct {
+	Name      string `json:"name" yaml:"name"`
+	PublicKey string `json:"publicKey" yaml:"publicKey"`
+	// Role is empty for users issued by an un-scoped key (f.e. admin users).
+	Role     string `json:"role,omitempty" yaml:"role,omitempty"`
+	IssuedAt string `json:"issuedAt,omitempty" yaml:"issuedAt,omitempty"`
+	Expires  string `json:"expires,omitempty" yaml:"expires,omitempty"`
+	// File is the .creds file (or the user JWT in the nsc store) the user was read from.
+	File string `json:"file" yaml:"file"`
+}
+
+// DoctorFinding is a single result of doctor.
+type DoctorFinding struct {
+	Check string `json:"check" yaml:"check"`
+	// Status is ok, warning or problem; only problems make doctor fail.
+	Status  string `json:"status" yaml:"status"`
+	Message string `json:"message" yaml:"message"`
+	// Fix is an actionable hint; empty for ok.
+	Fix string `json:"fix,omitempty" yaml:"fix,omitempty"`
+}
+
+// DoctorResult is printed by doctor.
+type DoctorResult struct {
+	Findings []DoctorFinding `json:"findings" yaml:"findings"`
+	Problems int             `json:"problems" yaml:"problems"`
+	Warnings int             `json:"warnings" yaml:"warnings"`
+}
+
+// DryRunResult is printed by the commands supporting --dry-run, instead of their result object.
+type DryRunResult struct {
+	Jwts []JwtDiff `json:"jwts" yaml:"jwts"`
+}
+
+// JwtDiff are the changes of a single JWT.
+type JwtDiff struct {
+	// Name is f.e. "account SANDSTORM".
+	Name    string        `json:"name" yaml:"name"`
+	File    string        `json:"file" yaml:"file"`
+	Created bool          `json:"created" yaml:"created"`
+	Changes []ClaimChange `json:"changes" yaml:"changes"`
+}
+
+// ClaimChange is a changed field of the claims; Path is the JSON path (f.e. nats.limits.conn). Before is empty for
+// added fields and list elements, After for removed ones.
+type ClaimChange struct {
+	Path   string `json:"path" yaml:"path"`
+	Before any    `json:"before,omitempty" yaml:"before,omitempty"`
+	After  any    `json:"after,omitempty" yaml:"after,omitempty"`
+}
@@ -1,79 +1,213 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"github.com/bitfield/script"
+	"github.com/nats-io/jwt/v2"
 	"github.com/pterm/pterm"
+	"github.com/sandstorm/natsCtl/cli/common"
 	"github.com/sandstorm/natsCtl/cli/config"
+	"github.com/sandstorm/natsCtl/cli/transaction"
 	"github.com/spf13/cobra"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
 	"syscall"
 )
 
 func newPullCmd(cfg config.Config) *cobra.Command {
-	return &cobra.Command{
+	var operatorFlag string
+	cmd := &cobra.Command{
 		Use:   "pull",
-		Short: "A brief description of your command",
-		Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			cfg.MasterPasswordDecryptor().Unlock()
-			operator := chooseOperator()
-
-			NscPullInt(operator, cfg.MasterPasswordDecryptor())
+		Short: "Pull all account JWTs of an operator from its account server",
+		Long: `Pull all account JWTs of an operator from its account server (the AccountServerURL of the operator).
+
+A JWT is only taken over if it is signed by the operator, and is not older than the local JWT. If the account
+server is not reachable, the local JWTs are kept.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			if err := unlock(&cfg); err != nil {
+				return err
+			}
+			operator := OperatorName(flagOrEnv(operatorFlag, "OPERATOR_NAME"))
+			if operator == "" {
+				if operator, err = chooseOperator(&cfg); err != nil {
+					return err
+				}
+			}
+
+			result, err := PullInt(operator, &cfg)
+			if err != nil {
+				return err
+			}
+			if !result.Pulled {
+				result.Warnings.Printfln("Continuing with local JWTs because Pull did not work")
+			}
+			return printResult(result)
 		},
 	}
+	cmd.Flags().StringVar(&operatorFlag, "operator", "", "operator name (env: OPERATOR_NAME)")
+	registerStoreCompletions(cmd, &cfg)
+	return cmd
 }
 
-func NscPullInt(operator OperatorName, masterPasswordDecryptor config.MasterPasswordDecryptor) {
-	setupNsc(operator)
+// PullInt pulls all account JWTs of the operator from the account server; Pulled is false
+// if the account server was not reachable, and the local JWTs are used.
+func PullInt(operator OperatorName, cfg *config.Config) (PullResult, error) {
+	result := PullResult{Operator: string(operator), Accounts: []string{}}
+	operatorClaims, err := readOperator(cfg, operator)
+	if err != nil {
+		return result, err
+	}
+	resolver, err := connectResolver(operator, cfg)
+	if errors.Is(err, errUnreachable) {
+		result.Warnings.Printfln("%s", err)
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	defer resolver.Close()
 
-	sysAccountSk := getAccountSigningKey(readAccount(operator, "SYS"))
-	nkey := decryptNkey(sysAccountSk, masterPasswordDecryptor)
-	writeUnencryptedNkey(nkey)
-	defer rmUnencryptedNkey(nkey)
+	// the local accounts by public key; as the account server does not know the names of the directories.
+	local := map[string]AccountName{}
+	accounts, err := getAccounts(cfg, operator)
+	if err != nil {
+		return result, err
+	}
+	for _, a := range accounts {
+		accountClaims, err := readAccount(cfg, operator, AccountName(a))
+		if err != nil {
+			return result, err
+		}
+		local[accountClaims.Subject] = AccountName(a)
+	}
 
-	_, err := script.Exec("nsc pull -A").Stdout()
+	pubKeys, err := resolver.List()
 	if err != nil {
-		pterm.Warning.Println("Continuing with local JWTs because Pull did not work")
+		return result, fmt.Errorf("%w: listing accounts: %w", common.ErrAccountServer, err)
+	}
+	if pubKeys == nil {
+		// the HTTP account server cannot list its accounts; so we only update the local ones.
+		for pubKey := range local {
+			pubKeys = append(pubKeys, pubKey)
+		}
+	}
+	sort.Strings(pubKeys)
+
+	tx := transaction.New()
+	defer tx.Rollback()
+	for _, pubKey := range pubKeys {
+		remoteJwt, err := resolver.Lookup(pubKey)
+		if err != nil {
+			return result, fmt.Errorf("%w: looking up account %s: %w", common.ErrAccountServer, pubKey, err)
+		}
+		if remoteJwt == "" {
+			continue
+		}
+		claims, err := jwt.DecodeAccountClaims(remoteJwt)
+		if err != nil {
+			result.Warnings.Printfln("Skipped account %s: decoding its JWT failed: %s", pubKey, err)
+			continue
+		}
+		if claims.Subject != pubKey {
+			result.Warnings.Printfln("Skipped account %s: the account server returned the JWT of %s", pubKey, claims.Subject)
+			continue
+		}
+		if claims.Issuer != operatorClaims.Subject && !operatorClaims.SigningKeys.Contains(claims.Issuer) {
+			result.Warnings.Printfln("Skipped account %s: it is not signed by operator %s", pubKey, operator)
+			continue
+		}
+
+		account, exists := local[pubKey]
+		if !exists {
+			account = AccountName(claims.Name)
+			if !isDirectoryName(string(account)) || ExistsAccount(cfg, operator, account) {
+				result.Warnings.Printfln("Skipped account %s: its name %q is invalid or already taken by another account", pubKey, claims.Name)
+				continue
+			}
+		} else {
+			localJwt, err := os.ReadFile(accountJwtPath(cfg, operator, account))
+			if err != nil {
+				return result, err
+			}
+			if strings.TrimSpace(string(localJwt)) == remoteJwt {
+				continue
+			}
+			localClaims, err := readAccount(cfg, operator, account)
+			if err != nil {
+				return result, err
+			}
+			if localClaims.IssuedAt > claims.IssuedAt {
+				result.Warnings.Printfln("Kept the local JWT of account %s, as it is newer than the one on the account server; push it", account)
+				continue
+			}
+		}
+		if err := tx.WriteFile(accountJwtPath(cfg, operator, account), []byte(remoteJwt), 0644); err != nil {
+			return result, err
+		}
+		pterm.Success.Printfln("Pulled account %s (%s)", account, pubKey)
+		result.Accounts = append(result.Accounts, string(account))
+	}
+	if err := tx.Commit(); err != nil {
+		return result, err
 	}
+	result.Pulled = true
+	return result, nil
 }
 
-func setupNsc(operator OperatorName) {
-	workingDir, err := os.Getwd()
-	panicOnErr(err)
-	panicOnErr(os.Setenv("NKEYS_PATH", workingDir+"/nsc/nkeys"))
-	panicOnErr(os.Setenv("NSC_HOME", workingDir+"/nsc/home"))
-	panicOnErr(os.MkdirAll(workingDir+"/nsc/nkeys", 0700))
+// isDirectoryName checks that the name of a remote account can be used as directory in accounts/, without escaping it.
+func isDirectoryName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`) && filepath.Base(name) == name
+}
+
+func setupNsc(cfg *config.Config, operator OperatorName) error {
+	if err := os.Setenv("NKEYS_PATH", cfg.StorePath("nkeys")); err != nil {
+		return err
+	}
+	if err := os.Setenv("NSC_HOME", cfg.StorePath("home")); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cfg.StorePath("nkeys"), 0700); err != nil {
+		return err
+	}
 
-	_, err = script.Exec(fmt.Sprintf("nsc env -s '%s/nsc/store'", workingDir)).String()
-	panicOnErr(err)
+	if _, err := script.Exec(fmt.Sprintf("nsc env -s '%s'", cfg.StorePath("store"))).String(); err != nil {
+		return fmt.Errorf("%w: nsc env -s: %w", common.ErrNsc, err)
+	}
 
 	if operator != "" {
-		_, err = script.Exec(fmt.Sprintf("nsc env -o %s", operator)).String()
-		panicOnErr(err)
+		if _, err := script.Exec(fmt.Sprintf("nsc env -o %s", operator)).String(); err != nil {
+			return fmt.Errorf("%w: nsc env -o %s: %w", common.ErrNsc, operator, err)
+		}
 	}
+	return nil
 }
 
-func Nsc() {
-	setupNsc("")
+func Nsc(cfg *config.Config) error {
+	if err := setupNsc(cfg, ""); err != nil {
+		return err
+	}
 	nscPath, err := exec.LookPath("nsc")
-	panicOnErr(err)
+	if err != nil {
+		return fmt.Errorf("%w: %w", common.ErrNsc, err)
+	}
 
 	args := os.Args[2:]
 	err = syscall.Exec(nscPath, append([]string{"nsc"}, args...), os.Environ())
-	panicOnErr(err)
+	return fmt.Errorf("%w: %w", common.ErrNsc, err)
 }
 
-func NscSwitchOperator() {
+func NscSwitchOperator(cfg *config.Config) error {
 	operator := OperatorName(os.Getenv("OPERATOR_NAME"))
 	if operator == "" {
-		operator = chooseOperator()
+		var err error
+		if operator, err = chooseOperator(cfg); err != nil {
+			return err
+		}
 	}
-	setupNsc(operator)
+	return setupNsc(cfg, operator)
 }
@@ -0,0 +1,22 @@
+package cmd
+
+import "testing"
+
+func TestIsDirectoryName(t *testing.T) {
+	for name, expected := range map[string]bool{
+		"SANDSTORM":    true,
+		"billing.prod": true,
+		"..hidden":     true,
+		"":             false,
+		".":            false,
+		"..":           false,
+		"../escape":    false,
+		"a/b":          false,
+		`a\b`:          false,
+		"/abs":         false,
+	} {
+		if isDirectoryName(name) != expected {
+			t.Errorf("%q: expected %v", name, expected)
+		}
+	}
+}
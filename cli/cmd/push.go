@@ -1,33 +1,141 @@
 package cmd
 
 import (
-	"github.com/bitfield/script"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/pterm/pterm"
+	"github.com/sandstorm/natsCtl/cli/common"
 	"github.com/sandstorm/natsCtl/cli/config"
 	"github.com/spf13/cobra"
 )
 
 func newPushCmd(cfg config.Config) *cobra.Command {
-	return &cobra.Command{
+	var operatorFlag string
+	cmd := &cobra.Command{
 		Use:   "push",
-		Short: "A brief description of your command",
-		Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			cfg.MasterPasswordDecryptor().Unlock()
-			operator := chooseOperator()
-			setupNsc(operator)
-
-			sysAccountSk := getAccountSigningKey(readAccount(operator, "SYS"))
-			nkey := decryptNkey(sysAccountSk, cfg.MasterPasswordDecryptor())
-			writeUnencryptedNkey(nkey)
-			defer rmUnencryptedNkey(nkey)
-
-			_, err := script.Exec("nsc push -A --diff").Stdout()
-			panicOnErr(err)
+		Short: "Push all account JWTs of an operator to its account server",
+		Long: `Push all account JWTs of an operator to its account server (the AccountServerURL of the operator).
+
+For the NATS resolver, the connection is authenticated with a short-lived SYS user, which is signed in memory
+with the signing key of the SYS account. Before each account is uploaded, the changes to the JWT on the account
+server are printed field by field. Accounts which only exist on the account server are listed as warning.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := unlock(&cfg); err != nil {
+				return err
+			}
+			operator := OperatorName(flagOrEnv(operatorFlag, "OPERATOR_NAME"))
+			if operator == "" {
+				var err error
+				if operator, err = chooseOperator(&cfg); err != nil {
+					return err
+				}
+			}
+
+			result, err := pushAccounts(operator, &cfg)
+			if err != nil {
+				return err
+			}
+			return printResult(result)
 		},
 	}
+	cmd.Flags().StringVar(&operatorFlag, "operator", "", "operator name (env: OPERATOR_NAME)")
+	registerStoreCompletions(cmd, &cfg)
+	return cmd
+}
+
+// pushAccounts pushes all account JWTs of the operator to the account server, and prints the changes to the JWTs
+// on the account server; and warns about accounts which only exist on the account server.
+func pushAccounts(operator OperatorName, cfg *config.Config) (PushResult, error) {
+	result := PushResult{Operator: string(operator), Accounts: []string{}, Diffs: []JwtDiff{}}
+	resolver, err := connectResolver(operator, cfg)
+	if err != nil {
+		return result, fmt.Errorf("%w: %w", common.ErrAccountServer, err)
+	}
+	defer resolver.Close()
+
+	accounts, err := getAccounts(cfg, operator)
+	if err != nil {
+		return result, err
+	}
+	local := map[string]bool{}
+	var errs []error
+	for _, a := range accounts {
+		account := AccountName(a)
+		accountJwt, err := os.ReadFile(accountJwtPath(cfg, operator, account))
+		if err != nil {
+			return result, err
+		}
+		accountClaims, err := readAccount(cfg, operator, account)
+		if err != nil {
+			return result, err
+		}
+		local[accountClaims.Subject] = true
+		if diff, err := diffRemoteAccount(cfg, resolver, operator, accountClaims); err != nil {
+			result.Warnings.Printfln("Could not compare account %s with the account server: %s", account, err)
+		} else {
+			result.Diffs = append(result.Diffs, diff)
+		}
+		if err := resolver.Push(accountClaims.Subject, strings.TrimSpace(string(accountJwt))); err != nil {
+			pterm.Error.Printfln("Pushing account %s failed: %s", account, err)
+			errs = append(errs, fmt.Errorf("account %s: %w", account, err))
+			continue
+		}
+		pterm.Success.Printfln("Pushed account %s (%s)", account, accountClaims.Subject)
+		result.Accounts = append(result.Accounts, a)
+	}
+	if len(errs) > 0 {
+		return result, fmt.Errorf("%w: push: %w", common.ErrAccountServer, errors.Join(errs...))
+	}
+
+	remote, err := resolver.List()
+	if err != nil {
+		result.Warnings.Printfln("Could not list the accounts of the account server: %s", err)
+	}
+	for _, pubKey := range remote {
+		if !local[pubKey] {
+			result.UnknownAccounts = append(result.UnknownAccounts, pubKey)
+		}
+	}
+	sort.Strings(result.UnknownAccounts)
+	for _, pubKey := range result.UnknownAccounts {
+		result.Warnings.Printfln("Account %s only exists on the account server; run pull to get it", pubKey)
+	}
+	return result, nil
+}
+
+// diffRemoteAccount prints the changes of the local account JWT compared with the one on the account server.
+func diffRemoteAccount(cfg *config.Config, resolver accountResolver, operator OperatorName, accountClaims *jwt.AccountClaims) (JwtDiff, error) {
+	diff := JwtDiff{
+		Name: fmt.Sprintf("account %s", accountClaims.Name),
+		File: accountJwtPath(cfg, operator, AccountName(accountClaims.Name)),
+	}
+	remoteJwt, err := resolver.Lookup(accountClaims.Subject)
+	if err != nil {
+		return diff, err
+	}
+	var remoteClaims *jwt.AccountClaims
+	if remoteJwt == "" {
+		diff.Created = true
+	} else if remoteClaims, err = jwt.DecodeAccountClaims(remoteJwt); err != nil {
+		return diff, fmt.Errorf("decoding JWT of the account server: %w", err)
+	}
+	if diff.Changes, err = diffClaims(remoteClaims, accountClaims); err != nil {
+		return diff, err
+	}
+	switch {
+	case diff.Created:
+		pterm.Printfln("%s is new on the account server", bold.Sprint(diff.Name))
+	case len(diff.Changes) == 0:
+		pterm.Printfln("%s is unchanged on the account server", bold.Sprint(diff.Name))
+		return diff, nil
+	default:
+		pterm.Printfln("%s changes on the account server:", bold.Sprint(diff.Name))
+	}
+	printChanges(diff.Changes)
+	return diff, nil
 }
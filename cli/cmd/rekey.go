@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"filippo.io/age"
+	"fmt"
+	"github.com/pterm/pterm"
+	"github.com/sandstorm/natsCtl/cli/agent"
+	"github.com/sandstorm/natsCtl/cli/common"
+	"github.com/sandstorm/natsCtl/cli/config"
+	"github.com/sandstorm/natsCtl/cli/keystore"
+	"github.com/sandstorm/natsCtl/cli/transaction"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+func newRekeyCmd(cfg config.Config) *cobra.Command {
+	var recipientsFile string
+	var recipients []string
+	var newIdentityFile string
+	var generateIdentity bool
+
+	cmd := &cobra.Command{
+		Use:   "rekey",
+		Short: "Re-encrypts all stored NKeys to a new master key or recipient set.",
+		Long: `Decrypts every NKey in the key store with the current master key, and re-encrypts it
+to the new recipients.
+
+The new recipients are (in this order):
+- --recipients-file, --recipient and --new-identity-file, if specified
+- a freshly generated AGE identity with --generate-identity (printed once)
+- otherwise the currently configured recipients (recipientsFile in natsUtilsCfg.json, or the master key);
+  f.e. after removing an admin from the recipients file.
+
+Every re-encrypted file is verified by decrypting it again. The files are only replaced if all keys could be
+re-encrypted; otherwise, no key is changed. For verification, one of the new recipients must match the current
+master key or the --new-identity-file.
+
+With --generate-identity or --new-identity-file, the keys can only be decrypted with the new identity afterwards:
+store it where the master key is configured (printed at the end), and restart a running agent.
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			if err := unlock(&cfg); err != nil {
+				return err
+			}
+
+			// additional identities (apart from the master key) which can be used to verify the round trip
+			var verificationIdentities []age.Identity
+
+			var newRecipients []age.Recipient
+			if len(recipientsFile) > 0 {
+				r, err := config.ParseRecipientsFile(recipientsFile)
+				if err != nil {
+					return fmt.Errorf("%w: %w", common.ErrValidation, err)
+				}
+				newRecipients = append(newRecipients, r...)
+			}
+			for _, recipient := range recipients {
+				r, err := config.ParseRecipient(recipient)
+				if err != nil {
+					return fmt.Errorf("%w: %w", common.ErrValidation, err)
+				}
+				newRecipients = append(newRecipients, r)
+			}
+			if len(newIdentityFile) > 0 {
+				identity, err := os.ReadFile(newIdentityFile)
+				if err != nil {
+					return fmt.Errorf("%w: %w", common.ErrValidation, err)
+				}
+				ids, err := config.ParseIdentities(string(identity))
+				if err != nil {
+					return fmt.Errorf("%w: %s: %w", common.ErrValidation, newIdentityFile, err)
+				}
+				r, err := config.IdentitiesToRecipients(ids)
+				if err != nil {
+					return fmt.Errorf("%w: %s: %w", common.ErrValidation, newIdentityFile, err)
+				}
+				newRecipients = append(newRecipients, r...)
+				verificationIdentities = append(verificationIdentities, ids...)
+			}
+			if generateIdentity {
+				k, err := age.GenerateX25519Identity()
+				if err != nil {
+					return err
+				}
+				pterm.Warning.Printfln("Generated a new AGE identity. THIS IS THE ONLY COPY - store it in your master key storage:")
+				pterm.Printfln("")
+				pterm.Printfln("       %s", k)
+				pterm.Printfln("")
+				newRecipients = append(newRecipients, k.Recipient())
+				verificationIdentities = append(verificationIdentities, k)
+			}
+			if len(newRecipients) == 0 {
+				pterm.Info.Println("No new recipients specified; re-encrypting to the currently configured recipients.")
+				newRecipients, err = cfg.EncryptionRecipients()
+				if err != nil {
+					return fmt.Errorf("%w: recipients: %w", common.ErrConfig, err)
+				}
+			}
+
+			store, ok := cfg.KeyStore().(*keystore.AgeDirStore)
+			if !ok {
+				return fmt.Errorf("%w: rekey is only supported for the AGE encrypted key directory, not for %T", common.ErrConfig, cfg.KeyStore())
+			}
+			newCipher := &rekeyCipher{
+				recipients: newRecipients,
+				identities: verificationIdentities,
+				master:     cfg.MasterKeyCipher(),
+			}
+
+			pubKeys, err := store.List()
+			if err != nil {
+				return err
+			}
+
+			// all keys are switched together: if only some were re-encrypted to a new identity, the store could
+			// neither be used with the old nor with the new master key.
+			tx := transaction.New()
+			defer tx.Rollback()
+			staged := store.WithWriter(tx)
+
+			var failed []string
+			for _, pubKey := range pubKeys {
+				if err := staged.Rekey(pubKey, newCipher); err != nil {
+					pterm.Error.Printfln("%s: %s", store.Path(pubKey), err)
+					failed = append(failed, store.Path(pubKey))
+					continue
+				}
+				pterm.Success.Printfln("Verified %s", store.Path(pubKey))
+			}
+			if len(failed) > 0 {
+				if generateIdentity {
+					pterm.Warning.Printfln("Discard the generated identity; no key was encrypted to it.")
+				}
+				return fmt.Errorf("%w: %d of %d keys could not be re-encrypted; no key was changed:\n%s", common.ErrDecryption, len(failed), len(pubKeys), strings.Join(failed, "\n"))
+			}
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+			pterm.Success.Printfln("Re-encrypted all %d keys.", len(pubKeys))
+
+			if generateIdentity || len(newIdentityFile) > 0 {
+				printMasterKeyUpdate(&cfg)
+			}
+			if len(cfg.RecipientsFile) > 0 && (len(recipientsFile) > 0 || len(recipients) > 0 || generateIdentity || len(newIdentityFile) > 0) {
+				pterm.Warning.Printfln("Update the recipients file %s (recipientsFile in %s) to the new recipients - new keys are encrypted to it.", cfg.RecipientsFile, config.NatsUtilsConfigFile)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&recipientsFile, "recipients-file", "", "file with the new recipients (AGE or SSH public keys, one per line)")
+	cmd.Flags().StringArrayVar(&recipients, "recipient", nil, "new recipient (AGE or SSH public key); can be specified multiple times")
+	cmd.Flags().StringVar(&newIdentityFile, "new-identity-file", "", "file with the new AGE identity; used as recipient and for verification")
+	cmd.Flags().BoolVar(&generateIdentity, "generate-identity", false, "generate a new AGE identity and re-encrypt to it")
+	return cmd
+}
+
+// printMasterKeyUpdate tells which entry must contain the new identity after rekeying - otherwise, no key can be
+// decrypted anymore.
+func printMasterKeyUpdate(cfg *config.Config) {
+	pterm.Warning.Printfln("All keys are now encrypted to the new identity. Replace the master key in %s with it.", cfg.MasterKeyLocation())
+	if cfg.Agent() != nil {
+		pterm.Warning.Printfln("The running agent (%s) still holds the old identity - stop it, and start it again.", agent.SocketEnvVar)
+	}
+}
+
+// rekeyCipher encrypts to the new recipients. For verifying the round trip, it decrypts with the additional
+// identities (f.e. a newly generated one), or with the current master key.
+type rekeyCipher struct {
+	recipients []age.Recipient
+	identities []age.Identity
+	master     keystore.Cipher
+}
+
+func (r *rekeyCipher) Encrypt(plaintext []byte) ([]byte, error) {
+	return keystore.EncryptArmored(plaintext, r.recipients)
+}
+
+func (r *rekeyCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	if len(r.identities) > 0 {
+		if plaintext, err := keystore.DecryptArmored(ciphertext, r.identities); err == nil {
+			return plaintext, nil
+		}
+	}
+	plaintext, err := r.master.Decrypt(ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("none of the available identities matches the new recipients: %w", err)
+	}
+	return plaintext, nil
+}
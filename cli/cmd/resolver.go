@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/sandstorm/natsCtl/cli/common"
+	"github.com/sandstorm/natsCtl/cli/config"
+)
+
+const resolverTimeout = 2 * time.Second
+
+// accountResolver pushes account JWTs to, and pulls them from the account server of an operator (its
+// AccountServerURL): either the NATS resolver of the servers, or an HTTP account server.
+type accountResolver interface {
+	// Push uploads the account JWT; it fails if the account server (or one of the servers) rejected it.
+	Push(pubKey string, accountJwt string) error
+	// List returns the public keys of all accounts known to the account server; nil if it cannot list them.
+	List() ([]string, error)
+	// Lookup returns the account JWT; or an empty string if the account server does not know the account.
+	Lookup(pubKey string) (string, error)
+	Close()
+}
+
+// errUnreachable is returned by connectResolver if the account server could not be reached.
+var errUnreachable = errors.New("account server not reachable")
+
+// connectResolver connects to the account server of the operator. For the NATS resolver, a short-lived user of the
+// SYS account is created and signed in memory with the signing key of the SYS account; the seed never touches disk.
+func connectResolver(operator OperatorName, cfg *config.Config) (accountResolver, error) {
+	operatorClaims, err := readOperator(cfg, operator)
+	if err != nil {
+		return nil, err
+	}
+	url := operatorClaims.AccountServerURL
+	switch {
+	case url == "":
+		return nil, fmt.Errorf("%w: operator %s has no account server URL", common.ErrValidation, operator)
+	case strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://"):
+		return &httpResolver{url: strings.TrimSuffix(url, "/")}, nil
+	}
+
+	sysAccount, err := readAccount(cfg, operator, "SYS")
+	if err != nil {
+		return nil, err
+	}
+	sysAccountSk, err := getAccountSigningKey(sysAccount)
+	if err != nil {
+		return nil, err
+	}
+	sysSigningKey, err := loadKey(cfg, sysAccountSk)
+	if err != nil {
+		return nil, err
+	}
+	defer sysSigningKey.Wipe()
+
+	userKey, err := nkeys.CreateUser()
+	if err != nil {
+		return nil, err
+	}
+	userClaims := jwt.NewUserClaims(PublicKey(userKey))
+	userClaims.Name = "natsctl"
+	userClaims.IssuerAccount = sysAccount.Subject
+	userClaims.Expires = time.Now().Add(5 * time.Minute).Unix()
+	userJwt, err := userClaims.Encode(sysSigningKey)
+	if err != nil {
+		return nil, fmt.Errorf("signing SYS user: %w", err)
+	}
+
+	nc, err := nats.Connect(url,
+		nats.Name("natsctl"),
+		nats.Timeout(resolverTimeout),
+		nats.NoReconnect(),
+		nats.UserJWT(func() (string, error) {
+			return userJwt, nil
+		}, func(nonce []byte) ([]byte, error) {
+			return userKey.Sign(nonce)
+		}),
+	)
+	if err != nil {
+		userKey.Wipe()
+		return nil, fmt.Errorf("%w: %s: %w", errUnreachable, url, err)
+	}
+	return &natsResolver{nc: nc, userKey: userKey}, nil
+}
+
+// natsResolver uses the $SYS.REQ API of the NATS resolver.
+type natsResolver struct {
+	nc      *nats.Conn
+	userKey nkeys.KeyPair
+}
+
+// resolverResponse is the reply of a server to a $SYS.REQ request.
+type resolverResponse struct {
+	Server struct {
+		Name string `json:"name"`
+	} `json:"server"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error,omitempty"`
+}
+
+// requestAll sends the request, and collects the responses of all servers in the cluster.
+func (r *natsResolver) requestAll(subject string, payload []byte) ([]*nats.Msg, error) {
+	inbox := r.nc.NewInbox()
+	sub, err := r.nc.SubscribeSync(inbox)
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Unsubscribe()
+	if err := r.nc.PublishRequest(subject, inbox, payload); err != nil {
+		return nil, err
+	}
+	var responses []*nats.Msg
+	// wait for the first response; afterwards, only shortly for the other servers.
+	wait := resolverTimeout
+	for {
+		msg, err := sub.NextMsg(wait)
+		if errors.Is(err, nats.ErrTimeout) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, msg)
+		wait = 250 * time.Millisecond
+	}
+	if len(responses) == 0 {
+		return nil, fmt.Errorf("no response to %s (is the NATS resolver configured?)", subject)
+	}
+	return responses, nil
+}
+
+func (r *natsResolver) Push(pubKey string, accountJwt string) error {
+	responses, err := r.requestAll(fmt.Sprintf("$SYS.REQ.ACCOUNT.%s.CLAIMS.UPDATE", pubKey), []byte(accountJwt))
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, msg := range responses {
+		var response resolverResponse
+		if err := json.Unmarshal(msg.Data, &response); err != nil {
+			errs = append(errs, fmt.Errorf("unexpected response: %w", err))
+		} else if response.Error != nil {
+			errs = append(errs, fmt.Errorf("server %s: %s (%d)", response.Server.Name, response.Error.Description, response.Error.Code))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *natsResolver) List() ([]string, error) {
+	responses, err := r.requestAll("$SYS.REQ.CLAIMS.LIST", nil)
+	if err != nil {
+		return nil, err
+	}
+	// every server knows all accounts with the full resolver; so we merge the lists.
+	seen := map[string]bool{}
+	var pubKeys []string
+	for _, msg := range responses {
+		var response resolverResponse
+		var list []string
+		if err := json.Unmarshal(msg.Data, &response); err != nil {
+			return nil, fmt.Errorf("unexpected response: %w", err)
+		}
+		if response.Error != nil {
+			return nil, fmt.Errorf("server %s: %s (%d)", response.Server.Name, response.Error.Description, response.Error.Code)
+		}
+		if err := json.Unmarshal(response.Data, &list); err != nil {
+			return nil, fmt.Errorf("unexpected response: %w", err)
+		}
+		for _, pubKey := range list {
+			if !seen[pubKey] {
+				seen[pubKey] = true
+				pubKeys = append(pubKeys, pubKey)
+			}
+		}
+	}
+	return pubKeys, nil
+}
+
+func (r *natsResolver) Lookup(pubKey string) (string, error) {
+	msg, err := r.nc.Request(fmt.Sprintf("$SYS.REQ.ACCOUNT.%s.CLAIMS.LOOKUP", pubKey), nil, resolverTimeout)
+	if err != nil {
+		return "", err
+	}
+	// the JWT is returned as-is; an unknown account is an empty response.
+	return strings.TrimSpace(string(msg.Data)), nil
+}
+
+func (r *natsResolver) Close() {
+	r.nc.Close()
+	r.userKey.Wipe()
+}
+
+// httpResolver uses the REST API of the (deprecated) nats-account-server; it does not need any key.
+type httpResolver struct {
+	url string
+}
+
+func (r *httpResolver) Push(pubKey string, accountJwt string) error {
+	resp, err := http.Post(r.url+"/accounts/"+pubKey, "application/jwt", bytes.NewReader([]byte(accountJwt)))
+	if err != nil {
+		return fmt.Errorf("%w: %w", errUnreachable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (r *httpResolver) List() ([]string, error) {
+	return nil, nil
+}
+
+func (r *httpResolver) Lookup(pubKey string) (string, error) {
+	resp, err := http.Get(r.url + "/accounts/" + pubKey)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errUnreachable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+func (r *httpResolver) Close() {}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/sandstorm/natsCtl/cli/common"
+	"github.com/sandstorm/natsCtl/cli/transaction"
+)
+
+// fakeAccountServer implements the REST API of the nats-account-server.
+type fakeAccountServer struct {
+	mu       sync.Mutex
+	accounts map[string]string
+}
+
+func newFakeAccountServer(t *testing.T) (*fakeAccountServer, *httptest.Server) {
+	t.Helper()
+	s := &fakeAccountServer{accounts: map[string]string{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pubKey, ok := strings.CutPrefix(r.URL.Path, "/accounts/")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch r.Method {
+		case http.MethodPost:
+			body, _ := io.ReadAll(r.Body)
+			if _, err := jwt.DecodeAccountClaims(string(body)); err != nil {
+				http.Error(w, "invalid account JWT", http.StatusBadRequest)
+				return
+			}
+			s.accounts[pubKey] = string(body)
+		case http.MethodGet:
+			accountJwt, ok := s.accounts[pubKey]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = io.WriteString(w, accountJwt+"\n")
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return s, server
+}
+
+func TestHttpResolver(t *testing.T) {
+	o := newTestOperator(t, "OP")
+	_, server := newFakeAccountServer(t)
+	o.claims.AccountServerURL = server.URL + "/"
+	tx := transaction.New()
+	if _, err := writeOperator(o.cfg, tx, o.name, o.claims, o.rootKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	accountKey := o.addAccount(t, "APP", o.signingKey, nil)
+	accountJwt, err := jwt.NewAccountClaims(PublicKey(accountKey)).Encode(o.signingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolver, err := connectResolver(o.name, o.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resolver.Close()
+
+	if found, err := resolver.Lookup(PublicKey(accountKey)); err != nil || found != "" {
+		t.Errorf("expected an unknown account to be empty, got %q (%v)", found, err)
+	}
+	if err := resolver.Push(PublicKey(accountKey), accountJwt); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := resolver.Lookup(PublicKey(accountKey)); err != nil || found != accountJwt {
+		t.Errorf("expected the pushed JWT, got %q (%v)", found, err)
+	}
+	// the nats-account-server cannot list its accounts.
+	if pubKeys, err := resolver.List(); err != nil || pubKeys != nil {
+		t.Errorf("expected no list, got %v (%v)", pubKeys, err)
+	}
+
+	if err := resolver.Push(PublicKey(accountKey), "garbage"); err == nil || !strings.Contains(err.Error(), "invalid account JWT") {
+		t.Errorf("expected the rejection of the account server, got %v", err)
+	}
+}
+
+func TestHttpResolverUnreachable(t *testing.T) {
+	_, server := newFakeAccountServer(t)
+	resolver := &httpResolver{url: server.URL}
+	server.Close()
+
+	if err := resolver.Push("ACCOUNT", "jwt"); !errors.Is(err, errUnreachable) {
+		t.Errorf("expected errUnreachable, got %v", err)
+	}
+	if _, err := resolver.Lookup("ACCOUNT"); !errors.Is(err, errUnreachable) {
+		t.Errorf("expected errUnreachable, got %v", err)
+	}
+}
+
+func TestConnectResolverWithoutAccountServer(t *testing.T) {
+	o := newTestOperator(t, "OP")
+	if _, err := connectResolver(o.name, o.cfg); !errors.Is(err, common.ErrValidation) {
+		t.Errorf("expected a validation error without account server URL, got %v", err)
+	}
+}
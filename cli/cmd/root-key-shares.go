@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nats-io/nkeys"
+	"github.com/pterm/pterm"
+	"github.com/sandstorm/natsCtl/cli/common"
+	"github.com/sandstorm/natsCtl/cli/shamir"
+	"github.com/sandstorm/natsCtl/cli/transaction"
+	"github.com/skip2/go-qrcode"
+	"github.com/spf13/cobra"
+)
+
+// A root key share is written as NATSSHARE1-<threshold>-<share>-<checksum>: the share (x coordinate and the
+// shares of the 32 byte raw seed) and the checksum in base32, so that it only contains characters of the QR
+// alphanumeric mode, and typos are detected before combining.
+var (
+	shareSpecRegexp = regexp.MustCompile(`^(\d+)-of-(\d+)$`)
+	shareRegexp     = regexp.MustCompile(`NATSSHARE1-(\d+)-([A-Z2-7]+)-([A-Z2-7]{4})`)
+	shareEncoding   = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// rootKeyBackupFlags are the flags of the commands creating an operator (init-operator, operator clone): the root
+// key is never stored, but printed once - or split into shares.
+type rootKeyBackupFlags struct {
+	shares    string
+	sheetsDir string
+}
+
+func (f *rootKeyBackupFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.shares, "root-key-shares", "", "split the root key into N-of-M Shamir shares instead of printing it, f.e. 3-of-5 (env: ROOT_KEY_SHARES)")
+	cmd.Flags().StringVar(&f.sheetsDir, "root-key-sheets-dir", "", "write one printable text page and QR code PNG per share into this directory, instead of printing them (env: ROOT_KEY_SHEETS_DIR)")
+}
+
+func (f *rootKeyBackupFlags) parse() (rootKeyBackup, error) {
+	backup := rootKeyBackup{
+		shares:    flagOrEnv(f.shares, "ROOT_KEY_SHARES"),
+		sheetsDir: flagOrEnv(f.sheetsDir, "ROOT_KEY_SHEETS_DIR"),
+	}
+	if backup.shares == "" {
+		if backup.sheetsDir != "" {
+			return backup, fmt.Errorf("%w: --root-key-sheets-dir needs --root-key-shares", common.ErrValidation)
+		}
+		return backup, nil
+	}
+	var err error
+	backup.threshold, backup.count, err = parseShareSpec(backup.shares)
+	return backup, err
+}
+
+type rootKeyBackup struct {
+	shares    string
+	threshold int
+	count     int
+	sheetsDir string
+}
+
+// handOut prints the root key once, or its shares; with a sheets directory, the share sheets are staged in the
+// transaction, and returned.
+func (b rootKeyBackup) handOut(tx *transaction.Tx, operator OperatorName, rootKey nkeys.KeyPair) ([]string, error) {
+	if b.shares == "" {
+		pterm.Printfln(`
+    The public root key is: %s
+    Please store the private root key safely. THE FOLLOWING PRINTOUT IS
+    THE ONLY COPY; the key is never stored.
+    Please also store the instructions along with the key.
+
+    -----------------------------------------------
+%s
+    PRIVATE ROOT KEY:
+
+        %s
+
+    -----------------------------------------------
+`, bold.Sprint(PublicKey(rootKey)), rootKeyInstructions(operator), Seed(rootKey))
+		return nil, nil
+	}
+	pterm.Printfln(`
+    The public root key is: %s
+    The private root key is split into %d shares; any %d of them rebuild it.
+    Please store the shares safely, in different places. THE SHARES ARE
+    THE ONLY COPY of the root key; it is never stored.
+`, bold.Sprint(PublicKey(rootKey)), b.count, b.threshold)
+	return writeRootKeyShares(tx, operator, rootKey, b.threshold, b.count, b.sheetsDir)
+}
+
+// printSheetsHint is printed once the sheets were written on commit.
+func (b rootKeyBackup) printSheetsHint() {
+	if b.sheetsDir != "" {
+		pterm.Warning.Printfln("Print the root key share sheets in %s, store them in different places, and delete the files.", b.sheetsDir)
+	}
+}
+
+// parseShareSpec parses "3-of-5" into the threshold and the number of shares.
+func parseShareSpec(spec string) (threshold int, shares int, err error) {
+	match := shareSpecRegexp.FindStringSubmatch(strings.TrimSpace(spec))
+	if match == nil {
+		return 0, 0, fmt.Errorf("%w: root key shares %q must look like 3-of-5", common.ErrValidation, spec)
+	}
+	threshold, _ = strconv.Atoi(match[1])
+	shares, _ = strconv.Atoi(match[2])
+	if threshold < 2 || shares < threshold || shares > 255 {
+		return 0, 0, fmt.Errorf("%w: root key shares %q: need 2 <= N <= M <= 255 for N-of-M", common.ErrValidation, spec)
+	}
+	return threshold, shares, nil
+}
+
+func encodeShare(threshold int, share []byte) string {
+	return fmt.Sprintf("NATSSHARE1-%d-%s-%s", threshold, shareEncoding.EncodeToString(share), shareChecksum(threshold, share))
+}
+
+// decodeShare finds the share in the text - so a whole share sheet can be passed as well. Whitespace is ignored,
+// as shares may be typed in groups.
+func decodeShare(text string) (threshold int, share []byte, err error) {
+	compact := strings.ToUpper(strings.Join(strings.Fields(text), ""))
+	match := shareRegexp.FindStringSubmatch(compact)
+	if match == nil {
+		return 0, nil, fmt.Errorf("%w: no root key share (NATSSHARE1-...) found", common.ErrValidation)
+	}
+	threshold, _ = strconv.Atoi(match[1])
+	if share, err = shareEncoding.DecodeString(match[2]); err != nil {
+		return 0, nil, fmt.Errorf("%w: invalid root key share: %w", common.ErrValidation, err)
+	}
+	if shareChecksum(threshold, share) != match[3] {
+		return 0, nil, fmt.Errorf("%w: checksum of the root key share does not match - is there a typo?", common.ErrValidation)
+	}
+	return threshold, share, nil
+}
+
+func shareChecksum(threshold int, share []byte) string {
+	checksum := make([]byte, 4)
+	binary.BigEndian.PutUint32(checksum, crc32.ChecksumIEEE(append([]byte{byte(threshold)}, share...)))
+	return shareEncoding.EncodeToString(checksum)[:4]
+}
+
+// splitRootKey splits the raw root seed into N-of-M shares; they are combined again right away, to be sure the
+// shares can be recovered before the only copy of the root key is gone.
+func splitRootKey(rootKey nkeys.KeyPair, threshold int, total int) ([]string, error) {
+	_, rawSeed, err := nkeys.DecodeSeed(Seed(rootKey))
+	if err != nil {
+		return nil, err
+	}
+	defer shamir.Wipe(rawSeed)
+	shares, err := shamir.Split(rawSeed, threshold, total)
+	if err != nil {
+		return nil, err
+	}
+	for _, subset := range [][][]byte{shares[:threshold], shares[total-threshold:]} {
+		combined, err := combineRootKey(subset, PublicKey(rootKey))
+		if err != nil {
+			return nil, fmt.Errorf("verifying the root key shares: %w", err)
+		}
+		combined.Wipe()
+	}
+	encoded := make([]string, total)
+	for i, share := range shares {
+		encoded[i] = encodeShare(threshold, share)
+	}
+	return encoded, nil
+}
+
+// combineRootKey rebuilds the root key from the shares, and verifies it against the public root key.
+func combineRootKey(shares [][]byte, rootPublicKey string) (nkeys.KeyPair, error) {
+	rawSeed, err := shamir.Combine(shares)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", common.ErrValidation, err)
+	}
+	defer shamir.Wipe(rawSeed)
+	rootKey, err := nkeys.FromRawSeed(nkeys.PrefixByteOperator, rawSeed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", common.ErrValidation, err)
+	}
+	if PublicKey(rootKey) != rootPublicKey {
+		rootKey.Wipe()
+		return nil, fmt.Errorf("%w: the shares do not rebuild the root key %s - are they from another operator?", common.ErrValidation, rootPublicKey)
+	}
+	return rootKey, nil
+}
+
+// writeRootKeyShares splits the root key, and prints one page per share; or, with sheetsDir, stages one text page
+// and one QR code PNG per share in the transaction. It returns the written files.
+func writeRootKeyShares(tx *transaction.Tx, operator OperatorName, rootKey nkeys.KeyPair, threshold int, total int, sheetsDir string) ([]string, error) {
+	shares, err := splitRootKey(rootKey, threshold, total)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for i, share := range shares {
+		qr, err := qrcode.New(share, qrcode.Medium)
+		if err != nil {
+			return nil, fmt.Errorf("rendering QR code of share %d: %w", i+1, err)
+		}
+		// the sheets are printed black on white; the terminal is usually light on dark.
+		page := rootKeySharePage(operator, PublicKey(rootKey), i+1, threshold, total, share, qr.ToSmallString(sheetsDir != ""))
+		if sheetsDir == "" {
+			pterm.Println(page)
+			continue
+		}
+		png, err := qr.PNG(256)
+		if err != nil {
+			return nil, fmt.Errorf("rendering QR code of share %d: %w", i+1, err)
+		}
+		base := filepath.Join(sheetsDir, fmt.Sprintf("%s-root-key-share-%d-of-%d", operator, i+1, total))
+		if err := tx.WriteFile(base+".txt", []byte(page), 0600); err != nil {
+			return nil, err
+		}
+		if err := tx.WriteFile(base+".png", png, 0600); err != nil {
+			return nil, err
+		}
+		files = append(files, base+".txt", base+".png")
+	}
+	return files, nil
+}
+
+func rootKeySharePage(operator OperatorName, rootPublicKey string, index int, threshold int, total int, share string, qr string) string {
+	return fmt.Sprintf(`
+    -----------------------------------------------
+    ROOT KEY SHARE %d OF %d - any %d of the %d shares rebuild the root key;
+    fewer shares reveal nothing about it. Keep the shares in different places.
+
+    Public root key: %s
+%s
+    To rebuild the root key from %d shares, run:
+        operator recover-root --operator %s
+
+    SHARE %d OF %d:
+
+        %s
+
+%s
+    -----------------------------------------------
+`, index, total, threshold, total, rootPublicKey, rootKeyInstructions(operator), threshold, operator, index, total, share, qr)
+}
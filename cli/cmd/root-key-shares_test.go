@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sandstorm/natsCtl/cli/common"
+)
+
+func TestParseShareSpec(t *testing.T) {
+	threshold, shares, err := parseShareSpec(" 3-of-5 ")
+	if err != nil || threshold != 3 || shares != 5 {
+		t.Errorf("expected 3-of-5, got %d-of-%d (%v)", threshold, shares, err)
+	}
+	for _, spec := range []string{"", "3", "3of5", "3-of-", "1-of-3", "4-of-3", "2-of-256", "-2-of-3"} {
+		if _, _, err := parseShareSpec(spec); !errors.Is(err, common.ErrValidation) {
+			t.Errorf("%q: expected a validation error, got %v", spec, err)
+		}
+	}
+}
+
+func TestEncodeAndDecodeShare(t *testing.T) {
+	share := []byte{3, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	encoded := encodeShare(2, share)
+	if !strings.HasPrefix(encoded, "NATSSHARE1-2-") {
+		t.Fatalf("unexpected encoding %s", encoded)
+	}
+
+	// shares may be typed in lowercase and in groups, or be passed as whole share sheet.
+	grouped := strings.ToLower(encoded[:10] + " " + encoded[10:20] + "\n" + encoded[20:])
+	sheet := rootKeySharePage("OP", "OABC", 1, 2, 3, encoded, "")
+	for _, text := range []string{encoded, grouped, sheet} {
+		threshold, decoded, err := decodeShare(text)
+		if err != nil {
+			t.Fatalf("%q: %s", text, err)
+		}
+		if threshold != 2 || !bytes.Equal(decoded, share) {
+			t.Errorf("%q: expected the share, got %d %v", text, threshold, decoded)
+		}
+	}
+}
+
+func TestDecodeShareRejectsTypos(t *testing.T) {
+	encoded := encodeShare(2, []byte{3, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+	prefix := len("NATSSHARE1-2-")
+
+	// a typo in the share itself.
+	typo := []byte(encoded)
+	if typo[prefix+3] == 'A' {
+		typo[prefix+3] = 'B'
+	} else {
+		typo[prefix+3] = 'A'
+	}
+	// a wrong threshold, with the checksum of the original one.
+	wrongThreshold := strings.Replace(encoded, "NATSSHARE1-2-", "NATSSHARE1-3-", 1)
+
+	for _, text := range []string{string(typo), wrongThreshold} {
+		_, _, err := decodeShare(text)
+		if !errors.Is(err, common.ErrValidation) || !strings.Contains(err.Error(), "checksum") {
+			t.Errorf("%s: expected a checksum error, got %v", text, err)
+		}
+	}
+
+	for _, text := range []string{"", "NATSSHARE1-2-", "some text without a share", "NATSSHARE1-2-ABC-ABC"} {
+		if _, _, err := decodeShare(text); !errors.Is(err, common.ErrValidation) {
+			t.Errorf("%q: expected a validation error, got %v", text, err)
+		}
+	}
+}
+
+func TestSplitAndCombineRootKey(t *testing.T) {
+	rootKey := newOperatorKey(t)
+	encoded, err := splitRootKey(rootKey, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(encoded) != 3 {
+		t.Fatalf("expected 3 shares, got %d", len(encoded))
+	}
+	var shares [][]byte
+	for _, text := range encoded[1:] {
+		threshold, share, err := decodeShare(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if threshold != 2 {
+			t.Errorf("expected threshold 2, got %d", threshold)
+		}
+		shares = append(shares, share)
+	}
+
+	combined, err := combineRootKey(shares, PublicKey(rootKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(Seed(combined), Seed(rootKey)) {
+		t.Error("expected the root key to be rebuilt")
+	}
+
+	if _, err := combineRootKey(shares, PublicKey(newOperatorKey(t))); !errors.Is(err, common.ErrValidation) {
+		t.Errorf("expected a validation error for the root key of another operator, got %v", err)
+	}
+	if _, err := combineRootKey(shares[:1], PublicKey(rootKey)); !errors.Is(err, common.ErrValidation) {
+		t.Errorf("expected a validation error for too few shares, got %v", err)
+	}
+	if _, err := combineRootKey([][]byte{shares[0], shares[0]}, PublicKey(rootKey)); !errors.Is(err, common.ErrValidation) {
+		t.Errorf("expected a validation error for a duplicate share, got %v", err)
+	}
+}
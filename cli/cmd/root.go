@@ -4,10 +4,13 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"fmt"
+	"github.com/sandstorm/natsCtl/cli/common"
 	"github.com/sandstorm/natsCtl/cli/config"
-	"os"
+	"io"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -23,11 +26,47 @@ to quickly create a Cobra application.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		common.SetNonInteractive(nonInteractive)
+		if err := checkDryRun(cmd); err != nil {
+			return err
+		}
+		return setupOutput()
+	},
+	// errors are printed by main(), without usage and without stack trace.
+	SilenceErrors: true,
+	SilenceUsage:  true,
+}
+
+// nonInteractive is set via --non-interactive; then, missing inputs are an error instead of a prompt.
+var nonInteractive bool
+
+// root is set via --root. It is only declared on rootCmd for the help and for flag parsing: the config is loaded
+// before the commands are executed, so main() reads it via RootFromArgs() (as well as --non-interactive).
+var root string
+
+// RootFromArgs returns the directory containing the config file, given via --root (or NATSCTL_ROOT);
+// empty if the config file should be searched in the current directory and its parents.
+// --non-interactive is applied right away as well, as loading the config may prompt (see config.BootstrapConfig).
+func RootFromArgs(args []string) string {
+	flags := pflag.NewFlagSet("root", pflag.ContinueOnError)
+	flags.ParseErrorsWhitelist.UnknownFlags = true
+	flags.SetOutput(io.Discard)
+	flags.Usage = func() {}
+	flags.StringVar(&root, "root", "", "")
+	flags.BoolVar(&nonInteractive, "non-interactive", false, "")
+	// otherwise, --help would be reported as error here.
+	flags.BoolP("help", "h", false, "")
+	// all other errors are reported when cobra parses the flags.
+	_ = flags.Parse(args)
+	common.SetNonInteractive(nonInteractive)
+	return flagOrEnv(root, config.RootEnvVar)
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
-func Execute(cfg config.Config) {
+// The returned error is classified for common.ExitCode.
+func Execute(cfg config.Config) error {
 	rootCmd.AddCommand(newInitOperatorCmd(cfg))
 	rootCmd.AddCommand(newAccountCmd(cfg))
 	rootCmd.AddCommand(newScopedSigningKeyCmd(cfg))
@@ -38,16 +77,19 @@ func Execute(cfg config.Config) {
 	rootCmd.AddCommand(newNukeCmd(cfg))
 	rootCmd.AddCommand(newDocsCmd(cfg))
 	rootCmd.AddCommand(newDecryptNkeyCmd(cfg))
+	rootCmd.AddCommand(newRekeyCmd(cfg))
+	rootCmd.AddCommand(newAgentCmd(cfg))
+	rootCmd.AddCommand(newLsCmd(cfg))
+	rootCmd.AddCommand(newDescribeCmd(cfg))
+	rootCmd.AddCommand(newOperatorCmd(cfg))
+	rootCmd.AddCommand(newImportNscCmd(cfg))
 	//rootCmd.AddCommand(newCmd(cfg))
 
 	/*
 		"nsc":                Nsc,
 		"nsc-switch":   NscSwitchOperator,
 	*/
-	err := rootCmd.Execute()
-	if err != nil {
-		os.Exit(1)
-	}
+	return rootCmd.Execute()
 }
 
 func init() {
@@ -56,8 +98,21 @@ func init() {
 	// will be global for your application.
 
 	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.cli.yaml)")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputText, "output format: text, json or yaml (json/yaml print the result object to stdout, everything else to stderr)")
+	rootCmd.PersistentFlags().StringVar(&root, "root", "", "directory containing "+config.NatsUtilsConfigFile+" (env: "+config.RootEnvVar+"); by default, the current directory and its parents are searched")
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "print the changes of the JWTs field by field, without decrypting any key or writing anything (account, scoped-signing-key, init-operator, operator edit)")
+	rootCmd.PersistentFlags().BoolVar(&nonInteractive, "non-interactive", false, "never prompt; fail if an input is missing (also "+common.NonInteractiveEnvVar+"=1, or when no TTY is attached)")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+
+	// our own completion command supports the same shells, and does not need natsUtilsCfg.json (see IsCompletion).
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.AddCommand(newCompletionCmd())
+	rootCmd.AddCommand(newDoctorCmd())
+
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return fmt.Errorf("%w: %w (see %s --help)", common.ErrValidation, err, cmd.CommandPath())
+	})
 }
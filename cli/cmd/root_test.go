@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/sandstorm/natsCtl/cli/config"
+)
+
+func TestRootFromArgs(t *testing.T) {
+	t.Setenv(config.RootEnvVar, "")
+	cases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"ls", "operators"}, ""},
+		{[]string{"--root", "/repo", "ls", "operators"}, "/repo"},
+		{[]string{"ls", "--root=/repo", "operators"}, "/repo"},
+		// unknown flags of the commands must not stop the parsing.
+		{[]string{"push", "--operator", "OP", "--root", "/repo", "--help"}, "/repo"},
+	}
+	for _, c := range cases {
+		root = ""
+		if actual := RootFromArgs(c.args); actual != c.expected {
+			t.Errorf("%v: expected root %q, got %q", c.args, c.expected, actual)
+		}
+	}
+}
+
+func TestRootFromEnv(t *testing.T) {
+	t.Setenv(config.RootEnvVar, "/from-env")
+	root = ""
+	if actual := RootFromArgs([]string{"ls", "operators"}); actual != "/from-env" {
+		t.Errorf("expected the root from %s, got %q", config.RootEnvVar, actual)
+	}
+	root = ""
+	if actual := RootFromArgs([]string{"--root", "/repo", "ls"}); actual != "/repo" {
+		t.Errorf("expected --root to win over %s, got %q", config.RootEnvVar, actual)
+	}
+}
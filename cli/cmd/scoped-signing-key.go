@@ -1,13 +1,14 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
-	"github.com/bitfield/script"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/nats-io/jwt/v2"
 	"github.com/pterm/pterm"
 	"github.com/sandstorm/natsCtl/cli/common"
 	"github.com/sandstorm/natsCtl/cli/config"
+	"github.com/sandstorm/natsCtl/cli/transaction"
 	"github.com/sandstorm/natsCtl/cli/ui/permissions"
 	"github.com/spf13/cobra"
 	"os"
@@ -19,8 +20,19 @@ var defaultResponsePermission = &jwt.ResponsePermission{
 	Expires: 10 * time.Minute,
 }
 
+// rolePermissions are the permissions of a scoped signing key; edited in the permissions UI,
+// or given via --pub/--sub/--allow-reply or --permissions-file.
+type rolePermissions struct {
+	Pub        []string `json:"pub" yaml:"pub"`
+	Sub        []string `json:"sub" yaml:"sub"`
+	AllowReply bool     `json:"allowReply" yaml:"allowReply"`
+}
+
 func newScopedSigningKeyCmd(cfg config.Config) *cobra.Command {
-	return &cobra.Command{
+	var operatorFlag, accountFlag, roleFlag, permissionsFile string
+	var pubFlag, subFlag []string
+	var allowReplyFlag bool
+	cmd := &cobra.Command{
 		Use:   "scoped-signing-key",
 		Short: "A brief description of your command",
 		Long: `A longer description that spans multiple lines and likely contains examples
@@ -29,27 +41,41 @@ and usage of using your command. For example:
 Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			var err error
-			operator := OperatorName(os.Getenv("OPERATOR_NAME"))
-			account := AccountName(os.Getenv("ACCOUNT_NAME"))
-			role := RoleName(os.Getenv("ROLE_NAME"))
+			operator := OperatorName(flagOrEnv(operatorFlag, "OPERATOR_NAME"))
+			account := AccountName(flagOrEnv(accountFlag, "ACCOUNT_NAME"))
+			role := RoleName(flagOrEnv(roleFlag, "ROLE_NAME"))
 
 			pterm.DefaultSection.Println("1) Select Scoped Signing Key")
 
 			if operator == "" {
-				operator = chooseOperator()
+				if operator, err = chooseOperator(&cfg); err != nil {
+					return err
+				}
 			}
 
 			if account == "" {
 				pterm.Printfln("Choose an account in operator %s:", bold.Sprint(operator))
-				account = chooseAccount(operator)
+				if account, err = chooseAccount(&cfg, operator); err != nil {
+					return err
+				}
+			}
+			accountClaims, err := readAccount(&cfg, operator, account)
+			if err != nil {
+				return err
+			}
+			// kept unmodified for --dry-run.
+			before, err := readAccount(&cfg, operator, account)
+			if err != nil {
+				return err
 			}
-			accountClaims := readAccount(operator, account)
 
 			if role == "" {
 				pterm.Printfln("Specify role name (by convention lowercase)")
-				role = chooseOrCreateRole(accountClaims)
+				if role, err = chooseOrCreateRole(accountClaims); err != nil {
+					return err
+				}
 			}
 
 			scopedSigningKey := scopedSigningKeyForRole(accountClaims, role)
@@ -61,77 +87,200 @@ to quickly create a Cobra application.`,
 				scopedSigningKey.Template.Resp = defaultResponsePermission
 			}
 
-			if model, err := tea.NewProgram(permissions.NewModel(scopedSigningKey), tea.WithAltScreen()).Run(); err != nil {
-				fmt.Println("Error while running program:", err)
-				os.Exit(1)
-			} else {
-				m := model.(permissions.Model)
-
-				// Publish
-				scopedSigningKey.Template.Pub = jwt.Permission{
-					Allow: m.Pub(),
+			var perms rolePermissions
+			if permissionsFile != "" {
+				if perms, err = readRolePermissions(permissionsFile); err != nil {
+					return err
 				}
-
-				// Subscribe
-				scopedSigningKey.Template.Sub = jwt.Permission{
-					Allow: m.Sub(),
+			} else if cmd.Flags().Changed("pub") || cmd.Flags().Changed("sub") || cmd.Flags().Changed("allow-reply") {
+				// only the given flags are changed; the role keeps the rest of its permissions.
+				perms = currentRolePermissions(scopedSigningKey)
+				if cmd.Flags().Changed("pub") {
+					perms.Pub = pubFlag
 				}
-
-				// Private Inbox
-				if len(scopedSigningKey.Template.Pub.Allow) == 0 {
-					// Deny all in case nothing is allowed.
-					scopedSigningKey.Template.Pub.Deny = []string{">"}
+				if cmd.Flags().Changed("sub") {
+					perms.Sub = subFlag
 				}
-
-				// it is allowed to publish to specific subjects. This means the service should also be allowed to receive
-				// responses for its requests, in case of request/reply.
-				//
-				// For confidentiality, we want to configure a private Inbox (https://natsbyexample.com/examples/auth/private-inbox/cli)
-				// - so this is what we set up here.
-				scopedSigningKey.Template.Sub.Allow = append(scopedSigningKey.Template.Sub.Allow, common.PrivateInboxSelector)
-				pterm.Success.Printfln("Because requests are allowed, we auto-configure the private response inbox %s", bold.Sprint(common.PrivateInboxSelector))
-
-				// users (apart from admins) MUST use private inboxes; so we auto-deny the default inbox.
-				scopedSigningKey.Template.Sub.Deny = []string{"_INBOX.>"}
-				if len(scopedSigningKey.Template.Sub.Allow) == 0 {
-					// Deny all in case nothing is allowed.
-					scopedSigningKey.Template.Sub.Deny = append(scopedSigningKey.Template.Sub.Deny, ">")
+			} else {
+				if err := common.RequireInteractive("permissions", "pub/--sub or --permissions-file", ""); err != nil {
+					return err
+				}
+				model, err := tea.NewProgram(permissions.NewModel(scopedSigningKey), tea.WithAltScreen()).Run()
+				if err != nil {
+					return fmt.Errorf("running permissions UI: %w", err)
 				}
+				m := model.(permissions.Model)
+				perms = rolePermissions{Pub: m.Pub(), Sub: m.Sub(), AllowReply: m.AllowReply}
+			}
+			if cmd.Flags().Changed("allow-reply") {
+				perms.AllowReply = allowReplyFlag
+			}
+			applyRolePermissions(scopedSigningKey, perms)
 
-				// Replies
-				if m.AllowReply {
-					scopedSigningKey.Template.Resp = defaultResponsePermission
-					pterm.Success.Printfln("Responses allowed for %s after the request.", bold.Sprint(scopedSigningKey.Template.Resp.Expires))
-				} else {
-					scopedSigningKey.Template.Resp = nil
+			if !dryRun {
+				pterm.Info.Printfln("%s for decrypting the NKey for %s", bold.Sprint("Specify your Bitwarden Vault Master Password"), account)
+				if err := unlock(&cfg); err != nil {
+					return err
 				}
 			}
 
-			pterm.Info.Printfln("%s for decrypting the NKey for %s", bold.Sprint("Specify your Bitwarden Vault Master Password"), account)
-			cfg.MasterPasswordDecryptor().Unlock()
+			// the new signing key and the account JWT are written together on commit.
+			tx := transaction.New()
+			defer tx.Rollback()
 
 			// scoped signing keys are stored inside the account JWT; so we need the Operator Signing Key to update it.
-			operatorSigningKey := getOperatorSigningKey(operator)
+			operatorSigningKey, err := getOperatorSigningKey(&cfg, operator)
+			if err != nil {
+				return err
+			}
 
-			if scopedSigningKey.Key == "" {
+			created := scopedSigningKey.Key == ""
+			if created {
 				// Scoped Signing Key does not exist, so we need to create a new one (and encrypt it).
-				scopedSigningKey.Key = genAndEncryptAccountSigningKey(cfg.MasterPasswordDecryptor()).Key()
+				signingKey, err := genAndEncryptAccountSigningKey(keyStoreFor(&cfg, tx))
+				if err != nil {
+					return err
+				}
+				scopedSigningKey.Key = signingKey.Key()
 				accountClaims.SigningKeys.AddScopedSigner(scopedSigningKey)
 
-				pterm.Success.Printfln("Created and encrypted Scoped Signing Key.")
-			} else {
+				if !dryRun {
+					pterm.Success.Printfln("Created and encrypted Scoped Signing Key.")
+				}
+			} else if !dryRun {
 				pterm.Info.Printfln("Updating Scoped Signing Key.")
 			}
 
-			writeAccount(operator, accountClaims, decryptNkey(operatorSigningKey, cfg.MasterPasswordDecryptor()))
+			if dryRun {
+				// on signing, the issuer is set to the signing key.
+				accountClaims.Issuer = operatorSigningKey.Key()
+				changes, err := diffClaims(before, accountClaims)
+				if err != nil {
+					return err
+				}
+				createdKeys := 0
+				if created {
+					createdKeys = 1
+				}
+				return printDryRun(createdKeys, JwtDiff{
+					Name:    fmt.Sprintf("account %s", account),
+					File:    accountJwtPath(&cfg, operator, account),
+					Changes: changes,
+				})
+			}
+
+			operatorSigningNkey, err := loadKey(&cfg, operatorSigningKey)
+			if err != nil {
+				return err
+			}
+			if _, err := writeAccount(&cfg, tx, operator, accountClaims, operatorSigningNkey); err != nil {
+				return err
+			}
+			if err := tx.Commit(); err != nil {
+				return err
+			}
 
-			setupNsc(operator)
-			_, err = script.NewPipe().
-				Apply(ExecAndStdout(`nsc describe account "%s"`, account)).
-				Stdout()
-			panicOnErr(err)
+			if err := describeAccount(humanOutput(), accountClaims); err != nil {
+				return err
+			}
 
-			DocsFn(operator)
+			if err := DocsFn(&cfg, operator); err != nil {
+				return err
+			}
+
+			return printResult(ScopedSigningKeyResult{
+				Operator:   string(operator),
+				Account:    string(account),
+				Role:       string(role),
+				SigningKey: scopedSigningKey.Key,
+				Created:    created,
+				// the effective permissions, including the private inbox.
+				Permissions: currentRolePermissions(scopedSigningKey),
+				JwtFile:     accountJwtPath(&cfg, operator, account),
+			})
 		},
 	}
+	cmd.Flags().StringVar(&operatorFlag, "operator", "", "operator name (env: OPERATOR_NAME)")
+	cmd.Flags().StringVar(&accountFlag, "account", "", "account name (env: ACCOUNT_NAME)")
+	cmd.Flags().StringVar(&roleFlag, "role", "", "role name, by convention lowercase (env: ROLE_NAME)")
+	cmd.Flags().StringArrayVar(&pubFlag, "pub", nil, "subject the role may publish to (repeatable); replaces all publish subjects of the role, and skips the permissions UI")
+	cmd.Flags().StringArrayVar(&subFlag, "sub", nil, "subject the role may subscribe to (repeatable); replaces all subscribe subjects of the role, and skips the permissions UI")
+	cmd.Flags().BoolVar(&allowReplyFlag, "allow-reply", false, "allow replying to requests; skips the permissions UI")
+	cmd.Flags().StringVar(&permissionsFile, "permissions-file", "", `JSON file with {"pub": [...], "sub": [...], "allowReply": true}; skips the permissions UI`)
+	cmd.MarkFlagsMutuallyExclusive("permissions-file", "pub")
+	cmd.MarkFlagsMutuallyExclusive("permissions-file", "sub")
+	registerStoreCompletions(cmd, &cfg)
+	supportsDryRun(cmd)
+	return cmd
+}
+
+func readRolePermissions(path string) (rolePermissions, error) {
+	var perms rolePermissions
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return perms, fmt.Errorf("%w: %w", common.ErrValidation, err)
+	}
+	if err := json.Unmarshal(file, &perms); err != nil {
+		return perms, fmt.Errorf("%w: malformed JSON in %s: %w", common.ErrValidation, path, err)
+	}
+	return perms, nil
+}
+
+// currentRolePermissions reads the permissions from the template of the scoped signing key; new roles allow
+// replies by default (see defaultResponsePermission).
+func currentRolePermissions(scopedSigningKey *jwt.UserScope) rolePermissions {
+	return rolePermissions{
+		Pub:        scopedSigningKey.Template.Pub.Allow,
+		Sub:        scopedSigningKey.Template.Sub.Allow,
+		AllowReply: scopedSigningKey.Template.Resp != nil,
+	}
+}
+
+// applyRolePermissions writes the permissions into the template of the scoped signing key,
+// including the private inbox for responses.
+func applyRolePermissions(scopedSigningKey *jwt.UserScope, perms rolePermissions) {
+	// Publish
+	scopedSigningKey.Template.Pub = jwt.Permission{
+		Allow: perms.Pub,
+	}
+
+	// Subscribe; the private inbox is always added below.
+	var sub []string
+	for _, subject := range perms.Sub {
+		if subject != common.PrivateInboxSelector {
+			sub = append(sub, subject)
+		}
+	}
+	scopedSigningKey.Template.Sub = jwt.Permission{
+		Allow: sub,
+	}
+
+	// Private Inbox
+	if len(scopedSigningKey.Template.Pub.Allow) == 0 {
+		// Deny all in case nothing is allowed.
+		scopedSigningKey.Template.Pub.Deny = []string{">"}
+	}
+
+	// it is allowed to publish to specific subjects. This means the service should also be allowed to receive
+	// responses for its requests, in case of request/reply.
+	//
+	// For confidentiality, we want to configure a private Inbox (https://natsbyexample.com/examples/auth/private-inbox/cli)
+	// - so this is what we set up here.
+	scopedSigningKey.Template.Sub.Allow = append(scopedSigningKey.Template.Sub.Allow, common.PrivateInboxSelector)
+	pterm.Success.Printfln("Because requests are allowed, we auto-configure the private response inbox %s", bold.Sprint(common.PrivateInboxSelector))
+
+	// users (apart from admins) MUST use private inboxes; so we auto-deny the default inbox.
+	scopedSigningKey.Template.Sub.Deny = []string{"_INBOX.>"}
+	if len(scopedSigningKey.Template.Sub.Allow) == 0 {
+		// Deny all in case nothing is allowed.
+		scopedSigningKey.Template.Sub.Deny = append(scopedSigningKey.Template.Sub.Deny, ">")
+	}
+
+	// Replies
+	if perms.AllowReply {
+		scopedSigningKey.Template.Resp = defaultResponsePermission
+		pterm.Success.Printfln("Responses allowed for %s after the request.", bold.Sprint(scopedSigningKey.Template.Resp.Expires))
+	} else {
+		scopedSigningKey.Template.Resp = nil
+	}
 }
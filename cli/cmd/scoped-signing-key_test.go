@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/sandstorm/natsCtl/cli/common"
+)
+
+func newRole(perms rolePermissions) *jwt.UserScope {
+	scopedSigningKey := jwt.NewUserScope()
+	scopedSigningKey.Role = "app"
+	applyRolePermissions(scopedSigningKey, perms)
+	return scopedSigningKey
+}
+
+func TestApplyRolePermissions(t *testing.T) {
+	scopedSigningKey := newRole(rolePermissions{Pub: []string{"orders.>"}, Sub: []string{"events.>"}, AllowReply: true})
+
+	template := scopedSigningKey.Template
+	if !reflect.DeepEqual(template.Pub.Allow, jwt.StringList{"orders.>"}) || len(template.Pub.Deny) != 0 {
+		t.Errorf("unexpected publish permissions %+v", template.Pub)
+	}
+	if !reflect.DeepEqual(template.Sub.Allow, jwt.StringList{"events.>", common.PrivateInboxSelector}) {
+		t.Errorf("expected the private inbox to be added, got %v", template.Sub.Allow)
+	}
+	if !reflect.DeepEqual(template.Sub.Deny, jwt.StringList{"_INBOX.>"}) {
+		t.Errorf("expected the default inbox to be denied, got %v", template.Sub.Deny)
+	}
+	if template.Resp != defaultResponsePermission {
+		t.Errorf("expected replies to be allowed, got %+v", template.Resp)
+	}
+}
+
+func TestApplyRolePermissionsDeniesAllPublishingWithoutSubjects(t *testing.T) {
+	template := newRole(rolePermissions{}).Template
+	if !reflect.DeepEqual(template.Pub.Deny, jwt.StringList{">"}) {
+		t.Errorf("expected publishing to be denied, got %v", template.Pub.Deny)
+	}
+	if template.Resp != nil {
+		t.Errorf("expected replies to be denied, got %+v", template.Resp)
+	}
+}
+
+// re-applying the current permissions (f.e. when only --allow-reply is given) must not change the role.
+func TestCurrentRolePermissionsRoundTrip(t *testing.T) {
+	scopedSigningKey := newRole(rolePermissions{Pub: []string{"orders.>"}, Sub: []string{"events.>"}, AllowReply: true})
+	before := scopedSigningKey.Template
+
+	perms := currentRolePermissions(scopedSigningKey)
+	// only --sub given: the publish subjects are kept.
+	perms.Sub = []string{"audit.>"}
+	applyRolePermissions(scopedSigningKey, perms)
+
+	template := scopedSigningKey.Template
+	if !reflect.DeepEqual(template.Pub, before.Pub) {
+		t.Errorf("expected the publish permissions %+v to be kept, got %+v", before.Pub, template.Pub)
+	}
+	if !reflect.DeepEqual(template.Sub.Allow, jwt.StringList{"audit.>", common.PrivateInboxSelector}) {
+		t.Errorf("expected the subscribe permissions to be replaced, got %v", template.Sub.Allow)
+	}
+	if template.Resp != defaultResponsePermission {
+		t.Errorf("expected replies to stay allowed, got %+v", template.Resp)
+	}
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/pterm/pterm"
+	"github.com/sandstorm/natsCtl/cli/keystore"
+)
+
+// subprocess is the running child process of decrypt-nkey, which uses the plaintext keys of the scratch directory.
+var subprocess atomic.Pointer[os.Process]
+
+var (
+	cleanupMu    sync.Mutex
+	cleanupHooks []func()
+)
+
+// HandleSignals runs Cleanup on SIGINT and SIGTERM, and exits. It is the only signal handler, so that the cleanup
+// hooks (see OnCleanup) always run before the exit. It also wipes the scratch directories left over by killed
+// processes.
+func HandleSignals() {
+	keystore.WipeStaleScratchDirs()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		for sig := range signals {
+			child := subprocess.Load()
+			if child != nil && sig == syscall.SIGINT {
+				// Ctrl+C is sent to the subprocess as well (same process group); it decides whether to exit.
+				continue
+			}
+			if child != nil {
+				_ = child.Signal(sig)
+			}
+			pterm.Warning.Printfln("Received %s.", sig)
+			Cleanup()
+			os.Exit(128 + int(sig.(syscall.Signal)))
+		}
+	}()
+}
+
+// OnCleanup registers a hook which Cleanup runs once, before wiping the scratch directory - f.e. to remove the socket
+// of the agent. The hooks run in reverse order of their registration.
+func OnCleanup(hook func()) {
+	cleanupMu.Lock()
+	defer cleanupMu.Unlock()
+	cleanupHooks = append(cleanupHooks, hook)
+}
+
+// Cleanup runs the cleanup hooks and wipes the plaintext keys of the scratch directory; it is called when the
+// process exits.
+func Cleanup() {
+	cleanupMu.Lock()
+	hooks := cleanupHooks
+	cleanupHooks = nil
+	cleanupMu.Unlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
+
+	if err := keystore.WipeScratch(); err != nil {
+		pterm.Error.Printfln("Could not wipe the plaintext keys: %s", err)
+	}
+}
@@ -0,0 +1,18 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCleanupRunsHooksOnceInReverseOrder(t *testing.T) {
+	var calls []string
+	OnCleanup(func() { calls = append(calls, "first") })
+	OnCleanup(func() { calls = append(calls, "second") })
+
+	Cleanup()
+	Cleanup()
+	if strings.Join(calls, ",") != "second,first" {
+		t.Errorf("expected the hooks to run once in reverse order, got %v", calls)
+	}
+}
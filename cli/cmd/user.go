@@ -10,10 +10,12 @@ import (
 	"github.com/sandstorm/natsCtl/cli/config"
 	"github.com/spf13/cobra"
 	"os"
+	"path/filepath"
 )
 
 func newUserCmd(cfg config.Config) *cobra.Command {
-	return &cobra.Command{
+	var operatorFlag, accountFlag, roleFlag, userFlag string
+	cmd := &cobra.Command{
 		Use:   "user",
 		Short: "A brief description of your command",
 		Long: `A longer description that spans multiple lines and likely contains examples
@@ -22,70 +24,100 @@ and usage of using your command. For example:
 Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			operator := OperatorName(os.Getenv("OPERATOR_NAME"))
-			account := AccountName(os.Getenv("ACCOUNT_NAME"))
-			role := RoleName(os.Getenv("ROLE_NAME"))
-			user := UserName(os.Getenv("USER_NAME"))
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			operator := OperatorName(flagOrEnv(operatorFlag, "OPERATOR_NAME"))
+			account := AccountName(flagOrEnv(accountFlag, "ACCOUNT_NAME"))
+			role := RoleName(flagOrEnv(roleFlag, "ROLE_NAME"))
+			user := UserName(flagOrEnv(userFlag, "USER_NAME"))
 
 			pterm.DefaultSection.Println("1) Select Scoped Signing Key")
 
 			if operator == "" {
-				operator = chooseOperator()
+				if operator, err = chooseOperator(&cfg); err != nil {
+					return err
+				}
 			}
 
 			if account == "" {
 				pterm.Printfln("Choose an account in operator %s:", bold.Sprint(operator))
-				account = chooseAccount(operator)
+				if account, err = chooseAccount(&cfg, operator); err != nil {
+					return err
+				}
+			}
+			accountClaims, err := readAccount(&cfg, operator, account)
+			if err != nil {
+				return err
 			}
-			accountClaims := readAccount(operator, account)
 
 			if role == "" {
 				pterm.Printfln("Choose role to create a user for")
-				role = chooseRole(accountClaims)
+				if role, err = chooseRole(accountClaims); err != nil {
+					return err
+				}
 			}
 
 			if user == "" {
+				if err := common.RequireInteractive("USER_NAME", "user", "USER_NAME"); err != nil {
+					return err
+				}
 				pterm.Printfln("User name to create (by convention lowercase)")
-				user = UserName(common.RequiredTextInput("USER_NAME"))
+				input, err := common.RequiredTextInput("USER_NAME")
+				if err != nil {
+					return err
+				}
+				user = UserName(input)
 			}
 
 			scopedSk := scopedSigningKeyForRole(accountClaims, role)
 			if scopedSk == nil {
-				panic(fmt.Errorf("no scoped signing key found for role %s - should never happen", role))
+				return fmt.Errorf("%w: no scoped signing key for role %s in account %s", common.ErrNotFound, role, account)
 			}
 			pterm.Success.Printfln("Using scoped signing key %s (%s/%s) for creating user.", scopedSk.SigningKey(), account, role)
 
 			pterm.Info.Printfln("%s for decrypting the NKey for %s", bold.Sprint("Specify your Bitwarden Vault Master Password"), account)
-			cfg.MasterPasswordDecryptor().Unlock()
-			scopedSkNkey := decryptNkey(ScopedSigningKey(scopedSk.Key), cfg.MasterPasswordDecryptor())
+			if err := unlock(&cfg); err != nil {
+				return err
+			}
+			scopedSkNkey, err := loadKey(&cfg, ScopedSigningKey(scopedSk.Key))
+			if err != nil {
+				return err
+			}
 
 			userNkey, err := nkeys.CreateUser()
-			panicOnErr(err)
-			userClaims := jwt.NewUserClaims(publicKey(userNkey))
+			if err != nil {
+				return err
+			}
+			userClaims := jwt.NewUserClaims(PublicKey(userNkey))
 			userClaims.Name = string(user)
 			userClaims.SetScoped(true)
 			userClaims.IssuerAccount = accountClaims.Subject
 
 			encoded, err := userClaims.Encode(scopedSkNkey)
-			panicOnErr(err)
-
-			userConfig, err := jwt.FormatUserConfig(encoded, seed(userNkey))
-			panicOnErr(err)
-			panicOnErr(os.MkdirAll(fmt.Sprintf("nsc/nkeys/creds/%s/%s", operator, account), 0755))
-			err = os.WriteFile(fmt.Sprintf("nsc/nkeys/creds/%s/%s/%s.creds", operator, account, user), userConfig, 0600)
-			panicOnErr(err)
+			if err != nil {
+				return fmt.Errorf("encoding JWT of user %s: %w", user, err)
+			}
 
-			wd, err := os.Getwd()
-			panicOnErr(err)
-			credsFile := fmt.Sprintf(`%s/nsc/nkeys/creds/%s/%s/%s.creds`, wd, operator, account, user)
+			userConfig, err := jwt.FormatUserConfig(encoded, Seed(userNkey))
+			if err != nil {
+				return err
+			}
+			// the path is absolute, as it is used in the nats context.
+			credsFile := credsPath(&cfg, operator, account, user)
+			if err := os.MkdirAll(filepath.Dir(credsFile), 0755); err != nil {
+				return err
+			}
+			err = os.WriteFile(credsFile, userConfig, 0600)
+			if err != nil {
+				return err
+			}
 
 			pterm.Success.Printfln(`Created credentials: %s`, credsFile)
-			pterm.Success.Printfln(`Inbox Prefix: %s`, bold.Sprintf(InboxPrefix(publicKey(userNkey))))
+			pterm.Success.Printfln(`Inbox Prefix: %s`, bold.Sprintf(InboxPrefix(PublicKey(userNkey))))
 
 			pterm.Success.Printfln(`❗️In your client application, you need to configure a custom %s as stated above.`, bold.Sprint("Inbox Prefix"))
-			pterm.Success.Printfln(`❗️for CLI usage, use %s ...`, bold.Sprintf("nats --inbox-prefix=%s", InboxPrefix(publicKey(userNkey))))
-			pterm.Success.Printfln(`KUBERNETES Secret: %s`, bold.Sprintf("kubectl create secret generic nats-creds --from-file=auth.creds=./nsc/nkeys/creds/%s/%s/%s.creds --from-literal=NATS_INBOX_PREFIX=%s", operator, account, user, InboxPrefix(publicKey(userNkey))))
+			pterm.Success.Printfln(`❗️for CLI usage, use %s ...`, bold.Sprintf("nats --inbox-prefix=%s", InboxPrefix(PublicKey(userNkey))))
+			pterm.Success.Printfln(`KUBERNETES Secret: %s`, bold.Sprintf("kubectl create secret generic nats-creds --from-file=auth.creds=%s --from-literal=NATS_INBOX_PREFIX=%s", credsFile, InboxPrefix(PublicKey(userNkey))))
 
 			serverUrl := ""
 			if operator == "ROOT_natsv1" {
@@ -100,11 +132,31 @@ to quickly create a Cobra application.`,
 				natscontext.WithServerURL(serverUrl),
 				natscontext.WithCreds(credsFile),
 			)
-			panicOnErr(err)
-			panicOnErr(c.Save(""))
+			if err != nil {
+				return err
+			}
+			if err := c.Save(""); err != nil {
+				return fmt.Errorf("saving nats context %s: %w", contextName, err)
+			}
 			//nats --creds=./nsc/nkeys/creds/ROOT_natsv1/SANDSTORM/admin.creds --server tls://natsv1.cloud.sandstorm.de:32222  context save --select natsv1_sandstorm_admin
 
 			pterm.Success.Printfln(`Created nats context: %s. To select, run %s`, bold.Sprint(contextName), bold.Sprint("nats context select"))
+			return printResult(UserResult{
+				Operator:      string(operator),
+				Account:       string(account),
+				Role:          string(role),
+				User:          string(user),
+				UserPublicKey: PublicKey(userNkey),
+				CredsFile:     credsFile,
+				InboxPrefix:   InboxPrefix(PublicKey(userNkey)),
+				ContextName:   contextName,
+			})
 		},
 	}
+	cmd.Flags().StringVar(&operatorFlag, "operator", "", "operator name (env: OPERATOR_NAME)")
+	cmd.Flags().StringVar(&accountFlag, "account", "", "account name (env: ACCOUNT_NAME)")
+	cmd.Flags().StringVar(&roleFlag, "role", "", "role (scoped signing key) to create the user for (env: ROLE_NAME)")
+	cmd.Flags().StringVar(&userFlag, "user", "", "user name, by convention lowercase (env: USER_NAME)")
+	registerStoreCompletions(cmd, &cfg)
+	return cmd
 }
@@ -2,8 +2,7 @@ package cmd
 
 import (
 	"bytes"
-	"filippo.io/age"
-	"filippo.io/age/armor"
+	"errors"
 	"fmt"
 	"github.com/bitfield/script"
 	"github.com/muesli/termenv"
@@ -12,6 +11,9 @@ import (
 	"github.com/pterm/pterm"
 	"github.com/sandstorm/natsCtl/cli/common"
 	"github.com/sandstorm/natsCtl/cli/config"
+	"github.com/sandstorm/natsCtl/cli/keystore"
+	"github.com/sandstorm/natsCtl/cli/transaction"
+	"github.com/spf13/cobra"
 	"io"
 	"os"
 	"path/filepath"
@@ -19,113 +21,57 @@ import (
 	"text/template"
 )
 
-// To create the AGE key: age-keygen 2>/dev/null | grep SECRET-KEY
-func storeAndEncryptNkey(key nkeys.KeyPair, masterPasswordDecryptor config.MasterPasswordDecryptor) {
-	pk := PublicKey(key)
-	ageIdentity, err := masterPasswordDecryptor.LoadMasterPassword()
-	panicOnErr(err)
-
-	ageR := ageIdentityToRecipients(ageIdentity)
-	err = os.MkdirAll(filepath.Dir(keyPath(pk)), 0700)
-	panicOnErr(err)
-	f, err := os.OpenFile(string(keyPath(pk))+".age", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
-	panicOnErr(err)
-	armorWriter := armor.NewWriter(f)
-	plaintext, err := age.Encrypt(armorWriter, ageR...)
-	panicOnErr(err)
-
-	// do the actual encryption
-	s, err := key.Seed()
-	panicOnErr(err)
-	plaintext.Write(s)
-
-	// close all files
-	plaintext.Close()
-	armorWriter.Close()
-	f.Close()
-}
-
-func ageIdentityToRecipients(ageIdentity string) []age.Recipient {
-	var ageR []age.Recipient
-	ids, err := age.ParseIdentities(strings.NewReader(ageIdentity))
-	// taken from age-keygen function convert
-	panicOnErr(err)
-	for _, id := range ids {
-		id, ok := id.(*age.X25519Identity)
-		if !ok {
-			panic(fmt.Sprintf("internal error: unexpected identity type: %T", id))
-		}
-		ageR = append(ageR, id.Recipient())
+func getOperatorSigningKey(cfg *config.Config, operator OperatorName) (OperatorSigningKey, error) {
+	operatorClaims, err := readOperator(cfg, operator)
+	if err != nil {
+		return "", err
 	}
-	return ageR
-}
-
-func decryptNkey(pubkey Key, masterPassword config.MasterPasswordDecryptor) nkeys.KeyPair {
-	ageIdentity, err := masterPassword.LoadMasterPassword()
-	panicOnErr(err)
-
-	ageKeys, err := age.ParseIdentities(strings.NewReader(ageIdentity))
-	panicOnErr(err)
-
-	f, err := os.OpenFile(string(keyPath(pubkey.Key()))+".age", os.O_RDONLY, 0600)
-	panicOnErr(err)
-	armorReader := armor.NewReader(f)
-	decryptedReader, err := age.Decrypt(armorReader, ageKeys...)
-	panicOnErr(err)
-
-	decrypted, err := io.ReadAll(decryptedReader)
-	panicOnErr(err)
-
-	keyPair, err := nkeys.FromSeed(decrypted)
-	panicOnErr(err)
-
-	return keyPair
-}
-
-func getOperatorSigningKey(operator OperatorName) OperatorSigningKey {
-	for _, signingKey := range readOperator(operator).SigningKeys {
-		return OperatorSigningKey(signingKey)
+	for _, signingKey := range operatorClaims.SigningKeys {
+		return OperatorSigningKey(signingKey), nil
 	}
-	panic("No Operator Signing Key found")
+	return "", fmt.Errorf("%w: no signing key for operator %s", common.ErrNotFound, operator)
 }
 
 // getAccountSigningKey returns the UN-SCOPED signing key for the account, if it exists
-func getAccountSigningKey(accountClaims *jwt.AccountClaims) AccountSigningKey {
+func getAccountSigningKey(accountClaims *jwt.AccountClaims) (AccountSigningKey, error) {
 	for key, keyScope := range accountClaims.SigningKeys {
 		if keyScope == nil {
 			// regular signing keys don't have a scope
-			return AccountSigningKey(key)
+			return AccountSigningKey(key), nil
 		}
 	}
-	panic("No un-scoped account signing key found")
-}
-
-func keyPath(pubkey string) string {
-	return fmt.Sprintf("nsc/nkeys/keys/%s/%s/%s.nk", pubkey[0:1], pubkey[1:3], pubkey)
+	return "", fmt.Errorf("%w: no un-scoped signing key for account %s", common.ErrNotFound, accountClaims.Name)
 }
 
-func writeUnencryptedNkey(nkey nkeys.KeyPair) {
-	pk, err := nkey.PublicKey()
-	panicOnErr(err)
-	s, err := nkey.Seed()
-	panicOnErr(err)
-
-	err = os.WriteFile(keyPath(pk), s, 0700)
-	panicOnErr(err)
+func genAndEncryptAccountSigningKey(keyStore keystore.KeyStore) (AccountSigningKey, error) {
+	k, err := nkeys.CreateAccount()
+	if err != nil {
+		return "", err
+	}
+	if err := keyStore.Put(k); err != nil {
+		return "", fmt.Errorf("storing account signing key: %w", err)
+	}
+	return AccountSigningKey(PublicKey(k)), nil
 }
 
-func rmUnencryptedNkey(nkey nkeys.KeyPair) {
-	pk, err := nkey.PublicKey()
-	panicOnErr(err)
-	err = os.Remove(keyPath(pk))
-	panicOnErr(err)
+// unlock unlocks the master key storage; failures are classified as common.ErrDecryption.
+func unlock(cfg *config.Config) error {
+	if err := cfg.MasterPasswordDecryptor().Unlock(); err != nil {
+		return fmt.Errorf("%w: unlocking master key: %w", common.ErrDecryption, err)
+	}
+	return nil
 }
 
-func genAndEncryptAccountSigningKey(masterPasswordDecryptor config.MasterPasswordDecryptor) AccountSigningKey {
-	k, err := nkeys.CreateAccount()
-	panicOnErr(err)
-	storeAndEncryptNkey(k, masterPasswordDecryptor)
-	return AccountSigningKey(PublicKey(k))
+// loadKey decrypts the NKey from the key store.
+func loadKey(cfg *config.Config, key Key) (nkeys.KeyPair, error) {
+	keyPair, err := cfg.KeyStore().Get(key.Key())
+	if errors.Is(err, keystore.ErrNotFound) {
+		return nil, fmt.Errorf("%w: nkey %s is not in the key store", common.ErrNotFound, key.Key())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: nkey %s: %w", common.ErrDecryption, key.Key(), err)
+	}
+	return keyPair, nil
 }
 
 func ExecAndStdout(format string, args ...any) func(p *script.Pipe) *script.Pipe {
@@ -141,7 +87,7 @@ func ExecAndStdout(format string, args ...any) func(p *script.Pipe) *script.Pipe
 }
 
 func StdoutAndContinue(reader io.Reader, _ io.Writer) error {
-	_, err := io.Copy(os.Stdout, reader)
+	_, err := io.Copy(humanOutput(), reader)
 	return err
 }
 
@@ -154,46 +100,85 @@ func Printfln(prefixPrinter pterm.PrefixPrinter, s string, args ...any) func(p *
 	}
 }
 
-func chooseOperator() OperatorName {
-	operators := getOperators()
+// exactArgs is cobra.ExactArgs, classifying a wrong number of arguments as common.ErrValidation.
+func exactArgs(n int) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := cobra.ExactArgs(n)(cmd, args); err != nil {
+			return fmt.Errorf("%w: %w", common.ErrValidation, err)
+		}
+		return nil
+	}
+}
+
+// flagOrEnv returns the flag value if given; and falls back to the environment variable otherwise.
+func flagOrEnv(flagValue string, envVar string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv(envVar)
+}
+
+func chooseOperator(cfg *config.Config) (OperatorName, error) {
+	operators, err := getOperators(cfg)
+	if err != nil {
+		return "", err
+	}
+	if len(operators) == 0 {
+		return "", fmt.Errorf("%w: no operator in %s - run init-operator first", common.ErrNotFound, cfg.StorePath("store"))
+	}
 	if len(operators) == 1 {
-		return OperatorName(operators[0])
+		return OperatorName(operators[0]), nil
+	}
+	if err := common.RequireInteractive("OPERATOR_NAME", "operator", "OPERATOR_NAME"); err != nil {
+		return "", err
 	}
 
 	operatorName, err := pterm.DefaultInteractiveSelect.
 		WithOptions(operators).
 		Show()
-	panicOnErr(err)
-	return OperatorName(operatorName)
+	return OperatorName(operatorName), err
 }
 
-func getOperators() []string {
-	operators, err := script.ListFiles("nsc/store/").
+func getOperators(cfg *config.Config) ([]string, error) {
+	operators, err := script.ListFiles(cfg.StorePath("store")).
 		FilterLine(filepath.Base).
 		Slice()
-	panicOnErr(err)
-	return operators
+	if err != nil {
+		return nil, fmt.Errorf("listing operators: %w", err)
+	}
+	return operators, nil
 }
 
-func chooseAccount(operatorName OperatorName) AccountName {
+func chooseAccount(cfg *config.Config, operatorName OperatorName) (AccountName, error) {
+	if err := common.RequireInteractive("ACCOUNT_NAME", "account", "ACCOUNT_NAME"); err != nil {
+		return "", err
+	}
+	accounts, err := getAccounts(cfg, operatorName)
+	if err != nil {
+		return "", err
+	}
 	accountName, err := pterm.DefaultInteractiveSelect.
-		WithOptions(getAccounts(operatorName)).
+		WithOptions(accounts).
 		Show()
-	panicOnErr(err)
-	return AccountName(accountName)
+	return AccountName(accountName), err
 }
 
-func getAccounts(operatorName OperatorName) []string {
-	accounts, err := script.ListFiles(fmt.Sprintf(`nsc/store/%s/accounts`, operatorName)).
+func getAccounts(cfg *config.Config, operatorName OperatorName) ([]string, error) {
+	accounts, err := script.ListFiles(cfg.StorePath("store", string(operatorName), "accounts")).
 		FilterLine(func(s string) string {
 			return filepath.Base(s)
 		}).
 		Slice()
-	panicOnErr(err)
-	return accounts
+	if err != nil {
+		return nil, fmt.Errorf("listing accounts of operator %s: %w", operatorName, err)
+	}
+	return accounts, nil
 }
 
-func chooseOrCreateRole(accountClaims *jwt.AccountClaims) RoleName {
+func chooseOrCreateRole(accountClaims *jwt.AccountClaims) (RoleName, error) {
+	if err := common.RequireInteractive("ROLE_NAME", "role", "ROLE_NAME"); err != nil {
+		return "", err
+	}
 	addRole := "Add new role"
 	options := []string{addRole}
 	options = append(options, getRoleNames(accountClaims)...)
@@ -202,11 +187,14 @@ func chooseOrCreateRole(accountClaims *jwt.AccountClaims) RoleName {
 		WithOptions(options).
 		WithDefaultOption(addRole).
 		Show()
-	panicOnErr(err)
+	if err != nil {
+		return "", err
+	}
 	if selection == addRole {
-		return RoleName(common.RequiredTextInput("ROLE_NAME"))
+		role, err := common.RequiredTextInput("ROLE_NAME")
+		return RoleName(role), err
 	}
-	return RoleName(selection)
+	return RoleName(selection), nil
 }
 
 func getRoleNames(accountClaims *jwt.AccountClaims) []string {
@@ -223,12 +211,18 @@ func getRoleNames(accountClaims *jwt.AccountClaims) []string {
 	return roleNames
 }
 
-func chooseRole(accountClaims *jwt.AccountClaims) RoleName {
+func chooseRole(accountClaims *jwt.AccountClaims) (RoleName, error) {
+	if err := common.RequireInteractive("ROLE_NAME", "role", "ROLE_NAME"); err != nil {
+		return "", err
+	}
+	roleNames := getRoleNames(accountClaims)
+	if len(roleNames) == 0 {
+		return "", fmt.Errorf("%w: account %s has no roles - create one with scoped-signing-key", common.ErrNotFound, accountClaims.Name)
+	}
 	selection, err := pterm.DefaultInteractiveSelect.
-		WithOptions(getRoleNames(accountClaims)).
+		WithOptions(roleNames).
 		Show()
-	panicOnErr(err)
-	return RoleName(selection)
+	return RoleName(selection), err
 }
 
 func scopedSigningKeyForRole(accountClaims *jwt.AccountClaims, role RoleName) *jwt.UserScope {
@@ -244,61 +238,90 @@ func scopedSigningKeyForRole(accountClaims *jwt.AccountClaims, role RoleName) *j
 
 var bold = pterm.NewStyle(pterm.Bold)
 
-func panicOnErr(err error) {
-	if err != nil {
-		// NOTE: Panic will STILL call defer; so we can clean up files in main() defer
-		panic(err)
-	}
+func operatorJwtPath(cfg *config.Config, operator OperatorName) string {
+	return cfg.StorePath("store", string(operator), string(operator)+".jwt")
+}
+
+func accountJwtPath(cfg *config.Config, operator OperatorName, account AccountName) string {
+	return cfg.StorePath("store", string(operator), "accounts", string(account), string(account)+".jwt")
+}
+
+// credsPath is the .creds file of a user created by user or admin-user.
+func credsPath(cfg *config.Config, operator OperatorName, account AccountName, user UserName) string {
+	return cfg.StorePath("nkeys", "creds", string(operator), string(account), string(user)+".creds")
 }
 
-func readOperator(operator OperatorName) *jwt.OperatorClaims {
-	accountJwt, err := os.ReadFile(fmt.Sprintf("nsc/store/%s/%s.jwt", operator, operator))
-	panicOnErr(err)
-	operatorClaims, err := jwt.DecodeOperatorClaims(string(accountJwt))
-	panicOnErr(err)
-	return operatorClaims
+func readOperator(cfg *config.Config, operator OperatorName) (*jwt.OperatorClaims, error) {
+	operatorJwt, err := os.ReadFile(operatorJwtPath(cfg, operator))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: operator %s", common.ErrNotFound, operator)
+	}
+	if err != nil {
+		return nil, err
+	}
+	operatorClaims, err := jwt.DecodeOperatorClaims(string(operatorJwt))
+	if err != nil {
+		return nil, fmt.Errorf("decoding JWT of operator %s: %w", operator, err)
+	}
+	return operatorClaims, nil
 }
 
-func ExistsAccount(operator OperatorName, account AccountName) bool {
-	_, err := os.Stat(fmt.Sprintf("nsc/store/%s/accounts/%s/%s.jwt", operator, account, account))
+func ExistsAccount(cfg *config.Config, operator OperatorName, account AccountName) bool {
+	_, err := os.Stat(accountJwtPath(cfg, operator, account))
 	return err == nil
 }
 
-func readAccount(operator OperatorName, account AccountName) *jwt.AccountClaims {
-	accountJwt, err := os.ReadFile(fmt.Sprintf("nsc/store/%s/accounts/%s/%s.jwt", operator, account, account))
-	panicOnErr(err)
+func readAccount(cfg *config.Config, operator OperatorName, account AccountName) (*jwt.AccountClaims, error) {
+	accountJwt, err := os.ReadFile(accountJwtPath(cfg, operator, account))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: account %s in operator %s", common.ErrNotFound, account, operator)
+	}
+	if err != nil {
+		return nil, err
+	}
 	accountClaims, err := jwt.DecodeAccountClaims(string(accountJwt))
-	panicOnErr(err)
-	return accountClaims
+	if err != nil {
+		return nil, fmt.Errorf("decoding JWT of account %s: %w", account, err)
+	}
+	return accountClaims, nil
 }
 
-func writeAccount(operator OperatorName, claims *jwt.AccountClaims, operatorSigningKey nkeys.KeyPair) string {
+// writeAccount stages the account JWT in the transaction; it is written on tx.Commit()
+func writeAccount(cfg *config.Config, tx *transaction.Tx, operator OperatorName, claims *jwt.AccountClaims, operatorSigningKey nkeys.KeyPair) (string, error) {
 	encoded, err := claims.Encode(operatorSigningKey)
-	panicOnErr(err)
-	panicOnErr(os.MkdirAll(fmt.Sprintf("nsc/store/%s/accounts/%s", operator, claims.Name), 0755))
-	err = os.WriteFile(fmt.Sprintf("nsc/store/%s/accounts/%s/%s.jwt", operator, claims.Name, claims.Name), []byte(encoded), 0644)
-	panicOnErr(err)
-	return encoded
+	if err != nil {
+		return "", fmt.Errorf("encoding JWT of account %s: %w", claims.Name, err)
+	}
+	err = tx.WriteFile(accountJwtPath(cfg, operator, AccountName(claims.Name)), []byte(encoded), 0644)
+	return encoded, err
 }
 
-func writeOperator(operator OperatorName, claims *jwt.OperatorClaims, pair nkeys.KeyPair) string {
+// writeOperator stages the operator JWT in the transaction; it is written on tx.Commit()
+func writeOperator(cfg *config.Config, tx *transaction.Tx, operator OperatorName, claims *jwt.OperatorClaims, pair nkeys.KeyPair) (string, error) {
 	encoded, err := claims.Encode(pair)
-	panicOnErr(err)
-	panicOnErr(os.MkdirAll(fmt.Sprintf("nsc/store/%s", operator), 0755))
-	err = os.WriteFile(fmt.Sprintf("nsc/store/%s/%s.jwt", operator, operator), []byte(encoded), 0644)
-	panicOnErr(err)
-	return encoded
+	if err != nil {
+		return "", fmt.Errorf("encoding JWT of operator %s: %w", operator, err)
+	}
+	err = tx.WriteFile(operatorJwtPath(cfg, operator), []byte(encoded), 0644)
+	return encoded, err
 }
 
+// PublicKey returns the public key of a key pair; this only fails for wiped or invalid key pairs,
+// which is a programming error.
 func PublicKey(nkey nkeys.KeyPair) string {
 	p, err := nkey.PublicKey()
-	panicOnErr(err)
+	if err != nil {
+		panic(err)
+	}
 	return p
 }
 
+// Seed returns the seed of a key pair; see PublicKey.
 func Seed(nkey nkeys.KeyPair) []byte {
 	p, err := nkey.Seed()
-	panicOnErr(err)
+	if err != nil {
+		panic(err)
+	}
 	return p
 }
 
@@ -310,11 +333,16 @@ func init() {
 	f := output.TemplateFuncs()
 	tpl = template.New("tpl").Funcs(f)
 }
-func PrintlnTemplated(text string) {
+func PrintlnTemplated(text string) error {
 	tpl, err := tpl.Parse(text)
-	panicOnErr(err)
+	if err != nil {
+		return err
+	}
 
 	var buf bytes.Buffer
-	panicOnErr(tpl.Execute(&buf, nil))
+	if err := tpl.Execute(&buf, nil); err != nil {
+		return err
+	}
 	fmt.Println(&buf)
+	return nil
 }
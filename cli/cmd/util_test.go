@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/sandstorm/natsCtl/cli/config"
+	"github.com/sandstorm/natsCtl/cli/transaction"
+)
+
+func newOperatorKey(t *testing.T) nkeys.KeyPair {
+	t.Helper()
+	key, err := nkeys.CreateOperator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// testOperator is an operator in a store in a temp dir, with its root and signing key.
+type testOperator struct {
+	cfg        *config.Config
+	name       OperatorName
+	claims     *jwt.OperatorClaims
+	rootKey    nkeys.KeyPair
+	signingKey nkeys.KeyPair
+}
+
+func newTestOperator(t *testing.T, name OperatorName) *testOperator {
+	t.Helper()
+	o := &testOperator{
+		cfg:        &config.Config{StoreRoot: t.TempDir()},
+		name:       name,
+		rootKey:    newOperatorKey(t),
+		signingKey: newOperatorKey(t),
+	}
+	o.claims = jwt.NewOperatorClaims(PublicKey(o.rootKey))
+	o.claims.Name = string(name)
+	o.claims.SigningKeys.Add(PublicKey(o.signingKey))
+	tx := transaction.New()
+	if _, err := writeOperator(o.cfg, tx, name, o.claims, o.rootKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+// addAccount writes an account signed by the given key, and returns its key pair.
+func (o *testOperator) addAccount(t *testing.T, name AccountName, signer nkeys.KeyPair, configure func(claims *jwt.AccountClaims)) nkeys.KeyPair {
+	t.Helper()
+	accountKey, err := nkeys.CreateAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.NewAccountClaims(PublicKey(accountKey))
+	claims.Name = string(name)
+	if configure != nil {
+		configure(claims)
+	}
+	tx := transaction.New()
+	if _, err := writeAccount(o.cfg, tx, o.name, claims, signer); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	return accountKey
+}
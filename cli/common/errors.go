@@ -0,0 +1,54 @@
+package common
+
+import "errors"
+
+// Error classes. Errors are wrapped with one of them (f.e. fmt.Errorf("%w: account %s", common.ErrNotFound, name)),
+// so that the process exits with a distinct exit code per class - see ExitCode.
+var (
+	ErrConfig     = errors.New("configuration error")
+	ErrDecryption = errors.New("key decryption failed")
+	ErrNotFound   = errors.New("not found")
+	ErrNsc        = errors.New("nsc failed")
+	ErrValidation = errors.New("invalid input")
+	// ErrAccountServer is returned if push or pull failed, or the account server rejected a JWT.
+	ErrAccountServer = errors.New("account server failed")
+	// ErrUnhealthy is returned by doctor if it found problems.
+	ErrUnhealthy = errors.New("health check failed")
+)
+
+const (
+	ExitCodeOk            = 0
+	ExitCodeUnknown       = 1
+	ExitCodeValidation    = 2
+	ExitCodeConfig        = 3
+	ExitCodeDecryption    = 4
+	ExitCodeNotFound      = 5
+	ExitCodeNsc           = 6
+	ExitCodeUnhealthy     = 7
+	ExitCodeAccountServer = 8
+)
+
+// ExitCode returns the exit code for the class of the error; ExitCodeUnknown for unclassified errors.
+// If an error has multiple classes, the first matching one below wins.
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitCodeOk
+	case errors.Is(err, ErrConfig):
+		return ExitCodeConfig
+	case errors.Is(err, ErrValidation):
+		return ExitCodeValidation
+	case errors.Is(err, ErrDecryption):
+		return ExitCodeDecryption
+	case errors.Is(err, ErrNotFound):
+		return ExitCodeNotFound
+	case errors.Is(err, ErrNsc):
+		return ExitCodeNsc
+	case errors.Is(err, ErrUnhealthy):
+		return ExitCodeUnhealthy
+	case errors.Is(err, ErrAccountServer):
+		return ExitCodeAccountServer
+	default:
+		return ExitCodeUnknown
+	}
+}
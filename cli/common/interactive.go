@@ -0,0 +1,63 @@
+package common
+
+import (
+	"fmt"
+	"golang.org/x/term"
+	"os"
+	"strings"
+)
+
+// NonInteractiveEnvVar disables all prompts when set to 1 - same as the --non-interactive flag.
+const NonInteractiveEnvVar = "NATSCTL_NON_INTERACTIVE"
+
+var nonInteractive = os.Getenv(NonInteractiveEnvVar) == "1"
+
+// SetNonInteractive disables all prompts (--non-interactive flag).
+func SetNonInteractive(value bool) {
+	if value {
+		nonInteractive = true
+	}
+}
+
+// IsInteractive is true if we are allowed to prompt for input: prompts were not disabled,
+// and a TTY is attached (otherwise, we'd block forever, f.e. in CI).
+func IsInteractive() bool {
+	return !nonInteractive && term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// MissingInputError is raised instead of prompting when running non-interactively.
+type MissingInputError struct {
+	// Name of the input, f.e. OPERATOR_NAME
+	Name string
+	// Flag which specifies the input (without leading --); might be empty
+	Flag string
+	// EnvVar which specifies the input; might be empty
+	EnvVar string
+}
+
+func (e *MissingInputError) Error() string {
+	var sources []string
+	if e.Flag != "" {
+		sources = append(sources, "--"+e.Flag)
+	}
+	if e.EnvVar != "" {
+		sources = append(sources, e.EnvVar)
+	}
+	if len(sources) == 0 {
+		return fmt.Sprintf("missing input %s: cannot prompt when running non-interactively", e.Name)
+	}
+	return fmt.Sprintf("missing input %s: cannot prompt when running non-interactively - specify %s", e.Name, strings.Join(sources, " or "))
+}
+
+// Is classifies missing inputs as ErrValidation.
+func (e *MissingInputError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// RequireInteractive returns a MissingInputError if we are not allowed to prompt for the given input.
+func RequireInteractive(name, flag, envVar string) error {
+	if !IsInteractive() {
+		return &MissingInputError{Name: name, Flag: flag, EnvVar: envVar}
+	}
+	return nil
+}
@@ -1,37 +1,61 @@
 package common
 
 import (
+	"fmt"
 	"github.com/pterm/pterm"
 	"regexp"
 )
 
 const PrivateInboxSelector = "_PRIV_INBOX.{{subject()}}.>"
 
-func RequiredTextInput(prompt string) string {
+func RequiredTextInput(prompt string) (string, error) {
+	if err := RequireInteractive(prompt, "", ""); err != nil {
+		return "", err
+	}
 	for {
 		value, err := pterm.DefaultInteractiveTextInput.Show(prompt)
 		if err != nil {
-			panic(err)
+			return "", fmt.Errorf("reading %s: %w", prompt, err)
 		}
 		if len(value) > 0 {
-			return value
+			return value, nil
 		} else {
 			pterm.Warning.Println("Required input - please try again.")
 		}
 	}
 }
 
-func TextInputMatchingRegex(prompt string, regexp *regexp.Regexp) string {
+func TextInputMatchingRegex(prompt string, regexp *regexp.Regexp) (string, error) {
+	if err := RequireInteractive(prompt, "", ""); err != nil {
+		return "", err
+	}
 	for {
 		value, err := pterm.DefaultInteractiveTextInput.Show(prompt)
 		if err != nil {
-			panic(err)
+			return "", fmt.Errorf("reading %s: %w", prompt, err)
 		}
 		if regexp.Match([]byte(value)) {
-			return value
+			return value, nil
 		} else {
 			pterm.Warning.Println("Input does not match regex " + regexp.String())
 		}
 
 	}
 }
+
+func RequiredPasswordInput(prompt string) (string, error) {
+	if err := RequireInteractive(prompt, "", ""); err != nil {
+		return "", err
+	}
+	for {
+		value, err := pterm.DefaultInteractiveTextInput.WithMask("*").Show(prompt)
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %w", prompt, err)
+		}
+		if len(value) > 0 {
+			return value, nil
+		} else {
+			pterm.Warning.Println("Required input - please try again.")
+		}
+	}
+}
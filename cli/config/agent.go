@@ -0,0 +1,24 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sandstorm/natsCtl/cli/agent"
+)
+
+// agentDecryptor is used when a natsCtl agent is running (NATSCTL_AGENT_SOCK is set). The master identity
+// never leaves the agent; encryption and decryption are done by the agent, see Config.Agent().
+type agentDecryptor struct {
+	client *agent.Client
+}
+
+func (a *agentDecryptor) Unlock() error {
+	if err := a.client.Ping(); err != nil {
+		return fmt.Errorf("%w - start it with 'natsCtl agent', or unset %s", err, agent.SocketEnvVar)
+	}
+	return nil
+}
+
+func (a *agentDecryptor) LoadMasterPassword() (string, error) {
+	return "", errors.New("the master identity is held by the natsCtl agent and cannot be loaded - unset " + agent.SocketEnvVar + " for this operation")
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"filippo.io/age"
+	"fmt"
+	"github.com/sandstorm/natsCtl/cli/keystore"
+)
+
+// KeyStore returns the store for all NKeys; by default, AGE encrypted files in c.KeysDir().
+func (c *Config) KeyStore() keystore.KeyStore {
+	if c.keyStore == nil {
+		c.keyStore = keystore.NewAgeDirStore(c.KeysDir(), c.MasterKeyCipher())
+	}
+	return c.keyStore
+}
+
+// KeyStoreIn returns the key store, staging all writes in the transaction (if supported by the store).
+func (c *Config) KeyStoreIn(tx keystore.FileWriter) keystore.KeyStore {
+	if s, ok := c.KeyStore().(*keystore.AgeDirStore); ok {
+		return s.WithWriter(tx)
+	}
+	return c.KeyStore()
+}
+
+// SetKeyStore replaces the key store, f.e. with a keystore.MemoryStore in tests.
+func (c *Config) SetKeyStore(keyStore keystore.KeyStore) {
+	c.keyStore = keyStore
+}
+
+// MasterKeyCipher encrypts to the configured recipients and decrypts with the master identity.
+func (c *Config) MasterKeyCipher() keystore.Cipher {
+	return &masterKeyCipher{cfg: c}
+}
+
+type masterKeyCipher struct {
+	cfg *Config
+}
+
+// Encrypt always encrypts locally, so the plaintext never leaves the process. If the natsCtl agent is running (and no
+// recipients file is configured, which does not need the master identity), the recipients are fetched from it.
+func (m *masterKeyCipher) Encrypt(plaintext []byte) ([]byte, error) {
+	var recipients []age.Recipient
+	if a := m.cfg.Agent(); a != nil && len(m.cfg.RecipientsFile) == 0 {
+		agentRecipients, err := a.Recipients()
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range agentRecipients {
+			r, err := ParseAgentRecipient(s)
+			if err != nil {
+				return nil, fmt.Errorf("recipient of the agent: %w", err)
+			}
+			recipients = append(recipients, r)
+		}
+	} else {
+		var err error
+		if recipients, err = m.cfg.EncryptionRecipients(); err != nil {
+			return nil, err
+		}
+	}
+	return keystore.EncryptArmored(plaintext, recipients)
+}
+
+// Decrypt decrypts via the natsCtl agent if it is running; otherwise with the master identity.
+func (m *masterKeyCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	if a := m.cfg.Agent(); a != nil {
+		return a.Decrypt(ciphertext)
+	}
+	ageIdentity, err := m.cfg.MasterPasswordDecryptor().LoadMasterPassword()
+	if err != nil {
+		return nil, err
+	}
+	// any of the identities (AGE or SSH) may match one of the recipients the key was encrypted to.
+	identities, err := ParseIdentities(ageIdentity)
+	if err != nil {
+		return nil, err
+	}
+	return keystore.DecryptArmored(ciphertext, identities)
+}
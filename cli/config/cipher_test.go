@@ -0,0 +1,22 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/sandstorm/natsCtl/cli/keystore"
+	"github.com/sandstorm/natsCtl/cli/transaction"
+)
+
+func TestSetKeyStore(t *testing.T) {
+	cfg := &Config{}
+	store := keystore.NewMemoryStore()
+	cfg.SetKeyStore(store)
+
+	if cfg.KeyStore() != store {
+		t.Error("expected KeyStore to return the configured store")
+	}
+	// only the AgeDirStore stages its writes in the transaction.
+	if cfg.KeyStoreIn(transaction.New()) != store {
+		t.Error("expected KeyStoreIn to return the configured store")
+	}
+}
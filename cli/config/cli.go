@@ -0,0 +1,22 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// runCli executes a password manager CLI (found in $PATH) and returns its stdout.
+// The arguments are passed as-is to the process (no shell involved), so entry names
+// containing quotes or spaces are safe.
+func runCli(name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s %s failed: %w: %s", name, args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
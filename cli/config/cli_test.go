@@ -0,0 +1,96 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+// fakeCli puts an executable shell script with the given name first in $PATH. The script gets the environment
+// variable ARGS_FILE, to record its arguments (one per line).
+func fakeCli(t *testing.T, name string, script string) (argsFile string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake CLIs are shell scripts")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	argsFile = filepath.Join(dir, "args")
+	t.Setenv("ARGS_FILE", argsFile)
+	return argsFile
+}
+
+// recordedArgs returns the arguments the fake CLI was called with last.
+func recordedArgs(t *testing.T, argsFile string) []string {
+	t.Helper()
+	args, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatalf("the fake CLI was not called: %s", err)
+	}
+	return strings.Split(strings.TrimSuffix(string(args), "\n"), "\n")
+}
+
+func assertArgs(t *testing.T, actual []string, expected ...string) {
+	t.Helper()
+	if strings.Join(actual, "\x00") != strings.Join(expected, "\x00") {
+		t.Errorf("expected arguments %q, got %q", expected, actual)
+	}
+}
+
+func newIdentity(t *testing.T) string {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identity.String()
+}
+
+func TestRunCliPassesArgumentsWithoutShell(t *testing.T) {
+	argsFile := fakeCli(t, "fake-cli", `printf '%s\n' "$@" > "$ARGS_FILE"; echo output`)
+
+	out, err := runCli("fake-cli", "get", `it's a "quoted" $entry; rm -rf /`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "output\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+	assertArgs(t, recordedArgs(t, argsFile), "get", `it's a "quoted" $entry; rm -rf /`)
+}
+
+func TestRunCliReportsStderr(t *testing.T) {
+	fakeCli(t, "fake-cli", `echo "vault is locked" >&2; exit 1`)
+
+	_, err := runCli("fake-cli", "get", "entry")
+	if err == nil || !strings.Contains(err.Error(), "vault is locked") {
+		t.Errorf("expected the error to contain stderr, got %v", err)
+	}
+}
+
+func TestBitwardenPassesEntryNameWithQuotes(t *testing.T) {
+	identity := newIdentity(t)
+	entryName := `nats "master" key's`
+	argsFile := fakeCli(t, "bw", `printf '%s\n' "$@" > "$ARGS_FILE"; echo "`+identity+`"`)
+	t.Setenv("BW_SESSION", "session")
+
+	b := &bitwardenDecryptor{bitwardenVaultEntryName: entryName}
+	if err := b.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := b.LoadMasterPassword()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(loaded) != identity {
+		t.Errorf("expected the identity, got %q", loaded)
+	}
+	assertArgs(t, recordedArgs(t, argsFile), "get", "password", entryName)
+}
@@ -5,53 +5,105 @@ import (
 	"errors"
 	"filippo.io/age"
 	"fmt"
-	"github.com/bitfield/script"
 	"github.com/pterm/pterm"
+	"github.com/sandstorm/natsCtl/cli/agent"
 	"github.com/sandstorm/natsCtl/cli/common"
+	"github.com/sandstorm/natsCtl/cli/keystore"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
 )
 
 const NatsUtilsConfigFile = "natsUtilsCfg.json"
 
 const typeEnvVar = "EnvVar"
+const typeKeyFile = "KeyFile"
+const typePassphraseFile = "PassphraseFile"
 const typeBitwarden = "Bitwarden"
+const typePass = "Pass"
+const typeOnePassword = "OnePassword"
+const typeVault = "Vault"
 
-func LoadConfig() (Config, error) {
+var supportedTypes = []string{
+	typeEnvVar,
+	typeKeyFile,
+	typePassphraseFile,
+	typeBitwarden,
+	typePass,
+	typeOnePassword,
+	typeVault,
+}
+
+// LoadConfig loads natsUtilsCfg.json from root (--root), or from the current directory or one of its parents.
+// If it does not exist, it is bootstrapped interactively. All paths in the config are relative to the config file.
+func LoadConfig(root string) (Config, error) {
 	var config Config
-	file, err := os.ReadFile(NatsUtilsConfigFile)
+	configFile, err := FindConfigFile(root)
+	if err != nil {
+		return config, fmt.Errorf("%w: finding %s: %w", common.ErrConfig, NatsUtilsConfigFile, err)
+	}
+	file, err := os.ReadFile(configFile)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			BootstrapConfig()
-			return LoadConfig()
+			if err := BootstrapConfig(configFile); err != nil {
+				return config, fmt.Errorf("%w: %s does not exist and could not be created: %w", common.ErrConfig, configFile, err)
+			}
+			return LoadConfig(root)
 		}
-		return config, err
+		return config, fmt.Errorf("%w: %w", common.ErrConfig, err)
 	}
 	err = json.Unmarshal(file, &config)
 	if err != nil {
-		return config, fmt.Errorf("malformed JSON in %s: %w", NatsUtilsConfigFile, err)
+		return config, fmt.Errorf("%w: malformed JSON in %s: %w", common.ErrConfig, configFile, err)
 	}
+	if !isSupportedType(config.MasterPassword.Type) {
+		return config, fmt.Errorf("%w: master password type '%s' in %s not supported; only supported: %s", common.ErrConfig, config.MasterPassword.Type, configFile, strings.Join(supportedTypes, " "))
+	}
+
+	config.dir = filepath.Dir(configFile)
+	config.MasterPassword.KeyFilePath = config.resolvePath(config.MasterPassword.KeyFilePath)
+	config.MasterPassword.PassphraseFilePath = config.resolvePath(config.MasterPassword.PassphraseFilePath)
+	config.RecipientsFile = config.resolvePath(config.RecipientsFile)
+	if config.StoreRoot == "" {
+		config.StoreRoot = DefaultStoreRoot
+	}
+	config.StoreRoot = config.resolvePath(config.StoreRoot)
 	return config, nil
 }
 
-func BootstrapConfig() {
-	pterm.DefaultSection.Println("Creating " + NatsUtilsConfigFile + " file.")
+func isSupportedType(masterPasswordType string) bool {
+	for _, t := range supportedTypes {
+		if t == masterPasswordType {
+			return true
+		}
+	}
+	return false
+}
+
+// BootstrapConfig interactively creates the config file at configFile.
+func BootstrapConfig(configFile string) error {
+	// the config file can only be created interactively; so fail early instead of prompting.
+	if err := common.RequireInteractive(NatsUtilsConfigFile, "root", RootEnvVar); err != nil {
+		return err
+	}
+	pterm.DefaultSection.Println("Creating " + configFile + " file.")
 
 	pterm.Println("We protect all NKEYS with a single master-key by using AGE-Encryption.")
 	pterm.Println("This master key can be configured via environment variables (not recommended),")
-	pterm.Println("or loaded from Bitwarden password manager (recommended).")
+	pterm.Println("read from a local key file outside of the repository,")
+	pterm.Println("read from a passphrase protected key file inside the repository,")
+	pterm.Println("or loaded from a password manager - Bitwarden, pass/gopass, 1Password or HashiCorp Vault (recommended).")
 	pterm.Println("")
 	pterm.Println("How do you want to store the master key?")
 	pterm.Println("")
 
 	keyStoreType, err := pterm.DefaultInteractiveSelect.
-		WithOptions([]string{
-			typeEnvVar,
-			typeBitwarden,
-		}).
+		WithOptions(supportedTypes).
 		Show()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	pterm.Println("You can either re-use an existing AGE key, or we can create a new one.")
@@ -59,88 +111,327 @@ func BootstrapConfig() {
 	pterm.Printfln("")
 	k, err := age.GenerateX25519Identity()
 	if err != nil {
-		panic(err)
+		return err
 	}
 	pterm.Printfln("       Private Key (store safely):")
 	pterm.Printfln("       %s", k)
 	pterm.Printfln("")
 
-	c := Config{}
+	// relative paths are entered relative to the config file, as they are resolved when loading the config.
+	c := Config{dir: filepath.Dir(configFile)}
 	switch keyStoreType {
 	case typeEnvVar:
-		pterm.Println("You need to store the private AGE Key in an environment variable MASTER_KEY")
+		pterm.Println("You need to store the private AGE Key in an environment variable " + masterKeyEnvVar)
 		pterm.Println("before calling any operation.")
 		c.MasterPassword = MasterPasswordConfig{
 			Type: typeEnvVar,
 		}
+	case typeKeyFile:
+		pterm.Println("The private AGE Key is read from a file. Make sure this file is NOT committed")
+		pterm.Println("to the repository (f.e. place it in your home directory).")
+		pterm.Println("The file can also contain an AGE plugin identity (f.e. AGE-PLUGIN-YUBIKEY-... from")
+		pterm.Println("age-plugin-yubikey) - then the keys can only be decrypted with the hardware token present.")
+		pterm.Println("")
+		keyFilePath, err := common.RequiredTextInput("Key File Path")
+		if err != nil {
+			return err
+		}
+
+		if _, err := os.Stat(c.resolvePath(keyFilePath)); errors.Is(err, os.ErrNotExist) {
+			pterm.Printfln("Writing the new AGE private key to %s", keyFilePath)
+			err = os.WriteFile(c.resolvePath(keyFilePath), []byte(k.String()+"\n"), 0600)
+			if err != nil {
+				return err
+			}
+		} else {
+			pterm.Printfln("%s already exists; it is used as is.", keyFilePath)
+		}
+
+		c.MasterPassword = MasterPasswordConfig{
+			Type:        typeKeyFile,
+			KeyFilePath: keyFilePath,
+		}
+	case typePassphraseFile:
+		pterm.Println("The private AGE Key is encrypted with a passphrase (like 'age -p') and can be")
+		pterm.Println("committed to the repository. You need to enter the passphrase once per operation")
+		pterm.Println("(or set it in the environment variable " + masterKeyPassphraseEnvVar + ").")
+		pterm.Println("")
+		passphraseFilePath, err := common.RequiredTextInput("Passphrase File Path (f.e. master-key.age)")
+		if err != nil {
+			return err
+		}
+
+		if _, err := os.Stat(c.resolvePath(passphraseFilePath)); errors.Is(err, os.ErrNotExist) {
+			pterm.Printfln("Encrypting the new AGE private key into %s", passphraseFilePath)
+			passphrase, err := passphraseInputWithConfirmation()
+			if err != nil {
+				return err
+			}
+			err = writePassphraseFile(c.resolvePath(passphraseFilePath), k, passphrase)
+			if err != nil {
+				return err
+			}
+		} else {
+			pterm.Printfln("%s already exists; it is used as is.", passphraseFilePath)
+		}
+
+		c.MasterPassword = MasterPasswordConfig{
+			Type:               typePassphraseFile,
+			PassphraseFilePath: passphraseFilePath,
+		}
 	case typeBitwarden:
 		pterm.Println("You need to store the private AGE Key in Bitwarden as password.")
 		pterm.Println("Then you need the 'bw' CLI tool installed, and you need to specify")
 		pterm.Println("the name of the Bitwarden entry of the private key:")
 		pterm.Println("")
-		entryName := common.RequiredTextInput("Bitwarden Entry Name")
+		entryName, err := common.RequiredTextInput("Bitwarden Entry Name")
+		if err != nil {
+			return err
+		}
 
 		c.MasterPassword = MasterPasswordConfig{
 			Type:                    typeBitwarden,
 			BitwardenVaultEntryName: entryName,
 		}
+	case typePass:
+		pterm.Println("You need to store the private AGE Key in pass (or gopass) as the first line of an entry.")
+		pterm.Println("Then you need to specify the name of the entry of the private key:")
+		pterm.Println("")
+		entryName, err := common.RequiredTextInput("pass Entry Name")
+		if err != nil {
+			return err
+		}
+		binary, err := pterm.DefaultInteractiveSelect.
+			WithOptions([]string{"pass", "gopass"}).
+			Show()
+		if err != nil {
+			return err
+		}
+
+		c.MasterPassword = MasterPasswordConfig{
+			Type:          typePass,
+			PassEntryName: entryName,
+			PassBinary:    binary,
+		}
+	case typeOnePassword:
+		pterm.Println("You need to store the private AGE Key in 1Password.")
+		pterm.Println("Then you need the 'op' CLI tool installed, and you need to specify")
+		pterm.Println("the secret reference of the private key, f.e. op://Private/nats-master-key/password:")
+		pterm.Println("")
+		reference, err := common.TextInputMatchingRegex("1Password Secret Reference", regexp.MustCompile(`^op://`))
+		if err != nil {
+			return err
+		}
+
+		c.MasterPassword = MasterPasswordConfig{
+			Type:                 typeOnePassword,
+			OnePasswordReference: reference,
+		}
+	case typeVault:
+		pterm.Println("The private AGE Key is stored in a HashiCorp Vault KV v2 secrets engine.")
+		pterm.Println("Authentication uses VAULT_TOKEN, AppRole (VAULT_ROLE_ID + VAULT_SECRET_ID) or ~/.vault-token.")
+		pterm.Println("")
+		address, err := pterm.DefaultInteractiveTextInput.WithDefaultText(os.Getenv("VAULT_ADDR")).Show("Vault Address (empty to use VAULT_ADDR)")
+		if err != nil {
+			return err
+		}
+		mount, err := pterm.DefaultInteractiveTextInput.WithDefaultText(vaultDefaultMount).Show("KV v2 Mount")
+		if err != nil {
+			return err
+		}
+		secretPath, err := common.RequiredTextInput("Secret Path (f.e. nats/master-key)")
+		if err != nil {
+			return err
+		}
+
+		c.MasterPassword = MasterPasswordConfig{
+			Type:         typeVault,
+			VaultAddress: address,
+			VaultMount:   mount,
+			VaultPath:    secretPath,
+		}
+
+		shouldWrite, err := pterm.DefaultInteractiveConfirm.Show("Write the new AGE private key to Vault now?")
+		if err != nil {
+			return err
+		}
+		if shouldWrite {
+			v := c.MasterPasswordDecryptor().(*vaultDecryptor)
+			if err := v.writeIdentity(k.String()); err != nil {
+				return err
+			}
+			pterm.Success.Printfln("Stored AGE private key in Vault at %s (field %s).", v.secretPath(), v.fieldName())
+		}
 	}
 
 	b, err := json.MarshalIndent(c, "", "  ")
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	pterm.Println("")
-	pterm.Printfln("Writing %s", NatsUtilsConfigFile)
-	err = os.WriteFile(NatsUtilsConfigFile, b, 0644)
-	if err != nil {
-		panic(err)
-	}
+	pterm.Printfln("Writing %s", configFile)
+	return os.WriteFile(configFile, b, 0644)
 }
 
 type MasterPasswordDecryptor interface {
 	// Unlock unlocks the keychain. Can be interactive.
-	Unlock()
+	Unlock() error
 	// LoadMasterPassword loads the master password after Unlock() is called
 	LoadMasterPassword() (string, error)
 }
 type MasterPasswordConfig struct {
 	Type                    string `json:"type"`
-	BitwardenVaultEntryName string `json:"bitwardenVaultEntryName"`
+	BitwardenVaultEntryName string `json:"bitwardenVaultEntryName,omitempty"`
+	// KeyFilePath is only used for type KeyFile
+	KeyFilePath string `json:"keyFilePath,omitempty"`
+	// PassphraseFilePath is only used for type PassphraseFile
+	PassphraseFilePath string `json:"passphraseFilePath,omitempty"`
+	// PassEntryName is only used for type Pass
+	PassEntryName string `json:"passEntryName,omitempty"`
+	// PassBinary is only used for type Pass; "pass" (default) or "gopass"
+	PassBinary string `json:"passBinary,omitempty"`
+	// OnePasswordReference is only used for type OnePassword; f.e. op://Private/nats-master-key/password
+	OnePasswordReference string `json:"onePasswordReference,omitempty"`
+	// OnePasswordAccount is only used for type OnePassword; optional, if multiple accounts are signed in.
+	OnePasswordAccount string `json:"onePasswordAccount,omitempty"`
+	// VaultAddress is only used for type Vault; VAULT_ADDR if empty.
+	VaultAddress string `json:"vaultAddress,omitempty"`
+	// VaultMount is only used for type Vault; the KV v2 mount, "secret" if empty.
+	VaultMount string `json:"vaultMount,omitempty"`
+	// VaultPath is only used for type Vault; the secret path inside the mount.
+	VaultPath string `json:"vaultPath,omitempty"`
+	// VaultField is only used for type Vault; the field inside the secret, "identity" if empty.
+	VaultField string `json:"vaultField,omitempty"`
+	// VaultAppRoleID is only used for type Vault; enables AppRole auth (secret ID is read from VAULT_SECRET_ID).
+	VaultAppRoleID string `json:"vaultAppRoleId,omitempty"`
+	// VaultAppRoleMount is only used for type Vault; "approle" if empty.
+	VaultAppRoleMount string `json:"vaultAppRoleMount,omitempty"`
 }
 
 type Config struct {
-	MasterPassword          MasterPasswordConfig `json:"masterPassword"`
+	MasterPassword MasterPasswordConfig `json:"masterPassword"`
+	// RecipientsFile optionally lists the public keys of all admins (AGE or SSH); every NKey is then
+	// encrypted to all of them, and each admin decrypts with their own identity.
+	RecipientsFile string `json:"recipientsFile,omitempty"`
+	// StoreRoot is the directory of the nsc store, NKeys and .creds files; "nsc" if empty.
+	StoreRoot string `json:"storeRoot,omitempty"`
+	// dir is the directory of the config file; all paths in the config are relative to it.
+	dir                     string
 	masterPasswordDecryptor MasterPasswordDecryptor
+	keyStore                keystore.KeyStore
+}
+
+// EncryptionRecipients returns the recipients every NKey is encrypted to: all entries of the
+// recipients file if configured, otherwise the recipient of the master identity.
+func (c *Config) EncryptionRecipients() ([]age.Recipient, error) {
+	if len(c.RecipientsFile) > 0 {
+		return ParseRecipientsFile(c.RecipientsFile)
+	}
+
+	ageIdentity, err := c.MasterPasswordDecryptor().LoadMasterPassword()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := ParseIdentities(ageIdentity)
+	if err != nil {
+		return nil, err
+	}
+	return IdentitiesToRecipients(ids)
+}
+
+// Agent returns the client of the running natsCtl agent, or nil if NATSCTL_AGENT_SOCK is not set.
+func (c *Config) Agent() *agent.Client {
+	return agent.NewClientFromEnv()
 }
 
 func (c *Config) MasterPasswordDecryptor() MasterPasswordDecryptor {
 	if c.masterPasswordDecryptor == nil {
+		if a := c.Agent(); a != nil {
+			c.masterPasswordDecryptor = &agentDecryptor{client: a}
+			return c.masterPasswordDecryptor
+		}
 		switch c.MasterPassword.Type {
 		case typeBitwarden:
-			return &bitwardenDecryptor{
+			c.masterPasswordDecryptor = &bitwardenDecryptor{
 				bitwardenVaultEntryName: c.MasterPassword.BitwardenVaultEntryName,
 			}
 		case typeEnvVar:
-			return &bitwardenDecryptor{
-				bitwardenVaultEntryName: c.MasterPassword.BitwardenVaultEntryName,
+			c.masterPasswordDecryptor = &envVarDecryptor{
+				envVarName: masterKeyEnvVar,
+			}
+		case typeKeyFile:
+			c.masterPasswordDecryptor = &keyFileDecryptor{
+				keyFilePath: c.MasterPassword.KeyFilePath,
+			}
+		case typePassphraseFile:
+			c.masterPasswordDecryptor = &passphraseFileDecryptor{
+				passphraseFilePath: c.MasterPassword.PassphraseFilePath,
+			}
+		case typePass:
+			c.masterPasswordDecryptor = &passDecryptor{
+				passEntryName: c.MasterPassword.PassEntryName,
+				passBinary:    c.MasterPassword.PassBinary,
+			}
+		case typeOnePassword:
+			c.masterPasswordDecryptor = &onePasswordDecryptor{
+				reference: c.MasterPassword.OnePasswordReference,
+				account:   c.MasterPassword.OnePasswordAccount,
+			}
+		case typeVault:
+			c.masterPasswordDecryptor = &vaultDecryptor{
+				address:      c.MasterPassword.VaultAddress,
+				mount:        c.MasterPassword.VaultMount,
+				path:         c.MasterPassword.VaultPath,
+				field:        c.MasterPassword.VaultField,
+				appRoleID:    c.MasterPassword.VaultAppRoleID,
+				appRoleMount: c.MasterPassword.VaultAppRoleMount,
 			}
 		default:
-			panic(fmt.Sprintf("!!! Master password config type '%s' not supported; only supported: %s %s", c.MasterPassword.Type, typeBitwarden, typeEnvVar))
+			// LoadConfig() already rejects unsupported types with common.ErrConfig.
+			panic(fmt.Sprintf("!!! Master password config type '%s' not supported; only supported: %s", c.MasterPassword.Type, strings.Join(supportedTypes, " ")))
 		}
 	}
 	return c.masterPasswordDecryptor
 }
 
+// MasterKeyLocation describes where the master identity is stored, including the entry of natsUtilsCfg.json
+// pointing to it - f.e. to tell the user what to update after rekeying to a new identity.
+func (c *Config) MasterKeyLocation() string {
+	m := c.MasterPassword
+	switch m.Type {
+	case typeEnvVar:
+		return fmt.Sprintf("the environment variable %s", masterKeyEnvVar)
+	case typeKeyFile:
+		return fmt.Sprintf("the key file %s (masterPassword.keyFilePath in %s)", m.KeyFilePath, NatsUtilsConfigFile)
+	case typePassphraseFile:
+		return fmt.Sprintf("the passphrase protected key file %s, encrypted with age -p (masterPassword.passphraseFilePath in %s)", m.PassphraseFilePath, NatsUtilsConfigFile)
+	case typeBitwarden:
+		return fmt.Sprintf("the password of the Bitwarden entry %s (masterPassword.bitwardenVaultEntryName in %s)", m.BitwardenVaultEntryName, NatsUtilsConfigFile)
+	case typePass:
+		p := &passDecryptor{passEntryName: m.PassEntryName, passBinary: m.PassBinary}
+		return fmt.Sprintf("the %s entry %s (masterPassword.passEntryName in %s)", p.binary(), m.PassEntryName, NatsUtilsConfigFile)
+	case typeOnePassword:
+		return fmt.Sprintf("the 1Password field %s (masterPassword.onePasswordReference in %s)", m.OnePasswordReference, NatsUtilsConfigFile)
+	case typeVault:
+		v := &vaultDecryptor{mount: m.VaultMount, path: m.VaultPath, field: m.VaultField}
+		return fmt.Sprintf("the field %s of the Vault secret %s (masterPassword.vaultMount/vaultPath/vaultField in %s)", v.fieldName(), v.secretPath(), NatsUtilsConfigFile)
+	default:
+		return fmt.Sprintf("the master password storage of type %s", m.Type)
+	}
+}
+
 type bitwardenDecryptor struct {
 	bitwardenVaultEntryName string
 }
 
-func (b *bitwardenDecryptor) Unlock() {
+func (b *bitwardenDecryptor) Unlock() error {
 	if len(os.Getenv("BW_SESSION")) > 0 {
 		// already unlocked
-		return
+		return nil
+	}
+	if err := common.RequireInteractive("Bitwarden session", "", "BW_SESSION"); err != nil {
+		return err
 	}
 	cmd := exec.Command("bw", "unlock", "--raw")
 	cmd.Stdin = os.Stdin
@@ -148,15 +439,12 @@ func (b *bitwardenDecryptor) Unlock() {
 	cmd.Stderr = os.Stderr
 	bwSession, err := cmd.Output()
 	if err != nil {
-		panic(err)
-	}
-	err = os.Setenv("BW_SESSION", string(bwSession))
-	if err != nil {
-		panic(err)
+		return fmt.Errorf("bw unlock failed: %w", err)
 	}
+	return os.Setenv("BW_SESSION", string(bwSession))
 }
 
 func (b *bitwardenDecryptor) LoadMasterPassword() (string, error) {
-	return script.Exec(`bw get password "` + b.bitwardenVaultEntryName + `"`).
-		String()
+	// the entry name is passed as a separate argument, so no shell quoting is needed.
+	return runCli("bw", "get", "password", b.bitwardenVaultEntryName)
 }
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMasterKeyLocation(t *testing.T) {
+	cases := map[string]struct {
+		config   MasterPasswordConfig
+		expected []string
+	}{
+		"env var":         {MasterPasswordConfig{Type: typeEnvVar}, []string{masterKeyEnvVar}},
+		"key file":        {MasterPasswordConfig{Type: typeKeyFile, KeyFilePath: "/keys/master.key"}, []string{"/keys/master.key", "masterPassword.keyFilePath"}},
+		"passphrase file": {MasterPasswordConfig{Type: typePassphraseFile, PassphraseFilePath: "/repo/master.age"}, []string{"/repo/master.age", "age -p"}},
+		"bitwarden":       {MasterPasswordConfig{Type: typeBitwarden, BitwardenVaultEntryName: "nats"}, []string{"Bitwarden entry nats"}},
+		"gopass":          {MasterPasswordConfig{Type: typePass, PassEntryName: "nats/master", PassBinary: "gopass"}, []string{"gopass entry nats/master"}},
+		"1password":       {MasterPasswordConfig{Type: typeOnePassword, OnePasswordReference: "op://Private/nats/password"}, []string{"op://Private/nats/password"}},
+		"vault":           {MasterPasswordConfig{Type: typeVault, VaultPath: "nats/master"}, []string{"field identity", "secret/data/nats/master"}},
+	}
+	for name, c := range cases {
+		cfg := Config{MasterPassword: c.config}
+		location := cfg.MasterKeyLocation()
+		for _, expected := range c.expected {
+			if !strings.Contains(location, expected) {
+				t.Errorf("%s: expected %q in %q", name, expected, location)
+			}
+		}
+	}
+}
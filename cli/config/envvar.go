@@ -0,0 +1,28 @@
+package config
+
+import (
+	"fmt"
+	"os"
+)
+
+const masterKeyEnvVar = "MASTER_KEY"
+
+// envVarDecryptor reads the AGE identity from an environment variable (MASTER_KEY by default).
+type envVarDecryptor struct {
+	envVarName string
+}
+
+func (e *envVarDecryptor) Unlock() error {
+	return validateOnUnlock(e)
+}
+
+func (e *envVarDecryptor) LoadMasterPassword() (string, error) {
+	identity := os.Getenv(e.envVarName)
+	if len(identity) == 0 {
+		return "", fmt.Errorf("environment variable %s is not set; it must contain the AGE master key", e.envVarName)
+	}
+	if err := validateAgeIdentity(identity); err != nil {
+		return "", fmt.Errorf("environment variable %s: %w", e.envVarName, err)
+	}
+	return identity, nil
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// HealthProblem is found by CheckBackend; Fix is an actionable hint for the user.
+type HealthProblem struct {
+	Problem string
+	Fix     string
+}
+
+// CheckBackend checks - without unlocking anything - that the master password backend can be used: the CLI tool of
+// the password manager is installed, the Bitwarden vault is unlocked, and the key files exist.
+func (c *Config) CheckBackend() []HealthProblem {
+	var problems []HealthProblem
+	requireBinary := func(binary string, installHint string) bool {
+		if _, err := exec.LookPath(binary); err != nil {
+			problems = append(problems, HealthProblem{
+				Problem: fmt.Sprintf("%s not found in $PATH; it is needed for master password type %s", binary, c.MasterPassword.Type),
+				Fix:     installHint,
+			})
+			return false
+		}
+		return true
+	}
+	requireFile := func(path string, field string) {
+		if path == "" {
+			problems = append(problems, HealthProblem{
+				Problem: fmt.Sprintf("masterPassword.%s is not set in %s", field, NatsUtilsConfigFile),
+				Fix:     fmt.Sprintf("set masterPassword.%s in %s", field, NatsUtilsConfigFile),
+			})
+		} else if _, err := os.Stat(path); err != nil {
+			problems = append(problems, HealthProblem{
+				Problem: fmt.Sprintf("master key file %s: %s", path, err),
+				Fix:     fmt.Sprintf("restore %s, or fix masterPassword.%s in %s", path, field, NatsUtilsConfigFile),
+			})
+		}
+	}
+
+	switch c.MasterPassword.Type {
+	case typeBitwarden:
+		if !requireBinary("bw", "install the Bitwarden CLI: https://bitwarden.com/help/cli/") {
+			break
+		}
+		out, err := runCli("bw", "status")
+		if err != nil {
+			problems = append(problems, HealthProblem{Problem: err.Error(), Fix: "run bw login"})
+			break
+		}
+		var status struct {
+			Status string `json:"status"`
+		}
+		if err := json.Unmarshal([]byte(out), &status); err != nil {
+			problems = append(problems, HealthProblem{Problem: fmt.Sprintf("unexpected output of bw status: %s", err), Fix: "update the Bitwarden CLI"})
+		} else if status.Status != "unlocked" {
+			problems = append(problems, HealthProblem{
+				Problem: fmt.Sprintf("Bitwarden vault is %s", status.Status),
+				Fix:     "run export BW_SESSION=$(bw unlock --raw) (after bw login if unauthenticated)",
+			})
+		}
+	case typePass:
+		binary := (&passDecryptor{passBinary: c.MasterPassword.PassBinary}).binary()
+		requireBinary(binary, fmt.Sprintf("install %s, or set masterPassword.passBinary in %s", binary, NatsUtilsConfigFile))
+	case typeOnePassword:
+		requireBinary("op", "install the 1Password CLI: https://developer.1password.com/docs/cli/")
+	case typeKeyFile:
+		requireFile(c.MasterPassword.KeyFilePath, "keyFilePath")
+	case typePassphraseFile:
+		requireFile(c.MasterPassword.PassphraseFilePath, "passphraseFilePath")
+	case typeEnvVar:
+		if os.Getenv(masterKeyEnvVar) == "" {
+			problems = append(problems, HealthProblem{
+				Problem: fmt.Sprintf("environment variable %s is not set", masterKeyEnvVar),
+				Fix:     fmt.Sprintf("export %s=AGE-SECRET-KEY-...", masterKeyEnvVar),
+			})
+		}
+	}
+	return problems
+}
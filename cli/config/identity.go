@@ -0,0 +1,185 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"filippo.io/age/plugin"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"os"
+	"strings"
+)
+
+// validateOnUnlock is the Unlock() of the decryptors which have nothing to unlock (EnvVar, KeyFile): the identity
+// is loaded right away, so that a missing or broken identity fails before any key is touched.
+func validateOnUnlock(decryptor MasterPasswordDecryptor) error {
+	_, err := decryptor.LoadMasterPassword()
+	return err
+}
+
+// validateAgeIdentity checks that the given string contains a usable identity, see ParseIdentities.
+func validateAgeIdentity(identity string) error {
+	_, err := ParseIdentities(identity)
+	return err
+}
+
+// ParseIdentities parses either AGE identities, one per line (comment lines are allowed) - X25519 identities
+// as created by age-keygen, or plugin identities (AGE-PLUGIN-YUBIKEY-..., see plugin.go) -
+// or an unencrypted SSH private key (ssh-ed25519 or ssh-rsa).
+func ParseIdentities(identity string) ([]age.Identity, error) {
+	if strings.Contains(identity, "-----BEGIN") && strings.Contains(identity, "PRIVATE KEY-----") {
+		id, err := agessh.ParseIdentity([]byte(identity))
+		if err != nil {
+			return nil, fmt.Errorf("not a valid SSH identity: %w", err)
+		}
+		return []age.Identity{id}, nil
+	}
+
+	var ids []age.Identity
+	for _, line := range strings.Split(identity, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "AGE-SECRET-KEY-1"):
+			id, err := age.ParseX25519Identity(line)
+			if err != nil {
+				return nil, fmt.Errorf("not a valid AGE identity: %w", err)
+			}
+			ids = append(ids, id)
+		case strings.HasPrefix(line, "AGE-PLUGIN-"):
+			id, err := plugin.NewIdentity(line, pluginUI)
+			if err != nil {
+				return nil, fmt.Errorf("not a valid AGE plugin identity: %w", err)
+			}
+			ids = append(ids, id)
+		default:
+			return nil, errors.New("not a valid AGE identity: expected AGE-SECRET-KEY-1... or AGE-PLUGIN-...")
+		}
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("no AGE identity found")
+	}
+	return ids, nil
+}
+
+// IdentitiesToRecipients returns the matching recipient for each identity.
+func IdentitiesToRecipients(ids []age.Identity) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, id := range ids {
+		switch id := id.(type) {
+		case *age.X25519Identity:
+			recipients = append(recipients, id.Recipient())
+		case *agessh.Ed25519Identity:
+			recipients = append(recipients, id.Recipient())
+		case *agessh.RSAIdentity:
+			recipients = append(recipients, id.Recipient())
+		case *plugin.Identity:
+			recipients = append(recipients, id.Recipient())
+		default:
+			return nil, fmt.Errorf("internal error: unexpected identity type: %T", id)
+		}
+	}
+	return recipients, nil
+}
+
+// IdentityRecipients returns the recipients of the identities as strings (see ParseRecipient), so that they can be
+// passed on - f.e. by the agent, which keeps the identities. A plugin identity is returned as is: it references the
+// key on the hardware token, and its recipient can only be created from it (see ParseAgentRecipient).
+func IdentityRecipients(identity string) ([]string, error) {
+	if strings.Contains(identity, "-----BEGIN") && strings.Contains(identity, "PRIVATE KEY-----") {
+		signer, err := ssh.ParsePrivateKey([]byte(identity))
+		if err != nil {
+			return nil, fmt.Errorf("not a valid SSH identity: %w", err)
+		}
+		return []string{strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))}, nil
+	}
+
+	var recipients []string
+	for _, line := range strings.Split(identity, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "AGE-SECRET-KEY-1"):
+			id, err := age.ParseX25519Identity(line)
+			if err != nil {
+				return nil, fmt.Errorf("not a valid AGE identity: %w", err)
+			}
+			recipients = append(recipients, id.Recipient().String())
+		case strings.HasPrefix(line, "AGE-PLUGIN-"):
+			recipients = append(recipients, line)
+		default:
+			return nil, errors.New("not a valid AGE identity: expected AGE-SECRET-KEY-1... or AGE-PLUGIN-...")
+		}
+	}
+	if len(recipients) == 0 {
+		return nil, errors.New("no AGE identity found")
+	}
+	return recipients, nil
+}
+
+// ParseAgentRecipient parses a recipient returned by IdentityRecipients.
+func ParseAgentRecipient(s string) (age.Recipient, error) {
+	if strings.HasPrefix(s, "AGE-PLUGIN-") {
+		id, err := plugin.NewIdentity(s, pluginUI)
+		if err != nil {
+			return nil, fmt.Errorf("not a valid AGE plugin identity: %w", err)
+		}
+		return id.Recipient(), nil
+	}
+	return ParseRecipient(s)
+}
+
+// ParseRecipientsFile reads a recipients file: one AGE public key (age1..., or a plugin recipient) or SSH public key
+// (ssh-ed25519 ... / ssh-rsa ...) per line. Empty lines and lines starting with # are ignored.
+func ParseRecipientsFile(path string) ([]age.Recipient, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading recipients file: %w", err)
+	}
+	defer f.Close()
+
+	var recipients []age.Recipient
+	scanner := bufio.NewScanner(f)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, err := ParseRecipient(line)
+		if err != nil {
+			return nil, fmt.Errorf("recipients file %s line %d: %w", path, lineNumber, err)
+		}
+		recipients = append(recipients, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading recipients file: %w", err)
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("recipients file %s does not contain any recipient", path)
+	}
+	return recipients, nil
+}
+
+// ParseRecipient parses an AGE public key (age1...), an AGE plugin recipient (age1yubikey1...)
+// or an SSH public key (ssh-ed25519 ... / ssh-rsa ...)
+func ParseRecipient(s string) (age.Recipient, error) {
+	switch {
+	case strings.HasPrefix(s, "age1"):
+		if r, err := age.ParseX25519Recipient(s); err == nil {
+			return r, nil
+		}
+		// plugin recipients have the form age1<plugin name>1...
+		return plugin.NewRecipient(s, pluginUI)
+	case strings.HasPrefix(s, "ssh-"):
+		return agessh.ParseRecipient(s)
+	default:
+		return nil, fmt.Errorf("unknown recipient type: %q", s)
+	}
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestUnlockFailsEarlyForMissingOrBrokenIdentity(t *testing.T) {
+	brokenFile := filepath.Join(t.TempDir(), "master.key")
+	if err := os.WriteFile(brokenFile, []byte("not an identity"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("EMPTY_MASTER_KEY", "")
+	t.Setenv("BROKEN_MASTER_KEY", "AGE-SECRET-KEY-1BROKEN")
+
+	decryptors := map[string]MasterPasswordDecryptor{
+		"unset env var":    &envVarDecryptor{envVarName: "EMPTY_MASTER_KEY"},
+		"broken env var":   &envVarDecryptor{envVarName: "BROKEN_MASTER_KEY"},
+		"no key file path": &keyFileDecryptor{},
+		"missing key file": &keyFileDecryptor{keyFilePath: filepath.Join(t.TempDir(), "missing.key")},
+		"broken key file":  &keyFileDecryptor{keyFilePath: brokenFile},
+	}
+	for name, decryptor := range decryptors {
+		if err := decryptor.Unlock(); err == nil {
+			t.Errorf("%s: expected Unlock() to fail", name)
+		}
+	}
+}
+
+func TestUnlockLoadsValidIdentity(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "master.key")
+	if err := os.WriteFile(keyFile, []byte("# created: today\n"+identity.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_MASTER_KEY", identity.String())
+
+	for _, decryptor := range []MasterPasswordDecryptor{
+		&envVarDecryptor{envVarName: "TEST_MASTER_KEY"},
+		&keyFileDecryptor{keyFilePath: keyFile},
+	} {
+		if err := decryptor.Unlock(); err != nil {
+			t.Fatalf("%T: %s", decryptor, err)
+		}
+		loaded, err := decryptor.LoadMasterPassword()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(loaded, identity.String()) {
+			t.Errorf("%T: expected the identity, got %q", decryptor, loaded)
+		}
+	}
+}
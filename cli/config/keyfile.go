@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+	"os"
+)
+
+// keyFileDecryptor reads the AGE identity from a file (f.e. created by age-keygen).
+type keyFileDecryptor struct {
+	keyFilePath string
+}
+
+func (k *keyFileDecryptor) Unlock() error {
+	return validateOnUnlock(k)
+}
+
+func (k *keyFileDecryptor) LoadMasterPassword() (string, error) {
+	if len(k.keyFilePath) == 0 {
+		return "", fmt.Errorf("masterPassword.keyFilePath is not set in %s", NatsUtilsConfigFile)
+	}
+	identity, err := os.ReadFile(k.keyFilePath)
+	if err != nil {
+		return "", fmt.Errorf("reading master key file: %w", err)
+	}
+	if err := validateAgeIdentity(string(identity)); err != nil {
+		return "", fmt.Errorf("master key file %s: %w", k.keyFilePath, err)
+	}
+	return string(identity), nil
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+	"github.com/sandstorm/natsCtl/cli/common"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// onePasswordDecryptor loads the AGE identity via the 1Password CLI ("op read op://...").
+type onePasswordDecryptor struct {
+	// reference is a 1Password secret reference, f.e. op://Private/nats-master-key/password
+	reference string
+	// account is optional, if multiple accounts are signed in.
+	account string
+	// session is the session token returned by "op signin --raw"; empty if the CLI
+	// is already authenticated (f.e. by desktop app integration or OP_SERVICE_ACCOUNT_TOKEN).
+	session string
+}
+
+func (o *onePasswordDecryptor) args(args ...string) []string {
+	if len(o.account) > 0 {
+		args = append(args, "--account", o.account)
+	}
+	if len(o.session) > 0 {
+		args = append(args, "--session", o.session)
+	}
+	return args
+}
+
+func (o *onePasswordDecryptor) Unlock() error {
+	if _, err := runCli("op", o.args("whoami")...); err == nil {
+		// already unlocked
+		return nil
+	}
+	if err := common.RequireInteractive("1Password session", "", "OP_SERVICE_ACCOUNT_TOKEN"); err != nil {
+		return err
+	}
+	cmd := exec.Command("op", o.args("signin", "--raw")...)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	session, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("op signin failed: %w", err)
+	}
+	o.session = strings.TrimSpace(string(session))
+	return nil
+}
+
+func (o *onePasswordDecryptor) LoadMasterPassword() (string, error) {
+	identity, err := runCli("op", o.args("read", "--no-newline", o.reference)...)
+	if err != nil {
+		return "", err
+	}
+	if err := validateAgeIdentity(identity); err != nil {
+		return "", fmt.Errorf("1Password secret %s: %w", o.reference, err)
+	}
+	return identity, nil
+}
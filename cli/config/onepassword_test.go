@@ -0,0 +1,71 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sandstorm/natsCtl/cli/common"
+)
+
+// fakeOp puts a fake 1Password CLI in $PATH: "op whoami" succeeds if signedIn, "op read" prints the secret.
+func fakeOp(t *testing.T, signedIn bool, secret string) (argsFile string) {
+	t.Helper()
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretFile, []byte(secret), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SECRET_FILE", secretFile)
+	whoami := "exit 1"
+	if signedIn {
+		whoami = "echo alice@example.com"
+	}
+	return fakeCli(t, "op", `
+case "$1" in
+whoami) `+whoami+` ;;
+read) printf '%s\n' "$@" > "$ARGS_FILE"; cat "$SECRET_FILE" ;;
+*) exit 2 ;;
+esac
+`)
+}
+
+func TestOnePasswordReadsReference(t *testing.T) {
+	identity := newIdentity(t)
+	reference := `op://Private/nats "master" key's/password`
+	argsFile := fakeOp(t, true, identity)
+
+	o := &onePasswordDecryptor{reference: reference, account: "my.1password.com"}
+	if err := o.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := o.LoadMasterPassword()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded != identity {
+		t.Errorf("expected the identity, got %q", loaded)
+	}
+	assertArgs(t, recordedArgs(t, argsFile), "read", "--no-newline", reference, "--account", "my.1password.com")
+}
+
+func TestOnePasswordRejectsInvalidIdentity(t *testing.T) {
+	fakeOp(t, true, "hunter2")
+
+	o := &onePasswordDecryptor{reference: "op://Private/nats-master-key/password"}
+	if _, err := o.LoadMasterPassword(); err == nil {
+		t.Error("expected an invalid identity error")
+	}
+}
+
+func TestOnePasswordDoesNotPromptNonInteractively(t *testing.T) {
+	fakeOp(t, false, "")
+	common.SetNonInteractive(true)
+
+	o := &onePasswordDecryptor{reference: "op://Private/nats-master-key/password"}
+	err := o.Unlock()
+	var missing *common.MissingInputError
+	if !errors.As(err, &missing) || !errors.Is(err, common.ErrValidation) {
+		t.Errorf("expected a missing input error, got %v", err)
+	}
+}
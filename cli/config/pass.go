@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// passDecryptor loads the AGE identity from the first line of a pass (https://www.passwordstore.org/)
+// or gopass entry.
+type passDecryptor struct {
+	passEntryName string
+	// passBinary is "pass" or "gopass"; "pass" if empty.
+	passBinary string
+	// identity is only set after Unlock() was called
+	identity string
+}
+
+func (p *passDecryptor) binary() string {
+	if len(p.passBinary) == 0 {
+		return "pass"
+	}
+	return p.passBinary
+}
+
+// Unlock reads the entry once; the GPG agent might ask for the passphrase of the GPG key (pinentry),
+// so stdin is attached. The identity is then kept in memory, so that we do not need to decrypt the entry
+// for every NKey.
+func (p *passDecryptor) Unlock() error {
+	if len(p.identity) > 0 {
+		// already unlocked
+		return nil
+	}
+	cmd := exec.Command(p.binary(), "show", p.passEntryName)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("%s show %s failed: %w", p.binary(), p.passEntryName, err)
+	}
+
+	// by convention, the password is the first line of the entry.
+	identity, _, _ := strings.Cut(string(out), "\n")
+	if err := validateAgeIdentity(identity); err != nil {
+		return fmt.Errorf("%s entry %s: %w", p.binary(), p.passEntryName, err)
+	}
+	p.identity = identity
+	return nil
+}
+
+func (p *passDecryptor) LoadMasterPassword() (string, error) {
+	if len(p.identity) == 0 {
+		return "", fmt.Errorf("%s entry %s is not unlocked - Unlock() must be called first", p.binary(), p.passEntryName)
+	}
+	return p.identity, nil
+}
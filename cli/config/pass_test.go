@@ -0,0 +1,71 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakePass puts a fake pass (or gopass) binary in $PATH, which prints the given entry for "show".
+func fakePass(t *testing.T, binary string, entry string) (argsFile string) {
+	t.Helper()
+	entryFile := filepath.Join(t.TempDir(), "entry")
+	if err := os.WriteFile(entryFile, []byte(entry), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ENTRY_FILE", entryFile)
+	return fakeCli(t, binary, `printf '%s\n' "$@" > "$ARGS_FILE"; cat "$ENTRY_FILE"`)
+}
+
+func TestPassReadsFirstLineOfEntry(t *testing.T) {
+	identity := newIdentity(t)
+	entryName := `nats/"master" key's`
+	argsFile := fakePass(t, "pass", identity+"\nurl: https://example.com\n")
+
+	p := &passDecryptor{passEntryName: entryName}
+	if err := p.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := p.LoadMasterPassword()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded != identity {
+		t.Errorf("expected the first line of the entry, got %q", loaded)
+	}
+	assertArgs(t, recordedArgs(t, argsFile), "show", entryName)
+}
+
+func TestPassUsesGopassBinary(t *testing.T) {
+	identity := newIdentity(t)
+	argsFile := fakePass(t, "gopass", identity+"\n")
+
+	p := &passDecryptor{passEntryName: "nats/master-key", passBinary: "gopass"}
+	if err := p.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	assertArgs(t, recordedArgs(t, argsFile), "show", "nats/master-key")
+}
+
+func TestPassRejectsInvalidIdentity(t *testing.T) {
+	fakePass(t, "pass", "hunter2\n")
+
+	p := &passDecryptor{passEntryName: "nats/master-key"}
+	err := p.Unlock()
+	if err == nil || !strings.Contains(err.Error(), "pass entry nats/master-key") {
+		t.Errorf("expected an invalid identity error, got %v", err)
+	}
+	if _, err := p.LoadMasterPassword(); err == nil {
+		t.Error("expected LoadMasterPassword to fail when not unlocked")
+	}
+}
+
+func TestPassFails(t *testing.T) {
+	fakeCli(t, "pass", `echo "Error: nats/master-key is not in the password store." >&2; exit 1`)
+
+	p := &passDecryptor{passEntryName: "nats/master-key"}
+	if err := p.Unlock(); err == nil {
+		t.Error("expected Unlock to fail")
+	}
+}
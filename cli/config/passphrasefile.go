@@ -0,0 +1,132 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"fmt"
+	"github.com/pterm/pterm"
+	"github.com/sandstorm/natsCtl/cli/common"
+	"io"
+	"os"
+)
+
+const masterKeyPassphraseEnvVar = "MASTER_KEY_PASSPHRASE"
+
+// passphraseFileDecryptor reads the AGE identity from a passphrase protected file (as created by "age -p"),
+// so that the encrypted identity can be committed to the repository.
+type passphraseFileDecryptor struct {
+	passphraseFilePath string
+	// identity is only set after Unlock() was called
+	identity string
+}
+
+func (p *passphraseFileDecryptor) Unlock() error {
+	if len(p.identity) > 0 {
+		// already unlocked
+		return nil
+	}
+	passphrase := os.Getenv(masterKeyPassphraseEnvVar)
+	if len(passphrase) == 0 {
+		if err := common.RequireInteractive("passphrase", "", masterKeyPassphraseEnvVar); err != nil {
+			return err
+		}
+		var err error
+		passphrase, err = common.RequiredPasswordInput(fmt.Sprintf("Passphrase for %s", p.passphraseFilePath))
+		if err != nil {
+			return err
+		}
+	}
+
+	identity, err := decryptPassphraseFile(p.passphraseFilePath, passphrase)
+	if err != nil {
+		return err
+	}
+	p.identity = identity
+	return nil
+}
+
+func (p *passphraseFileDecryptor) LoadMasterPassword() (string, error) {
+	if len(p.identity) == 0 {
+		return "", fmt.Errorf("master key file %s is not unlocked - Unlock() must be called first", p.passphraseFilePath)
+	}
+	return p.identity, nil
+}
+
+func decryptPassphraseFile(passphraseFilePath string, passphrase string) (string, error) {
+	if len(passphraseFilePath) == 0 {
+		return "", fmt.Errorf("masterPassword.passphraseFilePath is not set in %s", NatsUtilsConfigFile)
+	}
+	f, err := os.Open(passphraseFilePath)
+	if err != nil {
+		return "", fmt.Errorf("reading master key file: %w", err)
+	}
+	defer f.Close()
+
+	scryptIdentity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	// support both armored ("age -p -a") and binary ("age -p") files
+	var r io.Reader = bufio.NewReader(f)
+	if start, _ := r.(*bufio.Reader).Peek(len(armor.Header)); string(start) == armor.Header {
+		r = armor.NewReader(r)
+	}
+	decryptedReader, err := age.Decrypt(r, scryptIdentity)
+	if err != nil {
+		return "", fmt.Errorf("decrypting master key file %s (wrong passphrase?): %w", passphraseFilePath, err)
+	}
+	identity, err := io.ReadAll(decryptedReader)
+	if err != nil {
+		return "", err
+	}
+	if err := validateAgeIdentity(string(identity)); err != nil {
+		return "", fmt.Errorf("master key file %s: %w", passphraseFilePath, err)
+	}
+	return string(identity), nil
+}
+
+// writePassphraseFile encrypts the given AGE identity with a passphrase (scrypt, like "age -p -a")
+func writePassphraseFile(passphraseFilePath string, identity *age.X25519Identity, passphrase string) error {
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	armorWriter := armor.NewWriter(buf)
+	w, err := age.Encrypt(armorWriter, recipient)
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(w, identity.String()+"\n"); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	if err = armorWriter.Close(); err != nil {
+		return err
+	}
+	// the file is meant to be committed, the passphrase protects it.
+	return os.WriteFile(passphraseFilePath, buf.Bytes(), 0644)
+}
+
+func passphraseInputWithConfirmation() (string, error) {
+	for {
+		passphrase, err := common.RequiredPasswordInput("Passphrase")
+		if err != nil {
+			return "", err
+		}
+		confirmation, err := common.RequiredPasswordInput("Confirm Passphrase")
+		if err != nil {
+			return "", err
+		}
+		if passphrase == confirmation {
+			return passphrase, nil
+		}
+		pterm.Warning.Println("Passphrases do not match - please try again.")
+	}
+}
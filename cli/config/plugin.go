@@ -0,0 +1,35 @@
+package config
+
+import (
+	"filippo.io/age/plugin"
+	"github.com/pterm/pterm"
+	"os"
+)
+
+// pluginUI is used by AGE plugins (age-plugin-yubikey, age-plugin-tpm, age-plugin-se, ...), which are
+// looked up as "age-plugin-<name>" in $PATH. They can ask for a PIN or a touch of the hardware token.
+var pluginUI = &plugin.ClientUI{
+	DisplayMessage: func(name, message string) error {
+		pterm.Info.Printfln("%s: %s", name, message)
+		return nil
+	},
+	RequestValue: func(name, prompt string, secret bool) (string, error) {
+		input := pterm.DefaultInteractiveTextInput
+		if secret {
+			return input.WithMask("*").Show(name + ": " + prompt)
+		}
+		return input.Show(name + ": " + prompt)
+	},
+	Confirm: func(name, prompt, yes, no string) (bool, error) {
+		if no == "" {
+			// only a single option, so this is just an acknowledgement
+			_, err := pterm.DefaultInteractiveSelect.WithOptions([]string{yes}).Show(name + ": " + prompt)
+			return err == nil, err
+		}
+		choice, err := pterm.DefaultInteractiveSelect.WithOptions([]string{yes, no}).Show(name + ": " + prompt)
+		return choice == yes, err
+	},
+	WaitTimer: func(name string) {
+		pterm.Warning.WithWriter(os.Stderr).Printfln("%s: waiting on the plugin (touch your hardware token?)", name)
+	},
+}
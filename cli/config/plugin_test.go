@@ -0,0 +1,129 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/plugin"
+	"github.com/sandstorm/natsCtl/cli/keystore"
+)
+
+// fakePlugin implements the age plugin protocol with a "fake" stanza, whose body is the unencrypted file key. It
+// records the protocol and the type of the identity or recipient it got (add-recipient or add-identity).
+const fakePlugin = `echo "$1" >> "$ARGS_FILE"
+key=
+while read -r line; do
+	case "$line" in
+		"-> add-"*) echo "${line#-> }" | cut -d' ' -f1 >> "$ARGS_FILE" ;;
+		"-> wrap-file-key"|"-> recipient-stanza 0 fake") read -r key ;;
+		"-> done")
+			read -r empty
+			break
+			;;
+	esac
+done
+if [ -n "$key" ]; then
+	if [ "$1" = "--age-plugin=recipient-v1" ]; then
+		printf '%s\n' "-> recipient-stanza 0 fake" "$key"
+	else
+		printf '%s\n' "-> file-key 0" "$key"
+	fi
+	read -r ok
+	read -r empty
+fi
+printf '%s\n' "-> done" ""
+`
+
+func TestPluginRecipientAndIdentity(t *testing.T) {
+	argsFile := fakeCli(t, "age-plugin-fake", fakePlugin)
+
+	recipient, err := ParseRecipient(plugin.EncodeRecipient("fake", []byte("token")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := keystore.EncryptArmored([]byte("seed"), []age.Recipient{recipient})
+	if err != nil {
+		t.Fatal(err)
+	}
+	identities, err := ParseIdentities("# the hardware token\n" + plugin.EncodeIdentity("fake", []byte("token")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := keystore.DecryptArmored(ciphertext, identities)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "seed" {
+		t.Errorf("expected the plaintext, got %q", plaintext)
+	}
+	assertArgs(t, recordedArgs(t, argsFile),
+		"--age-plugin=recipient-v1", "add-recipient",
+		"--age-plugin=identity-v1", "add-identity",
+	)
+}
+
+func TestPluginIdentityAsAgentRecipient(t *testing.T) {
+	argsFile := fakeCli(t, "age-plugin-fake", fakePlugin)
+	identity := plugin.EncodeIdentity("fake", []byte("token"))
+
+	// the agent passes on the plugin identity, as its recipient can only be created from it.
+	recipients, err := IdentityRecipients(identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertArgs(t, recipients, identity)
+	recipient, err := ParseAgentRecipient(recipients[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keystore.EncryptArmored([]byte("seed"), []age.Recipient{recipient}); err != nil {
+		t.Fatal(err)
+	}
+	assertArgs(t, recordedArgs(t, argsFile), "--age-plugin=recipient-v1", "add-identity")
+}
+
+func TestPluginError(t *testing.T) {
+	// "no token found", base64 encoded as stanza body
+	fakeCli(t, "age-plugin-fake", `printf '%s\n' "-> error internal" "bm8gdG9rZW4gZm91bmQ"
+while read -r line; do
+	[ "$line" = "-> ok" ] && break
+done
+# the body of the ok stanza; exiting before age wrote it would fail with a broken pipe.
+read -r empty`)
+
+	recipient, err := ParseRecipient(plugin.EncodeRecipient("fake", []byte("token")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = keystore.EncryptArmored([]byte("seed"), []age.Recipient{recipient})
+	if err == nil || !strings.Contains(err.Error(), "fake plugin: no token found") {
+		t.Errorf("expected the error of the plugin, got %v", err)
+	}
+}
+
+func TestMissingPlugin(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	identities, err := ParseIdentities(plugin.EncodeIdentity("fake", []byte("token")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipients, err := IdentitiesToRecipients(identities)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = keystore.EncryptArmored([]byte("seed"), recipients)
+	if err == nil || !strings.Contains(err.Error(), "age-plugin-fake") {
+		t.Errorf("expected an error naming the missing plugin, got %v", err)
+	}
+}
+
+func TestInvalidPluginIdentity(t *testing.T) {
+	if _, err := ParseIdentities("AGE-PLUGIN-FAKE-1INVALID"); err == nil {
+		t.Error("expected an error for an invalid plugin identity")
+	}
+	if _, err := ParseRecipient("age1fake1invalid"); err == nil {
+		t.Error("expected an error for an invalid plugin recipient")
+	}
+}
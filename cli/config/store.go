@@ -0,0 +1,63 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// RootEnvVar specifies the directory containing natsUtilsCfg.json - same as the --root flag.
+const RootEnvVar = "NATSCTL_ROOT"
+
+// DefaultStoreRoot is used if storeRoot is not set in natsUtilsCfg.json.
+const DefaultStoreRoot = "nsc"
+
+// StorePath returns a path inside the store root, f.e. StorePath("store", operator) - the store root contains
+// the nsc store (store/), the NKeys and .creds files (nkeys/), the docs and the generated NATS configs.
+// LoadConfig makes the store root absolute; for a config which could not be loaded, it is relative to the
+// current directory.
+func (c *Config) StorePath(elem ...string) string {
+	root := c.StoreRoot
+	if root == "" {
+		root = DefaultStoreRoot
+	}
+	return filepath.Join(append([]string{root}, elem...)...)
+}
+
+// KeysDir contains the (encrypted) NKeys, in the nsc directory layout.
+func (c *Config) KeysDir() string {
+	return c.StorePath("nkeys", "keys")
+}
+
+// FindConfigFile returns the path of natsUtilsCfg.json: inside root if given; otherwise, the current directory
+// and its parents are searched (like git does). If no config file exists, the path in the current directory
+// is returned, so that it can be bootstrapped there.
+func FindConfigFile(root string) (string, error) {
+	if root != "" {
+		return filepath.Abs(filepath.Join(root, NatsUtilsConfigFile))
+	}
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for dir := workingDir; ; dir = filepath.Dir(dir) {
+		candidate := filepath.Join(dir, NatsUtilsConfigFile)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		if filepath.Dir(dir) == dir {
+			return filepath.Join(workingDir, NatsUtilsConfigFile), nil
+		}
+	}
+}
+
+// resolvePath makes a path from natsUtilsCfg.json absolute; relative paths are relative to the config file,
+// so that the tool works from every directory inside the repository.
+func (c *Config) resolvePath(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(c.dir, path)
+}
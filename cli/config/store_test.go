@@ -0,0 +1,138 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// chdir changes the working directory for the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	workingDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = os.Chdir(workingDir)
+	})
+}
+
+// tempRepo creates a directory with natsUtilsCfg.json and the subdirectories a/b; symlinks are resolved,
+// so that the paths can be compared with os.Getwd().
+func tempRepo(t *testing.T, configJson string) string {
+	t.Helper()
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "a", "b"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, NatsUtilsConfigFile), []byte(configJson), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestFindConfigFileWalksUpTheParents(t *testing.T) {
+	dir := tempRepo(t, `{}`)
+	chdir(t, filepath.Join(dir, "a", "b"))
+
+	configFile, err := FindConfigFile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := filepath.Join(dir, NatsUtilsConfigFile); configFile != expected {
+		t.Errorf("expected %s, got %s", expected, configFile)
+	}
+}
+
+func TestFindConfigFileInRoot(t *testing.T) {
+	dir := tempRepo(t, `{}`)
+	chdir(t, dir)
+
+	// --root is taken as is - even if it contains no config file, as it is bootstrapped there.
+	configFile, err := FindConfigFile(filepath.Join("a", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := filepath.Join(dir, "a", "b", NatsUtilsConfigFile); configFile != expected {
+		t.Errorf("expected %s, got %s", expected, configFile)
+	}
+}
+
+func TestFindConfigFileFallsBackToTheWorkingDirectory(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	chdir(t, dir)
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), NatsUtilsConfigFile)); err == nil {
+		t.Skip("the temp dir is inside a repository")
+	}
+
+	configFile, err := FindConfigFile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := filepath.Join(dir, NatsUtilsConfigFile); configFile != expected {
+		t.Errorf("expected %s, got %s", expected, configFile)
+	}
+}
+
+func TestLoadConfigResolvesPathsRelativeToTheConfigFile(t *testing.T) {
+	dir := tempRepo(t, `{"masterPassword": {"type": "KeyFile", "keyFilePath": "master.key"}, "storeRoot": "data"}`)
+	chdir(t, filepath.Join(dir, "a", "b"))
+
+	cfg, err := LoadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := filepath.Join(dir, "master.key"); cfg.MasterPassword.KeyFilePath != expected {
+		t.Errorf("expected key file %s, got %s", expected, cfg.MasterPassword.KeyFilePath)
+	}
+	if expected := filepath.Join(dir, "data", "store", "OP"); cfg.StorePath("store", "OP") != expected {
+		t.Errorf("expected %s, got %s", expected, cfg.StorePath("store", "OP"))
+	}
+	if expected := filepath.Join(dir, "data", "nkeys", "keys"); cfg.KeysDir() != expected {
+		t.Errorf("expected keys dir %s, got %s", expected, cfg.KeysDir())
+	}
+}
+
+func TestStorePathDefaultsToNsc(t *testing.T) {
+	dir := tempRepo(t, `{"masterPassword": {"type": "EnvVar"}}`)
+
+	cfg, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := filepath.Join(dir, DefaultStoreRoot, "store"); cfg.StorePath("store") != expected {
+		t.Errorf("expected %s, got %s", expected, cfg.StorePath("store"))
+	}
+
+	// a config which was not loaded (f.e. for the doctor) uses the default relative to the working directory.
+	var empty Config
+	if expected := filepath.Join(DefaultStoreRoot, "store"); empty.StorePath("store") != expected {
+		t.Errorf("expected %s, got %s", expected, empty.StorePath("store"))
+	}
+}
+
+func TestConfigsKeepTheirOwnStoreRoot(t *testing.T) {
+	first := tempRepo(t, `{"masterPassword": {"type": "EnvVar"}, "storeRoot": "one"}`)
+	second := tempRepo(t, `{"masterPassword": {"type": "EnvVar"}, "storeRoot": "two"}`)
+
+	firstCfg, err := LoadConfig(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(second); err != nil {
+		t.Fatal(err)
+	}
+	if expected := filepath.Join(first, "one", "nkeys", "keys"); firstCfg.KeysDir() != expected {
+		t.Errorf("loading another config changed the keys dir to %s; expected %s", firstCfg.KeysDir(), expected)
+	}
+}
@@ -0,0 +1,264 @@
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const vaultDefaultMount = "secret"
+const vaultDefaultField = "identity"
+const vaultDefaultAppRoleMount = "approle"
+
+// vaultDecryptor reads the AGE identity from a HashiCorp Vault KV v2 secret.
+//
+// Authentication (first match wins):
+// - AppRole, if a role ID is configured in natsUtilsCfg.json; the secret ID is read from VAULT_SECRET_ID
+// - VAULT_TOKEN environment variable
+// - AppRole, if VAULT_ROLE_ID is set
+// - ~/.vault-token, as written by "vault login"
+//
+// The server certificate is verified against VAULT_CACERT if set; VAULT_SKIP_VERIFY=true disables the verification.
+type vaultDecryptor struct {
+	// address of the Vault server; VAULT_ADDR if empty.
+	address string
+	// mount of the KV v2 secrets engine; "secret" if empty.
+	mount string
+	// path of the secret inside the mount
+	path string
+	// field inside the secret data containing the identity; "identity" if empty.
+	field string
+	// appRoleID enables AppRole authentication; VAULT_ROLE_ID if empty.
+	appRoleID string
+	// appRoleMount is the mount of the AppRole auth method; "approle" if empty.
+	appRoleMount string
+
+	httpClient *http.Client
+	// token is set after login()
+	token string
+	// identity is only set after Unlock() was called
+	identity string
+}
+
+func (v *vaultDecryptor) Unlock() error {
+	if len(v.identity) > 0 {
+		// already unlocked
+		return nil
+	}
+	if err := v.login(); err != nil {
+		return err
+	}
+	identity, err := v.readIdentity()
+	if err != nil {
+		return err
+	}
+	p := v.secretPath()
+	if err := validateAgeIdentity(identity); err != nil {
+		return fmt.Errorf("vault secret %s: %w", p, err)
+	}
+	v.identity = identity
+	return nil
+}
+
+func (v *vaultDecryptor) LoadMasterPassword() (string, error) {
+	if len(v.identity) == 0 {
+		return "", fmt.Errorf("vault secret %s is not unlocked - Unlock() must be called first", v.secretPath())
+	}
+	return v.identity, nil
+}
+
+func (v *vaultDecryptor) secretPath() string {
+	mount := v.mount
+	if len(mount) == 0 {
+		mount = vaultDefaultMount
+	}
+	return strings.Trim(mount, "/") + "/data/" + strings.Trim(v.path, "/")
+}
+
+func (v *vaultDecryptor) fieldName() string {
+	if len(v.field) == 0 {
+		return vaultDefaultField
+	}
+	return v.field
+}
+
+func (v *vaultDecryptor) login() error {
+	if len(v.token) > 0 {
+		return nil
+	}
+	// the AppRole configured for the repository wins over an unrelated token in the environment.
+	if len(v.appRoleID) > 0 {
+		return v.loginAppRole(v.appRoleID, os.Getenv("VAULT_SECRET_ID"))
+	}
+	if token := os.Getenv("VAULT_TOKEN"); len(token) > 0 {
+		v.token = token
+		return nil
+	}
+	if roleID := os.Getenv("VAULT_ROLE_ID"); len(roleID) > 0 {
+		return v.loginAppRole(roleID, os.Getenv("VAULT_SECRET_ID"))
+	}
+
+	home, err := os.UserHomeDir()
+	if err == nil {
+		token, err := os.ReadFile(filepath.Join(home, ".vault-token"))
+		if err == nil && len(bytes.TrimSpace(token)) > 0 {
+			v.token = string(bytes.TrimSpace(token))
+			return nil
+		}
+	}
+	return errors.New("no Vault credentials found: set VAULT_TOKEN, configure AppRole (VAULT_ROLE_ID + VAULT_SECRET_ID) or run 'vault login'")
+}
+
+func (v *vaultDecryptor) loginAppRole(roleID string, secretID string) error {
+	if len(secretID) == 0 {
+		return errors.New("vault AppRole authentication needs the environment variable VAULT_SECRET_ID")
+	}
+	mount := v.appRoleMount
+	if len(mount) == 0 {
+		mount = vaultDefaultAppRoleMount
+	}
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	err := v.request(http.MethodPost, "auth/"+strings.Trim(mount, "/")+"/login", map[string]string{
+		"role_id":   roleID,
+		"secret_id": secretID,
+	}, &resp)
+	if err != nil {
+		return fmt.Errorf("vault AppRole login: %w", err)
+	}
+	if len(resp.Auth.ClientToken) == 0 {
+		return errors.New("vault AppRole login: no client token returned")
+	}
+	v.token = resp.Auth.ClientToken
+	return nil
+}
+
+func (v *vaultDecryptor) readIdentity() (string, error) {
+	var resp struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := v.request(http.MethodGet, v.secretPath(), nil, &resp); err != nil {
+		return "", fmt.Errorf("reading vault secret %s: %w", v.secretPath(), err)
+	}
+	identity, ok := resp.Data.Data[v.fieldName()].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no string field %s", v.secretPath(), v.fieldName())
+	}
+	return identity, nil
+}
+
+// writeIdentity stores the identity as a new version of the KV v2 secret.
+func (v *vaultDecryptor) writeIdentity(identity string) error {
+	if err := v.login(); err != nil {
+		return err
+	}
+	err := v.request(http.MethodPost, v.secretPath(), map[string]any{
+		"data": map[string]string{
+			v.fieldName(): identity,
+		},
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("writing vault secret %s: %w", v.secretPath(), err)
+	}
+	return nil
+}
+
+// request calls the Vault HTTP API; body and response are JSON encoded. response may be nil.
+func (v *vaultDecryptor) request(method string, path string, body any, response any) error {
+	address := v.address
+	if len(address) == 0 {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if len(address) == 0 {
+		return errors.New("no Vault address configured: set masterPassword.vaultAddress or VAULT_ADDR")
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(address, "/")+"/v1/"+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if len(v.token) > 0 {
+		req.Header.Set("X-Vault-Token", v.token)
+	}
+	if namespace := os.Getenv("VAULT_NAMESPACE"); len(namespace) > 0 {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	httpClient, err := v.client()
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.Unmarshal(respBody, &vaultErr)
+		return fmt.Errorf("vault responded with %s: %s", resp.Status, strings.Join(vaultErr.Errors, "; "))
+	}
+	if response != nil && len(respBody) > 0 {
+		return json.Unmarshal(respBody, response)
+	}
+	return nil
+}
+
+// client returns the HTTP client; it is created on first use, with the TLS settings of VAULT_CACERT and
+// VAULT_SKIP_VERIFY.
+func (v *vaultDecryptor) client() (*http.Client, error) {
+	if v.httpClient != nil {
+		return v.httpClient, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caCert := os.Getenv("VAULT_CACERT"); len(caCert) > 0 {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("reading VAULT_CACERT: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("VAULT_CACERT %s contains no PEM encoded certificate", caCert)
+		}
+	}
+	if skipVerify, _ := strconv.ParseBool(os.Getenv("VAULT_SKIP_VERIFY")); skipVerify {
+		tlsConfig.InsecureSkipVerify = true //nolint:gosec // explicitly requested, as with the vault CLI
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	v.httpClient = &http.Client{Timeout: 30 * time.Second, Transport: transport}
+	return v.httpClient, nil
+}
@@ -0,0 +1,276 @@
+package config
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeVault is a stand-in for the Vault HTTP API: AppRole login, and a KV v2 secrets engine mounted at "secret".
+type fakeVault struct {
+	mu       sync.Mutex
+	roleID   string
+	secretID string
+	// tokens which may read and write secrets
+	tokens  map[string]bool
+	secrets map[string]map[string]any
+	// lastToken is the token of the last secret request
+	lastToken string
+}
+
+func newFakeVault(t *testing.T) *fakeVault {
+	t.Helper()
+	// the environment of the developer must not leak into the tests.
+	for _, name := range []string{"VAULT_ADDR", "VAULT_TOKEN", "VAULT_ROLE_ID", "VAULT_SECRET_ID", "VAULT_NAMESPACE", "VAULT_CACERT", "VAULT_SKIP_VERIFY"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("HOME", t.TempDir())
+	return &fakeVault{
+		roleID:   "role",
+		secretID: "secret",
+		tokens:   map[string]bool{"root-token": true},
+		secrets:  map[string]map[string]any{},
+	}
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	respond := func(status int, body any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(body)
+	}
+	denied := map[string][]string{"errors": {"permission denied"}}
+
+	if r.URL.Path == "/v1/auth/approle/login" && r.Method == http.MethodPost {
+		var login map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&login)
+		if login["role_id"] != f.roleID || login["secret_id"] != f.secretID {
+			respond(http.StatusBadRequest, map[string][]string{"errors": {"invalid role or secret ID"}})
+			return
+		}
+		f.tokens["approle-token"] = true
+		respond(http.StatusOK, map[string]any{"auth": map[string]string{"client_token": "approle-token"}})
+		return
+	}
+
+	path, ok := strings.CutPrefix(r.URL.Path, "/v1/secret/data/")
+	if !ok {
+		respond(http.StatusNotFound, map[string][]string{"errors": {}})
+		return
+	}
+	f.lastToken = r.Header.Get("X-Vault-Token")
+	if !f.tokens[f.lastToken] {
+		respond(http.StatusForbidden, denied)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		data, ok := f.secrets[path]
+		if !ok {
+			respond(http.StatusNotFound, map[string][]string{"errors": {}})
+			return
+		}
+		respond(http.StatusOK, map[string]any{"data": map[string]any{"data": data}})
+	case http.MethodPost:
+		var body struct {
+			Data map[string]any `json:"data"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		f.secrets[path] = body.Data
+		respond(http.StatusOK, map[string]any{"data": map[string]any{"version": 1}})
+	default:
+		respond(http.StatusMethodNotAllowed, map[string][]string{"errors": {}})
+	}
+}
+
+func TestVaultReadsIdentityWithToken(t *testing.T) {
+	vault := newFakeVault(t)
+	identity := newIdentity(t)
+	vault.secrets["nats/master-key"] = map[string]any{"identity": identity}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "root-token")
+
+	v := &vaultDecryptor{path: "nats/master-key"}
+	if err := v.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := v.LoadMasterPassword()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded != identity {
+		t.Errorf("expected the identity, got %q", loaded)
+	}
+	if vault.lastToken != "root-token" {
+		t.Errorf("expected VAULT_TOKEN to be used, got %q", vault.lastToken)
+	}
+}
+
+func TestVaultPrefersConfiguredAppRoleOverToken(t *testing.T) {
+	vault := newFakeVault(t)
+	vault.secrets["nats/master-key"] = map[string]any{"identity": newIdentity(t)}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+	t.Setenv("VAULT_TOKEN", "unrelated-token")
+	t.Setenv("VAULT_SECRET_ID", "secret")
+
+	v := &vaultDecryptor{address: server.URL, path: "nats/master-key", appRoleID: "role"}
+	if err := v.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if vault.lastToken != "approle-token" {
+		t.Errorf("expected the AppRole token to be used, got %q", vault.lastToken)
+	}
+}
+
+func TestVaultAppRoleFromEnvironment(t *testing.T) {
+	vault := newFakeVault(t)
+	vault.secrets["nats/master-key"] = map[string]any{"identity": newIdentity(t)}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+	t.Setenv("VAULT_ROLE_ID", "role")
+	t.Setenv("VAULT_SECRET_ID", "secret")
+
+	v := &vaultDecryptor{address: server.URL, path: "nats/master-key"}
+	if err := v.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if vault.lastToken != "approle-token" {
+		t.Errorf("expected the AppRole token to be used, got %q", vault.lastToken)
+	}
+}
+
+func TestVaultAppRoleWithWrongSecretID(t *testing.T) {
+	vault := newFakeVault(t)
+	server := httptest.NewServer(vault)
+	defer server.Close()
+	t.Setenv("VAULT_SECRET_ID", "wrong")
+
+	v := &vaultDecryptor{address: server.URL, path: "nats/master-key", appRoleID: "role"}
+	err := v.Unlock()
+	if err == nil || !strings.Contains(err.Error(), "invalid role or secret ID") {
+		t.Errorf("expected the Vault error, got %v", err)
+	}
+}
+
+func TestVaultTokenFile(t *testing.T) {
+	vault := newFakeVault(t)
+	vault.secrets["nats/master-key"] = map[string]any{"identity": newIdentity(t)}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+	if err := os.WriteFile(filepath.Join(os.Getenv("HOME"), ".vault-token"), []byte("root-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	v := &vaultDecryptor{address: server.URL, path: "nats/master-key"}
+	if err := v.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if vault.lastToken != "root-token" {
+		t.Errorf("expected the token of ~/.vault-token, got %q", vault.lastToken)
+	}
+}
+
+func TestVaultWithoutCredentials(t *testing.T) {
+	newFakeVault(t)
+
+	v := &vaultDecryptor{address: "http://127.0.0.1:1", path: "nats/master-key"}
+	if err := v.Unlock(); err == nil || !strings.Contains(err.Error(), "no Vault credentials found") {
+		t.Errorf("expected a missing credentials error, got %v", err)
+	}
+}
+
+func TestVaultCustomMountAndField(t *testing.T) {
+	vault := newFakeVault(t)
+	identity := newIdentity(t)
+	server := httptest.NewServer(vault)
+	defer server.Close()
+	t.Setenv("VAULT_TOKEN", "root-token")
+
+	// the fake only knows the mount "secret"; a wrong mount must fail.
+	v := &vaultDecryptor{address: server.URL, mount: "kv", path: "nats/master-key"}
+	if err := v.Unlock(); err == nil {
+		t.Error("expected an error for an unknown mount")
+	}
+
+	vault.secrets["nats/master-key"] = map[string]any{"age": identity}
+	v = &vaultDecryptor{address: server.URL, mount: "/secret/", path: "/nats/master-key", field: "age"}
+	if err := v.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	v = &vaultDecryptor{address: server.URL, path: "nats/master-key"}
+	if err := v.Unlock(); err == nil || !strings.Contains(err.Error(), "no string field identity") {
+		t.Errorf("expected a missing field error, got %v", err)
+	}
+}
+
+func TestVaultPermissionDenied(t *testing.T) {
+	vault := newFakeVault(t)
+	server := httptest.NewServer(vault)
+	defer server.Close()
+	t.Setenv("VAULT_TOKEN", "revoked-token")
+
+	v := &vaultDecryptor{address: server.URL, path: "nats/master-key"}
+	err := v.Unlock()
+	if err == nil || !strings.Contains(err.Error(), "403") || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("expected the Vault error, got %v", err)
+	}
+}
+
+func TestVaultWriteIdentity(t *testing.T) {
+	vault := newFakeVault(t)
+	identity := newIdentity(t)
+	server := httptest.NewServer(vault)
+	defer server.Close()
+	t.Setenv("VAULT_TOKEN", "root-token")
+
+	if err := (&vaultDecryptor{address: server.URL, path: "nats/master-key"}).writeIdentity(identity); err != nil {
+		t.Fatal(err)
+	}
+	v := &vaultDecryptor{address: server.URL, path: "nats/master-key"}
+	if err := v.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, _ := v.LoadMasterPassword(); loaded != identity {
+		t.Errorf("expected the written identity, got %q", loaded)
+	}
+}
+
+func TestVaultCACert(t *testing.T) {
+	vault := newFakeVault(t)
+	vault.secrets["nats/master-key"] = map[string]any{"identity": newIdentity(t)}
+	server := httptest.NewTLSServer(vault)
+	defer server.Close()
+	t.Setenv("VAULT_TOKEN", "root-token")
+
+	if err := (&vaultDecryptor{address: server.URL, path: "nats/master-key"}).Unlock(); err == nil {
+		t.Fatal("expected the self-signed certificate to be rejected")
+	}
+
+	caCert := filepath.Join(t.TempDir(), "ca.pem")
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caCert, certPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VAULT_CACERT", caCert)
+	if err := (&vaultDecryptor{address: server.URL, path: "nats/master-key"}).Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("VAULT_CACERT", "")
+	t.Setenv("VAULT_SKIP_VERIFY", "true")
+	if err := (&vaultDecryptor{address: server.URL, path: "nats/master-key"}).Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,155 @@
+package keystore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/nats-io/nkeys"
+	"github.com/sandstorm/natsCtl/cli/transaction"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const encryptedSuffix = ".nk.age"
+
+// AgeDirStore stores every key as AGE encrypted file in the nsc directory layout (keys/A/BC/ABC....nk.age),
+// so that the encrypted keys can be committed to git.
+type AgeDirStore struct {
+	keysDir string
+	cipher  Cipher
+	writer  FileWriter
+}
+
+// FileWriter writes the encrypted key files; f.e. a *transaction.Tx, which stages them until commit.
+type FileWriter interface {
+	WriteFile(path string, data []byte, perm os.FileMode) error
+}
+
+type atomicWriter struct{}
+
+func (atomicWriter) WriteFile(path string, data []byte, perm os.FileMode) error {
+	return transaction.WriteFileAtomic(path, data, perm)
+}
+
+func NewAgeDirStore(keysDir string, cipher Cipher) *AgeDirStore {
+	return &AgeDirStore{
+		keysDir: keysDir,
+		cipher:  cipher,
+		writer:  atomicWriter{},
+	}
+}
+
+// WithWriter returns a copy of the store which writes all keys via the given writer (f.e. a transaction).
+func (s *AgeDirStore) WithWriter(writer FileWriter) *AgeDirStore {
+	return &AgeDirStore{
+		keysDir: s.keysDir,
+		cipher:  s.cipher,
+		writer:  writer,
+	}
+}
+
+// Path returns the path of the encrypted key file
+func (s *AgeDirStore) Path(pubKey string) string {
+	return KeyPath(s.keysDir, pubKey) + ".age"
+}
+
+func (s *AgeDirStore) Put(key nkeys.KeyPair) error {
+	pubKey, err := key.PublicKey()
+	if err != nil {
+		return err
+	}
+	seed, err := key.Seed()
+	if err != nil {
+		return err
+	}
+	ciphertext, err := s.cipher.Encrypt(seed)
+	if err != nil {
+		return fmt.Errorf("encrypting %s: %w", pubKey, err)
+	}
+	// the directories are only created when the file is written - f.e. on commit of a transaction.
+	return s.writer.WriteFile(s.Path(pubKey), ciphertext, 0600)
+}
+
+func (s *AgeDirStore) Get(pubKey string) (nkeys.KeyPair, error) {
+	if err := validatePubKey(pubKey); err != nil {
+		return nil, err
+	}
+	ciphertext, err := os.ReadFile(s.Path(pubKey))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", pubKey, ErrNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+	seed, err := s.cipher.Decrypt(ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting %s: %w", pubKey, err)
+	}
+	return keyPairFromSeed(pubKey, seed)
+}
+
+func (s *AgeDirStore) Delete(pubKey string) error {
+	if err := validatePubKey(pubKey); err != nil {
+		return err
+	}
+	err := os.Remove(s.Path(pubKey))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s: %w", pubKey, ErrNotFound)
+	}
+	return err
+}
+
+func (s *AgeDirStore) List() ([]string, error) {
+	var pubKeys []string
+	err := filepath.WalkDir(s.keysDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(path, encryptedSuffix) {
+			pubKeys = append(pubKeys, strings.TrimSuffix(filepath.Base(path), encryptedSuffix))
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return pubKeys, err
+}
+
+// Rekey decrypts the key with the current cipher and re-encrypts it with newCipher. The result is verified
+// by decrypting it with newCipher, before the file is replaced via the writer of the store (atomically, or staged
+// in a transaction - see WithWriter).
+func (s *AgeDirStore) Rekey(pubKey string, newCipher Cipher) error {
+	key, err := s.Get(pubKey)
+	if err != nil {
+		return err
+	}
+	seed, err := key.Seed()
+	if err != nil {
+		return err
+	}
+	ciphertext, err := newCipher.Encrypt(seed)
+	if err != nil {
+		return err
+	}
+	verified, err := newCipher.Decrypt(ciphertext)
+	if err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	if !bytes.Equal(verified, seed) {
+		return errors.New("verification failed - round trip decryption returned a different seed")
+	}
+	return s.writer.WriteFile(s.Path(pubKey), ciphertext, 0600)
+}
+
+func keyPairFromSeed(pubKey string, seed []byte) (nkeys.KeyPair, error) {
+	key, err := nkeys.FromSeed(seed)
+	if err != nil {
+		return nil, fmt.Errorf("%s: no valid NKey seed: %w", pubKey, err)
+	}
+	if actual, err := key.PublicKey(); err != nil || actual != pubKey {
+		return nil, fmt.Errorf("%s: seed belongs to a different public key %s", pubKey, actual)
+	}
+	return key, nil
+}
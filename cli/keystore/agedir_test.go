@@ -0,0 +1,310 @@
+package keystore
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/nats-io/nkeys"
+	"github.com/sandstorm/natsCtl/cli/transaction"
+)
+
+// ageCipher encrypts to a single X25519 identity.
+type ageCipher struct {
+	identity *age.X25519Identity
+}
+
+func newAgeCipher(t *testing.T) *ageCipher {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ageCipher{identity: identity}
+}
+
+func (c *ageCipher) Encrypt(plaintext []byte) ([]byte, error) {
+	return EncryptArmored(plaintext, []age.Recipient{c.identity.Recipient()})
+}
+
+func (c *ageCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	return DecryptArmored(ciphertext, []age.Identity{c.identity})
+}
+
+// corruptingCipher encrypts correctly, but decrypts to garbage; so the verification of Rekey fails.
+type corruptingCipher struct {
+	*ageCipher
+}
+
+func (c corruptingCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	return []byte("garbage"), nil
+}
+
+func newAccountKey(t *testing.T) (nkeys.KeyPair, string) {
+	t.Helper()
+	key, err := nkeys.CreateAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey, err := key.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, pubKey
+}
+
+func assertSameKey(t *testing.T, actual nkeys.KeyPair, expected nkeys.KeyPair) {
+	t.Helper()
+	actualSeed, err := actual.Seed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedSeed, err := expected.Seed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(actualSeed, expectedSeed) {
+		t.Error("expected the same seed")
+	}
+}
+
+// testKeyStore checks the behaviour every KeyStore shares.
+func testKeyStore(t *testing.T, store KeyStore) {
+	if pubKeys, err := store.List(); err != nil || len(pubKeys) != 0 {
+		t.Fatalf("expected an empty store, got %v (%v)", pubKeys, err)
+	}
+	key1, pubKey1 := newAccountKey(t)
+	key2, pubKey2 := newAccountKey(t)
+	for _, key := range []nkeys.KeyPair{key1, key2} {
+		if err := store.Put(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loaded, err := store.Get(pubKey1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameKey(t, loaded, key1)
+
+	pubKeys, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(pubKeys)
+	expected := []string{pubKey1, pubKey2}
+	sort.Strings(expected)
+	if len(pubKeys) != 2 || pubKeys[0] != expected[0] || pubKeys[1] != expected[1] {
+		t.Errorf("expected %v, got %v", expected, pubKeys)
+	}
+
+	if err := store.Delete(pubKey1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(pubKey1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after deleting, got %v", err)
+	}
+	if err := store.Delete(pubKey1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound when deleting twice, got %v", err)
+	}
+	if _, err := store.Get(pubKey2); err != nil {
+		t.Errorf("expected the other key to be kept, got %v", err)
+	}
+}
+
+func TestAgeDirStore(t *testing.T) {
+	testKeyStore(t, NewAgeDirStore(filepath.Join(t.TempDir(), "keys"), newAgeCipher(t)))
+}
+
+func TestMemoryStore(t *testing.T) {
+	testKeyStore(t, NewMemoryStore())
+}
+
+func TestAgeDirStoreEncryptsInNscLayout(t *testing.T) {
+	keysDir := t.TempDir()
+	store := NewAgeDirStore(keysDir, newAgeCipher(t))
+	key, pubKey := newAccountKey(t)
+	if err := store.Put(key); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(keysDir, pubKey[0:1], pubKey[1:3], pubKey+".nk.age")
+	if store.Path(pubKey) != path {
+		t.Errorf("expected path %s, got %s", path, store.Path(pubKey))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600, got %v", info.Mode().Perm())
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, _ := key.Seed()
+	if bytes.Contains(content, seed) || !bytes.HasPrefix(content, []byte("-----BEGIN AGE ENCRYPTED FILE-----")) {
+		t.Errorf("expected an armored AGE file, got %q", content)
+	}
+}
+
+func TestAgeDirStoreWrongIdentity(t *testing.T) {
+	keysDir := t.TempDir()
+	key, pubKey := newAccountKey(t)
+	if err := NewAgeDirStore(keysDir, newAgeCipher(t)).Put(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewAgeDirStore(keysDir, newAgeCipher(t)).Get(pubKey); err == nil {
+		t.Error("expected decryption with another identity to fail")
+	}
+}
+
+func TestAgeDirStoreDetectsSwappedFiles(t *testing.T) {
+	keysDir := t.TempDir()
+	store := NewAgeDirStore(keysDir, newAgeCipher(t))
+	key1, pubKey1 := newAccountKey(t)
+	key2, pubKey2 := newAccountKey(t)
+	for _, key := range []nkeys.KeyPair{key1, key2} {
+		if err := store.Put(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Rename(store.Path(pubKey2), store.Path(pubKey1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(pubKey1); err == nil {
+		t.Error("expected an error for the seed of a different public key")
+	}
+}
+
+func TestAgeDirStoreWithTransaction(t *testing.T) {
+	keysDir := filepath.Join(t.TempDir(), "keys")
+	store := NewAgeDirStore(keysDir, newAgeCipher(t))
+	key, pubKey := newAccountKey(t)
+
+	tx := transaction.New()
+	if err := store.WithWriter(tx).Put(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(keysDir); !os.IsNotExist(err) {
+		t.Fatalf("expected nothing to be written before commit, got %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := store.Get(pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameKey(t, loaded, key)
+
+	tx = transaction.New()
+	otherKey, otherPubKey := newAccountKey(t)
+	if err := store.WithWriter(tx).Put(otherKey); err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+	if _, err := store.Get(otherPubKey); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after rollback, got %v", err)
+	}
+}
+
+func TestAgeDirStoreRekey(t *testing.T) {
+	keysDir := t.TempDir()
+	oldCipher, newCipher := newAgeCipher(t), newAgeCipher(t)
+	key, pubKey := newAccountKey(t)
+	if err := NewAgeDirStore(keysDir, oldCipher).Put(key); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewAgeDirStore(keysDir, oldCipher).Rekey(pubKey, newCipher); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := NewAgeDirStore(keysDir, newCipher).Get(pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameKey(t, loaded, key)
+	if _, err := NewAgeDirStore(keysDir, oldCipher).Get(pubKey); err == nil {
+		t.Error("expected the old identity to be unable to decrypt the rekeyed key")
+	}
+
+	if err := NewAgeDirStore(keysDir, oldCipher).Rekey(pubKey, newCipher); err == nil {
+		t.Error("expected rekeying with the old identity to fail")
+	}
+	_, missing := newAccountKey(t)
+	if err := NewAgeDirStore(keysDir, newCipher).Rekey(missing, oldCipher); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestAgeDirStoreRekeyVerifies(t *testing.T) {
+	keysDir := t.TempDir()
+	cipher := newAgeCipher(t)
+	store := NewAgeDirStore(keysDir, cipher)
+	key, pubKey := newAccountKey(t)
+	if err := store.Put(key); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(store.Path(pubKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Rekey(pubKey, corruptingCipher{newAgeCipher(t)}); err == nil {
+		t.Fatal("expected the verification to fail")
+	}
+	after, err := os.ReadFile(store.Path(pubKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("expected the key file to be unchanged after a failed verification")
+	}
+}
+
+func TestGetRejectsInvalidPublicKey(t *testing.T) {
+	if _, err := NewAgeDirStore(t.TempDir(), newAgeCipher(t)).Get("A"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("expected an invalid public key error, got %v", err)
+	}
+}
+
+func TestAgeDirStoreRekeyInTransaction(t *testing.T) {
+	keysDir := t.TempDir()
+	oldCipher, newCipher := newAgeCipher(t), newAgeCipher(t)
+	store := NewAgeDirStore(keysDir, oldCipher)
+	key, pubKey := newAccountKey(t)
+	if err := store.Put(key); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := transaction.New()
+	if err := store.WithWriter(tx).Rekey(pubKey, newCipher); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(pubKey); err != nil {
+		t.Errorf("expected the key to be unchanged before commit, got %s", err)
+	}
+	tx.Rollback()
+	if _, err := store.Get(pubKey); err != nil {
+		t.Errorf("expected the key to be unchanged after rollback, got %s", err)
+	}
+
+	tx = transaction.New()
+	if err := store.WithWriter(tx).Rekey(pubKey, newCipher); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := NewAgeDirStore(keysDir, newCipher).Get(pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameKey(t, loaded, key)
+}
@@ -0,0 +1,73 @@
+// Package keystore stores NKeys (seeds) by their public key.
+package keystore
+
+import (
+	"bytes"
+	"errors"
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"fmt"
+	"github.com/nats-io/nkeys"
+	"io"
+	"path/filepath"
+)
+
+var ErrNotFound = errors.New("key not found")
+
+type KeyStore interface {
+	// Put stores the key; an existing key with the same public key is replaced.
+	Put(key nkeys.KeyPair) error
+	// Get returns the key for the public key, or ErrNotFound.
+	Get(pubKey string) (nkeys.KeyPair, error)
+	// Delete removes the key; or returns ErrNotFound.
+	Delete(pubKey string) error
+	// List returns the public keys of all stored keys.
+	List() ([]string, error)
+}
+
+// Cipher encrypts and decrypts the stored seeds.
+type Cipher interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// KeyPath returns the path of a key inside a keys directory, as laid out by nsc: keys/A/BC/ABC....nk
+func KeyPath(keysDir string, pubKey string) string {
+	return filepath.Join(keysDir, pubKey[0:1], pubKey[1:3], pubKey+".nk")
+}
+
+// EncryptArmored encrypts (armored) to the given recipients
+func EncryptArmored(plaintext []byte, recipients []age.Recipient) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	armorWriter := armor.NewWriter(buf)
+	w, err := age.Encrypt(armorWriter, recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(plaintext); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	if err = armorWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecryptArmored decrypts an armored AGE file with any of the given identities
+func DecryptArmored(ciphertext []byte, identities []age.Identity) ([]byte, error) {
+	decryptedReader, err := age.Decrypt(armor.NewReader(bytes.NewReader(ciphertext)), identities...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(decryptedReader)
+}
+
+func validatePubKey(pubKey string) error {
+	if len(pubKey) < 3 {
+		return fmt.Errorf("invalid public key %q", pubKey)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package keystore
+
+import (
+	"fmt"
+	"github.com/nats-io/nkeys"
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps all keys in memory; meant for tests, and for dry runs (where new keys are discarded).
+type MemoryStore struct {
+	mu    sync.Mutex
+	seeds map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		seeds: map[string][]byte{},
+	}
+}
+
+func (s *MemoryStore) Put(key nkeys.KeyPair) error {
+	pubKey, err := key.PublicKey()
+	if err != nil {
+		return err
+	}
+	seed, err := key.Seed()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seeds[pubKey] = append([]byte(nil), seed...)
+	return nil
+}
+
+func (s *MemoryStore) Get(pubKey string) (nkeys.KeyPair, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seed, ok := s.seeds[pubKey]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", pubKey, ErrNotFound)
+	}
+	return keyPairFromSeed(pubKey, seed)
+}
+
+func (s *MemoryStore) Delete(pubKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.seeds[pubKey]; !ok {
+		return fmt.Errorf("%s: %w", pubKey, ErrNotFound)
+	}
+	delete(s.seeds, pubKey)
+	return nil
+}
+
+func (s *MemoryStore) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var pubKeys []string
+	for pubKey := range s.seeds {
+		pubKeys = append(pubKeys, pubKey)
+	}
+	sort.Strings(pubKeys)
+	return pubKeys, nil
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package keystore
+
+import "os"
+
+// processAlive cannot be checked without signals; so the scratch directories of other processes are never wiped.
+func processAlive(pid int) bool {
+	return true
+}
+
+// ownedByUs cannot be checked without Unix file owners.
+func ownedByUs(info os.FileInfo) bool {
+	return false
+}
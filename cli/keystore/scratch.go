@@ -0,0 +1,184 @@
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nats-io/nkeys"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ScratchDirEnvVar overrides the base directory of the scratch directory; it must be memory-backed (f.e. a tmpfs),
+// as it is not checked.
+const ScratchDirEnvVar = "NATSCTL_SCRATCH_DIR"
+
+const scratchPrefix = "natsctl-"
+
+// scratchDir is the private, memory-backed (tmpfs) directory for the few plaintext seeds which must exist as file -
+// f.e. for a nsc subprocess. Every file is tracked, and WipeScratch overwrites and removes them; it is called on exit
+// and on SIGINT/SIGTERM. If the process is killed, the directory of the dead process is wiped on the next start.
+type scratchDir struct {
+	mu    sync.Mutex
+	dir   string
+	files []string
+	wiped bool
+}
+
+var scratch = &scratchDir{}
+
+// WriteScratchKey writes the UNENCRYPTED seed into the keys directory layout of nsc (keys/A/BC/ABC....nk)
+// inside the scratch directory, and returns the keys directory.
+func WriteScratchKey(key nkeys.KeyPair) (string, error) {
+	pubKey, err := key.PublicKey()
+	if err != nil {
+		return "", err
+	}
+	seed, err := key.Seed()
+	if err != nil {
+		return "", err
+	}
+	dir, err := scratch.ensureDir()
+	if err != nil {
+		return "", err
+	}
+	keysDir := filepath.Join(dir, "keys")
+	return keysDir, scratch.writeFile(KeyPath(keysDir, pubKey), seed)
+}
+
+// WipeScratch overwrites all tracked files with zeros, and removes the scratch directory. Afterwards, no plaintext
+// can be written anymore; so it is safe to call from a signal handler while a command is still running.
+func WipeScratch() error {
+	return scratch.wipe()
+}
+
+// WipeStaleScratchDirs removes the scratch directories of processes which are not running anymore (f.e. killed
+// with SIGKILL).
+func WipeStaleScratchDirs() {
+	for _, base := range scratchBaseCandidates() {
+		entries, err := os.ReadDir(base)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			pid, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), scratchPrefix))
+			if !entry.IsDir() || !strings.HasPrefix(entry.Name(), scratchPrefix) || err != nil || processAlive(pid) {
+				continue
+			}
+			dir := filepath.Join(base, entry.Name())
+			if info, err := entry.Info(); err != nil || !ownedByUs(info) {
+				continue
+			}
+			_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+				if err == nil && info.Mode().IsRegular() {
+					_ = overwrite(path, info.Size())
+				}
+				return nil
+			})
+			_ = os.RemoveAll(dir)
+		}
+	}
+}
+
+func (s *scratchDir) ensureDir() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.wiped {
+		return "", errors.New("scratch directory was already wiped")
+	}
+	if s.dir != "" {
+		return s.dir, nil
+	}
+	base, err := ScratchBase()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(base, fmt.Sprintf("%s%d", scratchPrefix, os.Getpid()))
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return "", fmt.Errorf("creating scratch directory: %w", err)
+	}
+	s.dir = dir
+	return dir, nil
+}
+
+func (s *scratchDir) writeFile(path string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.wiped {
+		return errors.New("scratch directory was already wiped")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// tracked before writing, so that a partially written file is wiped as well.
+	s.files = append(s.files, path)
+	return os.WriteFile(path, data, 0600)
+}
+
+func (s *scratchDir) wipe() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.wiped = true
+	if s.dir == "" {
+		return nil
+	}
+	var errs []error
+	for _, file := range s.files {
+		info, err := os.Stat(file)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err == nil {
+			err = overwrite(file, info.Size())
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("wiping %s: %w", file, err))
+		}
+	}
+	if err := os.RemoveAll(s.dir); err != nil {
+		errs = append(errs, err)
+	}
+	s.files = nil
+	return errors.Join(errs...)
+}
+
+// overwrite zeroes the file; on a tmpfs, this overwrites the pages in memory.
+func overwrite(path string, size int64) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(make([]byte, size)); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// ScratchBase returns the directory in which the scratch directory is created: the first memory-backed one of
+// $NATSCTL_SCRATCH_DIR, $XDG_RUNTIME_DIR, /dev/shm and /run/shm.
+func ScratchBase() (string, error) {
+	if dir := os.Getenv(ScratchDirEnvVar); dir != "" {
+		return dir, nil
+	}
+	for _, dir := range scratchBaseCandidates() {
+		if isMemoryBacked(dir) {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("no memory-backed directory (tmpfs) found for plaintext keys; tried %s - set %s to one",
+		strings.Join(scratchBaseCandidates(), ", "), ScratchDirEnvVar)
+}
+
+func scratchBaseCandidates() []string {
+	var candidates []string
+	if dir := os.Getenv(ScratchDirEnvVar); dir != "" {
+		candidates = append(candidates, dir)
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		candidates = append(candidates, dir)
+	}
+	return append(candidates, "/dev/shm", "/run/shm")
+}
@@ -0,0 +1,18 @@
+package keystore
+
+import "syscall"
+
+const (
+	tmpfsMagic = 0x01021994
+	ramfsMagic = 0x858458f6
+)
+
+func isMemoryBacked(dir string) bool {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return false
+	}
+	// the type of the field differs between architectures.
+	fsType := uint32(stat.Type)
+	return fsType == tmpfsMagic || fsType == ramfsMagic
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package keystore
+
+// isMemoryBacked can only be detected on Linux; elsewhere, set ScratchDirEnvVar to a RAM disk.
+func isMemoryBacked(dir string) bool {
+	return false
+}
@@ -0,0 +1,134 @@
+package keystore
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// useScratchBase points the scratch directory to a fresh temporary directory.
+func useScratchBase(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the scratch directory is only supported on Unix")
+	}
+	base := t.TempDir()
+	t.Setenv(ScratchDirEnvVar, base)
+	previous := scratch
+	scratch = &scratchDir{}
+	t.Cleanup(func() { scratch = previous })
+	return base
+}
+
+func TestWriteScratchKeyAndWipe(t *testing.T) {
+	base := useScratchBase(t)
+	key, pubKey := newAccountKey(t)
+
+	keysDir, err := WriteScratchKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(base, fmt.Sprintf("natsctl-%d", os.Getpid()))
+	if keysDir != filepath.Join(dir, "keys") {
+		t.Errorf("expected the keys directory in %s, got %s", dir, keysDir)
+	}
+	path := KeyPath(keysDir, pubKey)
+	seed, _ := key.Seed()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, seed) {
+		t.Error("expected the plaintext seed")
+	}
+	for path, perm := range map[string]os.FileMode{path: 0600, dir: 0700, filepath.Dir(path): 0700} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != perm {
+			t.Errorf("%s: expected mode %v, got %v", path, perm, info.Mode().Perm())
+		}
+	}
+
+	// a hard link keeps the content reachable after the removal; so it shows whether the file was overwritten.
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Link(path, link); err != nil {
+		t.Skipf("hard links are not supported: %s", err)
+	}
+	if err := WipeScratch(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected the scratch directory to be removed, got %v", err)
+	}
+	wiped, err := os.ReadFile(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(wiped, make([]byte, len(seed))) {
+		t.Errorf("expected the seed to be overwritten with zeros, got %q", wiped)
+	}
+
+	if _, err := WriteScratchKey(key); err == nil {
+		t.Error("expected no plaintext to be written after the wipe")
+	}
+	if err := WipeScratch(); err != nil {
+		t.Errorf("expected a second wipe to succeed, got %v", err)
+	}
+}
+
+func TestWipeScratchWithoutKeys(t *testing.T) {
+	base := useScratchBase(t)
+	if err := WipeScratch(); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no scratch directory to be created, got %v", entries)
+	}
+}
+
+func TestWipeStaleScratchDirs(t *testing.T) {
+	base := useScratchBase(t)
+	// the process has exited, so its pid is not in use (unless it was reused in the meantime).
+	exited := exec.Command("true")
+	if err := exited.Run(); err != nil {
+		t.Skipf("cannot start a process: %s", err)
+	}
+	stale := filepath.Join(base, fmt.Sprintf("natsctl-%d", exited.Process.Pid))
+	running := filepath.Join(base, fmt.Sprintf("natsctl-%d", os.Getpid()))
+	unrelated := filepath.Join(base, "natsctl-other")
+	for _, dir := range []string{stale, running, unrelated} {
+		if err := os.MkdirAll(filepath.Join(dir, "keys"), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "keys", "seed.nk"), []byte("seed"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	WipeStaleScratchDirs()
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("expected the directory of the exited process to be wiped, got %v", err)
+	}
+	for _, dir := range []string{running, unrelated} {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("expected %s to be kept, got %v", dir, err)
+		}
+	}
+}
+
+func TestScratchBaseFromEnv(t *testing.T) {
+	base := useScratchBase(t)
+	if dir, err := ScratchBase(); err != nil || dir != base {
+		t.Errorf("expected %s, got %s (%v)", base, dir, err)
+	}
+}
@@ -4,32 +4,45 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package main
 
 import (
-	"github.com/bitfield/script"
 	"github.com/pterm/pterm"
 	"github.com/sandstorm/natsCtl/cli/cmd"
+	"github.com/sandstorm/natsCtl/cli/common"
 	"github.com/sandstorm/natsCtl/cli/config"
 	"os"
-	"regexp"
 )
 
-var nkeyRegexp = regexp.MustCompile(`\.nk$`)
-
 func main() {
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		panic(err)
+	// os.Exit does not run deferred functions; so the cleanup happens inside run().
+	os.Exit(run())
+}
+
+func run() int {
+	completion := cmd.IsCompletion(os.Args[1:])
+	if completion {
+		// completion must never prompt, and only the completion may be printed to stdout.
+		common.SetNonInteractive(true)
+		pterm.SetDefaultOutput(os.Stderr)
+	}
+	doctor := cmd.IsDoctor(os.Args[1:])
+	if doctor {
+		common.SetNonInteractive(true)
+	}
+	cfg, err := config.LoadConfig(cmd.RootFromArgs(os.Args[1:]))
+	// outside a repository, completion works without config (and the store is searched in the current directory);
+	// doctor reports the broken config itself.
+	if err != nil && !completion && !doctor {
+		pterm.Error.Println(err)
+		return common.ExitCode(err)
 	}
 
-	// CLEANUP: in case the script exits (for whatever reason) remove all private NKeys
-	// (except in .creds files for users, as they are useful...)
-	defer func() {
-		if os.Getenv("SKIP_CLEANUP") == "1" {
-			pterm.Warning.Println("Skipped cleanup.")
-			return
-		}
-		script.FindFiles("./nsc").MatchRegexp(nkeyRegexp).ExecForEach("rm {{.}}").Wait()
-		pterm.Info.Println("Removed unencrypted nkeys.")
-	}()
+	// all signing happens in memory; the few plaintext keys which must exist as file (see decrypt-nkey) are kept in
+	// a tmpfs directory, which is wiped on exit, on SIGINT/SIGTERM - and after SIGKILL on the next start.
+	cmd.HandleSignals()
+	defer cmd.Cleanup()
 
-	cmd.Execute(cfg)
+	if err := cmd.Execute(cfg); err != nil {
+		pterm.Error.Println(err)
+		return common.ExitCode(err)
+	}
+	return common.ExitCodeOk
 }
@@ -0,0 +1,132 @@
+// Package shamir splits a secret (f.e. the root seed of an operator) into N-of-M shares with Shamir's secret
+// sharing over GF(256): any threshold shares rebuild the secret, fewer reveal nothing about it.
+//
+// Every share is the x coordinate (1..255) followed by one y byte per secret byte.
+package shamir
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidShares = errors.New("invalid shares")
+
+// Split splits the secret into the given number of shares; threshold of them are needed to combine it again.
+func Split(secret []byte, threshold int, shares int) ([][]byte, error) {
+	switch {
+	case len(secret) == 0:
+		return nil, errors.New("cannot split an empty secret")
+	case threshold < 2:
+		return nil, fmt.Errorf("threshold must be at least 2, got %d", threshold)
+	case shares < threshold:
+		return nil, fmt.Errorf("need at least as many shares as the threshold (%d), got %d", threshold, shares)
+	case shares > 255:
+		return nil, fmt.Errorf("at most 255 shares are supported, got %d", shares)
+	}
+	result := make([][]byte, shares)
+	for i := range result {
+		result[i] = make([]byte, len(secret)+1)
+		result[i][0] = byte(i + 1)
+	}
+	// one random polynomial of degree threshold-1 per secret byte; the secret byte is its value at x=0.
+	coefficients := make([]byte, threshold)
+	defer Wipe(coefficients)
+	for b, secretByte := range secret {
+		coefficients[0] = secretByte
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, fmt.Errorf("reading random coefficients: %w", err)
+		}
+		for _, share := range result {
+			share[b+1] = evaluate(coefficients, share[0])
+		}
+	}
+	return result, nil
+}
+
+// Combine rebuilds the secret from at least threshold shares. With fewer shares (or shares of different secrets),
+// the result is a wrong secret, not an error - so the result must be verified (f.e. against a public key).
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, fmt.Errorf("%w: at least 2 shares are needed, got %d", ErrInvalidShares, len(shares))
+	}
+	length := len(shares[0])
+	seen := map[byte]bool{}
+	for _, share := range shares {
+		switch {
+		case len(share) < 2 || len(share) != length:
+			return nil, fmt.Errorf("%w: shares have different lengths", ErrInvalidShares)
+		case share[0] == 0:
+			return nil, fmt.Errorf("%w: share with x=0", ErrInvalidShares)
+		case seen[share[0]]:
+			return nil, fmt.Errorf("%w: share %d was given twice", ErrInvalidShares, share[0])
+		}
+		seen[share[0]] = true
+	}
+
+	// Lagrange interpolation at x=0; in GF(256), subtraction is addition (xor).
+	secret := make([]byte, length-1)
+	for i, share := range shares {
+		basis := byte(1)
+		for j, other := range shares {
+			if i != j {
+				basis = mul(basis, div(other[0], other[0]^share[0]))
+			}
+		}
+		for b := range secret {
+			secret[b] ^= mul(share[b+1], basis)
+		}
+	}
+	return secret, nil
+}
+
+// evaluate evaluates the polynomial at x with Horner's method.
+func evaluate(coefficients []byte, x byte) byte {
+	result := byte(0)
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result = mul(result, x) ^ coefficients[i]
+	}
+	return result
+}
+
+// expTable and logTable are the powers and logarithms of the generator 3 in GF(256) with the AES polynomial
+// x^8 + x^4 + x^3 + x + 1 (0x11b); expTable is doubled, so that the sum of two logarithms needs no modulo.
+var expTable, logTable = generateTables()
+
+func generateTables() (exp [510]byte, log [256]byte) {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i] = x
+		exp[i+255] = x
+		log[x] = byte(i)
+		// multiply by the generator 3: x*2 xor x, reduced by the polynomial.
+		doubled := x << 1
+		if x&0x80 != 0 {
+			doubled ^= 0x1b
+		}
+		x ^= doubled
+	}
+	return exp, log
+}
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+int(logTable[b])]
+}
+
+// div divides a by b; b must not be 0.
+func div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+255-int(logTable[b])]
+}
+
+// Wipe overwrites secret data (f.e. a seed or a share) with zeros.
+func Wipe(data []byte) {
+	for i := range data {
+		data[i] = 0
+	}
+}
@@ -0,0 +1,160 @@
+package shamir
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"math/bits"
+	"testing"
+)
+
+func randomSecret(t *testing.T, length int) []byte {
+	t.Helper()
+	secret := make([]byte, length)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+// subset returns the shares whose index is set in mask.
+func subset(shares [][]byte, mask int) [][]byte {
+	var result [][]byte
+	for i, share := range shares {
+		if mask&(1<<i) != 0 {
+			result = append(result, share)
+		}
+	}
+	return result
+}
+
+func TestSplitAndCombineEveryThreshold(t *testing.T) {
+	secret := randomSecret(t, 32)
+	for total := 2; total <= 7; total++ {
+		for threshold := 2; threshold <= total; threshold++ {
+			shares, err := Split(secret, threshold, total)
+			if err != nil {
+				t.Fatalf("%d-of-%d: %s", threshold, total, err)
+			}
+			if len(shares) != total {
+				t.Fatalf("%d-of-%d: expected %d shares, got %d", threshold, total, total, len(shares))
+			}
+			for mask := 1; mask < 1<<total; mask++ {
+				count := bits.OnesCount(uint(mask))
+				if count < 2 {
+					continue
+				}
+				combined, err := Combine(subset(shares, mask))
+				if err != nil {
+					t.Fatalf("%d-of-%d, shares %b: %s", threshold, total, mask, err)
+				}
+				if matches := bytes.Equal(combined, secret); matches != (count >= threshold) {
+					t.Errorf("%d-of-%d, shares %b: expected the secret to be rebuilt: %v", threshold, total, mask, count >= threshold)
+				}
+			}
+		}
+	}
+}
+
+func TestCombineIgnoresOrder(t *testing.T) {
+	secret := randomSecret(t, 16)
+	shares, err := Split(secret, 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	combined, err := Combine([][]byte{shares[4], shares[0], shares[2]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(combined, secret) {
+		t.Error("expected the secret to be rebuilt")
+	}
+}
+
+func TestSplitUsesFreshRandomness(t *testing.T) {
+	secret := randomSecret(t, 16)
+	first, err := Split(secret, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Split(secret, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(first[0], second[0]) {
+		t.Error("expected different shares for every split")
+	}
+	for _, share := range first {
+		if bytes.Equal(share[1:], secret) {
+			t.Error("expected no share to contain the secret")
+		}
+	}
+}
+
+func TestSplitMaximumShares(t *testing.T) {
+	secret := randomSecret(t, 8)
+	shares, err := Split(secret, 2, 255)
+	if err != nil {
+		t.Fatal(err)
+	}
+	combined, err := Combine([][]byte{shares[0], shares[254]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(combined, secret) {
+		t.Error("expected the secret to be rebuilt")
+	}
+}
+
+func TestSplitRejectsInvalidParameters(t *testing.T) {
+	secret := randomSecret(t, 8)
+	for name, params := range map[string]struct {
+		secret    []byte
+		threshold int
+		shares    int
+	}{
+		"empty secret":             {nil, 2, 3},
+		"threshold 1":              {secret, 1, 3},
+		"threshold 0":              {secret, 0, 3},
+		"fewer shares than needed": {secret, 3, 2},
+		"more than 255 shares":     {secret, 2, 256},
+	} {
+		if _, err := Split(params.secret, params.threshold, params.shares); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestCombineRejectsInvalidShares(t *testing.T) {
+	shares, err := Split(randomSecret(t, 8), 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherLength, err := Split(randomSecret(t, 9), 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	duplicate := append([]byte(nil), shares[0]...)
+	zeroX := append([]byte{0}, shares[1][1:]...)
+
+	for name, invalid := range map[string][][]byte{
+		"no shares":         nil,
+		"single share":      {shares[0]},
+		"duplicate share":   {shares[0], duplicate},
+		"different lengths": {shares[0], otherLength[1]},
+		"share with x=0":    {shares[0], zeroX},
+		"empty share":       {{}, {}},
+	} {
+		if _, err := Combine(invalid); !errors.Is(err, ErrInvalidShares) {
+			t.Errorf("%s: expected ErrInvalidShares, got %v", name, err)
+		}
+	}
+}
+
+func TestWipe(t *testing.T) {
+	data := []byte("seed")
+	Wipe(data)
+	if !bytes.Equal(data, make([]byte, 4)) {
+		t.Errorf("expected zeros, got %v", data)
+	}
+}
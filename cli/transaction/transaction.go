@@ -0,0 +1,165 @@
+// Package transaction stages the file writes of a multi-file operation (f.e. an account JWT plus its encrypted
+// keys) and commits them together, so that a failure in between does not leave orphaned keys or half-updated
+// JWTs behind.
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var ErrDone = errors.New("transaction already committed or rolled back")
+
+type Tx struct {
+	files []stagedFile
+	done  bool
+}
+
+type stagedFile struct {
+	path string
+	data []byte
+	perm os.FileMode
+}
+
+// previousState is needed to roll back an already renamed file.
+type previousState struct {
+	path    string
+	existed bool
+	data    []byte
+	perm    os.FileMode
+}
+
+func New() *Tx {
+	return &Tx{}
+}
+
+// WriteFile stages the file; nothing is written to disk before Commit(). Staging the same path again
+// replaces the previously staged content.
+func (t *Tx) WriteFile(path string, data []byte, perm os.FileMode) error {
+	if t.done {
+		return ErrDone
+	}
+	for i := range t.files {
+		if t.files[i].path == path {
+			t.files[i].data = data
+			t.files[i].perm = perm
+			return nil
+		}
+	}
+	t.files = append(t.files, stagedFile{path: path, data: data, perm: perm})
+	return nil
+}
+
+// Commit writes all staged files to temporary files first, and then renames them into place.
+// If anything fails, the already replaced files are restored.
+func (t *Tx) Commit() (err error) {
+	if t.done {
+		return ErrDone
+	}
+	t.done = true
+
+	tempFiles := make([]string, len(t.files))
+	defer func() {
+		for _, tempFile := range tempFiles {
+			if tempFile != "" {
+				_ = os.Remove(tempFile)
+			}
+		}
+	}()
+
+	for i, f := range t.files {
+		tempFiles[i], err = writeTempFile(f.path, f.data, f.perm)
+		if err != nil {
+			return fmt.Errorf("staging %s: %w", f.path, err)
+		}
+	}
+
+	var applied []previousState
+	for i, f := range t.files {
+		previous := previousState{path: f.path}
+		if previous.data, err = os.ReadFile(f.path); err == nil {
+			previous.existed = true
+			if info, err := os.Stat(f.path); err == nil {
+				previous.perm = info.Mode().Perm()
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return errors.Join(fmt.Errorf("reading %s: %w", f.path, err), restore(applied))
+		}
+
+		if err = os.Rename(tempFiles[i], f.path); err != nil {
+			return errors.Join(fmt.Errorf("writing %s: %w", f.path, err), restore(applied))
+		}
+		tempFiles[i] = ""
+		applied = append(applied, previous)
+	}
+	return nil
+}
+
+// Rollback discards all staged files; it is a no-op after Commit(), so it can always be deferred.
+func (t *Tx) Rollback() {
+	t.done = true
+	t.files = nil
+}
+
+func restore(applied []previousState) error {
+	var errs []error
+	for i := len(applied) - 1; i >= 0; i-- {
+		previous := applied[i]
+		if previous.existed {
+			errs = append(errs, WriteFileAtomic(previous.path, previous.data, previous.perm))
+		} else {
+			errs = append(errs, os.Remove(previous.path))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("rollback failed: %w", err)
+	}
+	return nil
+}
+
+// WriteFileAtomic writes to a temporary file in the same directory and renames it to the target,
+// so that the target is either the old or the new version - never a partially written file.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tempFile, err := writeTempFile(path, data, perm)
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tempFile, path); err != nil {
+		_ = os.Remove(tempFile)
+		return err
+	}
+	return nil
+}
+
+// writeTempFile creates the missing parent directories; they are private if the file is (f.e. the key store).
+func writeTempFile(path string, data []byte, perm os.FileMode) (string, error) {
+	dirPerm := os.FileMode(0755)
+	if perm&0044 == 0 {
+		dirPerm = 0700
+	}
+	if err := os.MkdirAll(filepath.Dir(path), dirPerm); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,211 @@
+package transaction
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func assertFile(t *testing.T, path string, content string, perm os.FileMode) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Errorf("%s: expected %q, got %q", path, content, data)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != perm {
+		t.Errorf("%s: expected mode %v, got %v", path, perm, info.Mode().Perm())
+	}
+}
+
+func assertNotExists(t *testing.T, path string) {
+	t.Helper()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("%s: expected not to exist, got %v", path, err)
+	}
+}
+
+// assertNoTempFiles checks that no temporary file of a commit is left behind.
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+	_ = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && strings.Contains(d.Name(), ".tmp") {
+			t.Errorf("temporary file %s left behind", path)
+		}
+		return err
+	})
+}
+
+func TestCommit(t *testing.T) {
+	dir := t.TempDir()
+	jwtPath := filepath.Join(dir, "accounts", "A", "A.jwt")
+	keyPath := filepath.Join(dir, "keys", "A", "BC", "ABC.nk.age")
+
+	tx := New()
+	if err := tx.WriteFile(jwtPath, []byte("first"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.WriteFile(keyPath, []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// staging the same path again replaces the content.
+	if err := tx.WriteFile(jwtPath, []byte("jwt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assertNotExists(t, filepath.Join(dir, "accounts"))
+	assertNotExists(t, filepath.Join(dir, "keys"))
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, jwtPath, "jwt", 0644)
+	assertFile(t, keyPath, "key", 0600)
+	assertNoTempFiles(t, dir)
+
+	// the directories of private files are private as well.
+	for path, perm := range map[string]os.FileMode{
+		filepath.Join(dir, "keys"):     0700,
+		filepath.Dir(keyPath):          0700,
+		filepath.Join(dir, "accounts"): 0755,
+	} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != perm {
+			t.Errorf("%s: expected mode %v, got %v", path, perm, info.Mode().Perm())
+		}
+	}
+
+	if err := tx.WriteFile(jwtPath, []byte("changed"), 0644); !errors.Is(err, ErrDone) {
+		t.Errorf("expected ErrDone for WriteFile after commit, got %v", err)
+	}
+	if err := tx.Commit(); !errors.Is(err, ErrDone) {
+		t.Errorf("expected ErrDone for a second commit, got %v", err)
+	}
+	// Rollback after Commit does not undo anything.
+	tx.Rollback()
+	assertFile(t, jwtPath, "jwt", 0644)
+}
+
+func TestCommitReplacesExistingFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "A.jwt")
+	if err := os.WriteFile(path, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := New()
+	if err := tx.WriteFile(path, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, path, "new", 0644)
+}
+
+func TestRollback(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keys", "ABC.nk.age")
+
+	tx := New()
+	if err := tx.WriteFile(path, []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+	assertNotExists(t, filepath.Join(dir, "keys"))
+
+	if err := tx.WriteFile(path, []byte("key"), 0600); !errors.Is(err, ErrDone) {
+		t.Errorf("expected ErrDone for WriteFile after rollback, got %v", err)
+	}
+	if err := tx.Commit(); !errors.Is(err, ErrDone) {
+		t.Errorf("expected ErrDone for commit after rollback, got %v", err)
+	}
+	assertNotExists(t, filepath.Join(dir, "keys"))
+}
+
+func TestCommitRestoresFilesOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.jwt")
+	if err := os.WriteFile(existing, []byte("old"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	created := filepath.Join(dir, "created.nk.age")
+	// a non-empty directory cannot be replaced by a file; so the commit fails after the first two files.
+	blocked := filepath.Join(dir, "blocked")
+	if err := os.MkdirAll(filepath.Join(blocked, "child"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := New()
+	for _, path := range []string{existing, created, blocked} {
+		if err := tx.WriteFile(path, []byte("new"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := tx.Commit()
+	if err == nil || !strings.Contains(err.Error(), blocked) {
+		t.Fatalf("expected the commit to fail on %s, got %v", blocked, err)
+	}
+	if strings.Contains(err.Error(), "rollback failed") {
+		t.Errorf("expected the rollback to succeed, got %v", err)
+	}
+
+	assertFile(t, existing, "old", 0640)
+	assertNotExists(t, created)
+	if info, err := os.Stat(blocked); err != nil || !info.IsDir() {
+		t.Errorf("expected %s to be untouched, got %v", blocked, err)
+	}
+	assertNoTempFiles(t, dir)
+}
+
+func TestCommitFailsBeforeRenamingIfStagingFails(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.jwt")
+	if err := os.WriteFile(existing, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the parent directory of the second file cannot be created, as it is a file.
+	unwritable := filepath.Join(existing, "key.nk.age")
+
+	tx := New()
+	if err := tx.WriteFile(existing, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.WriteFile(unwritable, []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err == nil {
+		t.Fatal("expected the commit to fail")
+	}
+	assertFile(t, existing, "old", 0644)
+	assertNoTempFiles(t, dir)
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "private", "seed")
+	if err := WriteFileAtomic(path, []byte("first"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(path, []byte("second"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, path, "second", 0600)
+	info, err := os.Stat(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("expected a private directory, got %v", info.Mode().Perm())
+	}
+	assertNoTempFiles(t, dir)
+}